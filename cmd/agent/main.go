@@ -1,23 +1,121 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 	"yupi/internal/config"
+	"yupi/internal/domain/metrics"
+	"yupi/internal/encryption"
+	"yupi/internal/grpctransport"
+	"yupi/internal/retry"
 	"yupi/internal/service/agent"
+	"yupi/internal/service/agent/collector"
+	"yupi/internal/tlsconfig"
 )
 
 func main() {
+	// Код выхода выставляется после остановки агента, os.Exit вызывается последним, после остальных defer
+	exitCode := 0
+	defer func() {
+		os.Exit(exitCode)
+	}()
+
 	cfg, err := config.SetConfig()
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	labels, err := metrics.ParseLabels(cfg.Labels)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := []agent.Option{agent.WithLabels(labels), agent.WithKey(cfg.Key)}
+	if cfg.CryptoKey != "" {
+		publicKey, err := encryption.LoadPublicKey(cfg.CryptoKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, agent.WithPublicKey(publicKey))
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.UseTLS() {
+		tlsConfig, err = tlsconfig.Client(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, agent.WithTLS(tlsConfig))
+	}
+
+	if cfg.GRPCAddr != "" {
+		client, err := grpctransport.NewClient(cfg.GRPCAddr, cfg.Key, tlsConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer client.Close()
+		opts = append(opts, agent.WithTransport(client))
+	}
+
+	backoff := retry.DefaultBackoff
+	backoff.Attempts = cfg.RetryAttempts
+	opts = append(opts,
+		agent.WithBackoff(backoff),
+		agent.WithRateLimit(cfg.RateLimit),
+		agent.WithFlushTimeout(time.Duration(cfg.FlushTimeout)*time.Second),
+	)
+
+	if cfg.SpoolDir != "" {
+		spool, err := agent.NewSpool(cfg.SpoolDir, cfg.SpoolMax)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, agent.WithSpool(spool))
+	}
+
+	// Метрики хоста читаются из procfs и sysfs, на других платформах сборщик не подключаем
+	if cfg.HostMetrics && collector.HostSupported {
+		opts = append(opts, agent.WithCollector(collector.NewHost(cfg.HostProc, cfg.HostSys), 0))
+	} else if cfg.HostMetrics {
+		log.Printf("host metrics are only supported on linux, host collector disabled")
+	}
+
 	myAgent := agent.NewAgent(
 		cfg.ServerAddr,
 		cfg.PollInterval,
 		cfg.ReportInterval,
 		cfg.UseGzip,
+		opts...,
 	)
-	myAgent.Run()
+
+	intervals, err := cfg.Intervals()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for name, interval := range intervals {
+		if err := myAgent.SetInterval(name, interval); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, name := range cfg.Disabled() {
+		if err := myAgent.SetEnabled(name, false); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+
+	if err := myAgent.Run(ctx); err != nil {
+		log.Printf("agent stopped with error: %v", err)
+		exitCode = 1
+		return
+	}
+	log.Println("agent stopped, metrics flushed")
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"yupi/internal/encryption"
+)
+
+// Генерирует пару ключей RSA: закрытый для сервера (CRYPTO_KEY сервера),
+// открытый для агентов (CRYPTO_KEY агента)
+func main() {
+	dir := flag.String("o", ".", "Каталог для ключей")
+	bits := flag.Int("b", 4096, "Размер ключа в битах")
+	flag.Parse()
+
+	privatePEM, publicPEM, err := encryption.GenerateKeys(*bits)
+	if err != nil {
+		log.Fatal("Не удалось сгенерировать ключи: " + err.Error())
+	}
+
+	privatePath := filepath.Join(*dir, "private.pem")
+	publicPath := filepath.Join(*dir, "public.pem")
+
+	// Закрытый ключ доступен только владельцу
+	if err := os.WriteFile(privatePath, privatePEM, 0600); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(publicPath, publicPEM, 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("Ключи сохранены: " + privatePath + ", " + publicPath)
+}
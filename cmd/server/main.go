@@ -1,18 +1,29 @@
 package main
 
 import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 	"yupi/internal/config"
+	"yupi/internal/encryption"
+	"yupi/internal/grpctransport"
 	"yupi/internal/httptransport/handlers"
 	"yupi/internal/httptransport/middlewares"
 	"yupi/internal/repository"
+	"yupi/internal/service/alerting"
 	"yupi/internal/service/server"
+	"yupi/internal/tlsconfig"
+
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -22,42 +33,179 @@ func main() {
 	// Инициализация конфига
 	cfg := config.SetServerConfig()
 	// Инициализация хранилища
-	storage := repository.NewMemStorage()
-	fileStorage := repository.NewFileStorage(storage)
+	storage, err := repository.NewStorage(context.Background(), cfg)
+	if err != nil {
+		log.Fatal("Не удалось инициализировать хранилище: " + err.Error())
+	}
+
+	// Сохранялка в файл нужна только файловому хранилищу
+	var metricFileServer *server.MetricsSaver
+	handlerStorage := storage
+	if fileStorage, ok := storage.(*repository.FileStorage); ok {
+		metricFileServer = server.NewMetricsSaver(fileStorage, &cfg)
+		if err := metricFileServer.Run(); err != nil {
+			log.Fatal("Не удалось запустить обработчик файлов")
+		}
+		// При STORE_INTERVAL=0 хендлеры отвечают только после записи на диск
+		handlerStorage = metricFileServer.WrapStorage(storage)
+	}
+
+	// История значений пишется поверх любого хранилища, после успешного обновления
+	var history *repository.History
+	if cfg.HistoryRetention > 0 {
+		history = repository.NewHistory(cfg.HistoryRetention, cfg.HistoryMaxSamples)
+		handlerStorage = repository.WithHistory(handlerStorage, history)
+		go pruneHistory(history, cfg.HistoryRetention)
+	}
 
 	// Инициализация сервера метрик, отдельно разбит на хендлер с хранилищем метрик и отдельно на сохранялку в файл
-	metricHandler := handlers.NewMetricServer(storage)
-	metricFileServer := server.NewMetricsSaver(*fileStorage, &cfg)
-	err := metricFileServer.Run()
+	metricHandler := handlers.NewMetricServer(handlerStorage)
 
-	if err != nil {
-		log.Fatal("Не удалось запустить обработчик файлов")
+	// Закрытый ключ для расшифровки запросов агентов
+	var privateKey *rsa.PrivateKey
+	if cfg.CryptoKey != "" {
+		privateKey, err = encryption.LoadPrivateKey(cfg.CryptoKey)
+		if err != nil {
+			log.Fatal("Не удалось загрузить закрытый ключ: " + err.Error())
+		}
 	}
 
 	// Инициализация роутера
 	r := chi.NewRouter()
-	r.Use(middlewares.LoggingRequestMiddleware, middlewares.GzipMiddleware)
+	// Агент сжимает, затем шифрует, а подписывает исходное тело, поэтому на сервере
+	// сначала расшифровка, затем распаковка и только потом проверка подписи
+	r.Use(
+		middlewares.LoggingRequestMiddleware,
+		middlewares.DecryptMiddleware(privateKey),
+		middlewares.GzipMiddleware,
+		middlewares.HashMiddleware(cfg.Key),
+	)
 
 	// Настройка маршрутов
+	// Запись метрик разрешена только из доверенных подсетей
+	trustedSubnets, err := middlewares.ParseSubnets(cfg.TrustedSubnet)
+	if err != nil {
+		log.Fatal(err)
+	}
+	trusted := middlewares.TrustedSubnetMiddleware(trustedSubnets)
+
 	r.Group(func(r chi.Router) {
 		r.Use(middleware.AllowContentType("application/json"))
-		r.Post("/update/", metricHandler.JSONUpdateHandler)
+		r.With(trusted).Post("/update/", metricHandler.JSONUpdateHandler)
+		r.With(trusted).Post("/updates/", metricHandler.JSONUpdatesHandler)
 		r.Post("/value/", metricHandler.JSONValueHandler)
 	})
 
-	r.Post("/update/{type}/{name}/{value}", metricHandler.UpdateHandler)
+	r.With(trusted).Post("/update/{type}/{name}/{value}", metricHandler.UpdateHandler)
 	r.Get("/value/{type}/{name}", metricHandler.ValueHandler)
 	r.Get("/", metricHandler.MainHandler)
+	r.Get("/metrics", metricHandler.PrometheusHandler)
+	r.Get("/api/v1/metrics", metricHandler.ListHandler)
+	if history != nil {
+		r.Get("/history/{type}/{name}", handlers.NewHistoryServer(history).RangeHandler)
+	}
+
+	// Правила оповещений вычисляются по тому же хранилищу, что видят хендлеры
+	if cfg.RulesFile != "" {
+		rules, err := alerting.LoadRules(cfg.RulesFile)
+		if err != nil {
+			log.Fatal("Не удалось загрузить правила оповещений: " + err.Error())
+		}
+		engine, err := alerting.NewEngine(handlerStorage, history, rules)
+		if err != nil {
+			log.Fatal("Не удалось запустить оповещения: " + err.Error())
+		}
+
+		notifyConfig, err := alerting.LoadNotifyConfig(cfg.RulesFile)
+		if err != nil {
+			log.Fatal("Не удалось загрузить настройки уведомлений: " + err.Error())
+		}
+		if len(notifyConfig.Webhooks) > 0 {
+			notifier, err := alerting.NewNotifier(notifyConfig)
+			if err != nil {
+				log.Fatal("Не удалось настроить уведомления: " + err.Error())
+			}
+			engine.SetNotifier(notifier)
+		}
+
+		// Тишины и подтверждения сохраняются в снимке файлового хранилища вместе с метриками
+		if fileStorage, ok := storage.(*repository.FileStorage); ok {
+			if err := fileStorage.RegisterState(alerting.SilencesSection, engine.Silences()); err != nil {
+				log.Fatal("Не удалось восстановить тишины оповещений: " + err.Error())
+			}
+			if metricFileServer.IsSync() {
+				engine.Silences().OnChange(metricFileServer.Sync)
+			}
+		}
+
+		go engine.Run(context.Background(), cfg.RulesInterval)
+
+		alertsHandler := handlers.NewAlertsServer(engine)
+		silencesHandler := handlers.NewSilencesServer(engine.Silences())
+		jsonBody := middleware.AllowContentType("application/json")
+
+		r.Get("/alerts", alertsHandler.ListHandler)
+		r.With(trusted, jsonBody).Post("/alerts/{id}/ack", alertsHandler.AckHandler)
+		r.Get("/silences", silencesHandler.ListHandler)
+		r.With(trusted, jsonBody).Post("/silences", silencesHandler.CreateHandler)
+		r.With(trusted).Delete("/silences/{id}", silencesHandler.ExpireHandler)
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.UseTLS() {
+		tlsConfig, err = tlsconfig.Server(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA)
+		if err != nil {
+			log.Fatal("Не удалось настроить TLS: " + err.Error())
+		}
+	}
+
+	// gRPC сервис работает на отдельном порту поверх того же хранилища
+	var grpcServer *grpc.Server
+	if cfg.GRPCAddr != "" {
+		grpcServer = grpctransport.NewServer(handlerStorage, cfg.Key, trustedSubnets, tlsConfig)
+		listener, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			log.Fatal("Не удалось запустить gRPC сервер: " + err.Error())
+		}
+
+		go func() {
+			middlewares.Log.Info("gRPC сервер запущен " + cfg.GRPCAddr)
+			if err := grpcServer.Serve(listener); err != nil {
+				middlewares.Log.Error("gRPC сервер остановлен: " + err.Error())
+			}
+		}()
+	}
 
 	// Обработка сигналов для graceful shutdown
-	setupGracefulShutdown(metricFileServer)
+	setupGracefulShutdown(metricFileServer, storage, grpcServer)
 
 	// Запуск сервера
+	srv := &http.Server{Addr: cfg.ServerAddr, Handler: r, TLSConfig: tlsConfig}
+	if tlsConfig != nil {
+		middlewares.Log.Info("Сервер запущен с TLS " + cfg.ServerAddr)
+		// Сертификат уже загружен в TLSConfig
+		log.Fatal(srv.ListenAndServeTLS("", ""))
+	}
+
 	middlewares.Log.Info("Сервер запущен " + cfg.ServerAddr)
-	log.Fatal(http.ListenAndServe(cfg.ServerAddr, r))
+	log.Fatal(srv.ListenAndServe())
 }
 
-func setupGracefulShutdown(server *server.MetricsSaver) {
+// pruneHistory - периодически удаляет устаревшие точки из рядов, которые перестали обновляться
+func pruneHistory(history *repository.History, retention time.Duration) {
+	interval := retention / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		history.Prune()
+	}
+}
+
+func setupGracefulShutdown(server *server.MetricsSaver, storage repository.Storage, grpcServer *grpc.Server) {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
@@ -65,9 +213,20 @@ func setupGracefulShutdown(server *server.MetricsSaver) {
 		<-sigChan
 		middlewares.Log.Info("Остановка сервера...")
 
+		// Дожидаемся завершения начатых gRPC вызовов, чтобы их обновления попали в хранилище
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+
 		// Сохраняем метрики при завершении
-		if err := server.Stop(); err != nil {
-			middlewares.Log.Error("Не удалось успешно сохранить метрики при остановке сервера: " + err.Error())
+		if server != nil {
+			if err := server.Stop(); err != nil {
+				middlewares.Log.Error("Не удалось успешно сохранить метрики при остановке сервера: " + err.Error())
+			}
+		}
+
+		if err := storage.Close(); err != nil {
+			middlewares.Log.Error("Не удалось закрыть хранилище: " + err.Error())
 		}
 
 		os.Exit(0)
@@ -2,8 +2,11 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"github.com/caarlos0/env/v11"
+	"os"
 	"strings"
+	"time"
 )
 
 const (
@@ -11,13 +14,37 @@ const (
 	DefaultReportInterval = int64(10)
 	DefaultPollInterval   = int64(2)
 	DefaultUseGzip        = bool(true)
+	DefaultRetryAttempts  = 3
+	DefaultSpoolDir       = ""
+	DefaultSpoolMax       = 100
+	DefaultHostProc       = "/proc"
+	DefaultHostSys        = "/sys"
+	DefaultRateLimit      = 1
+	DefaultFlushTimeout   = int64(5)
 )
 
 type Config struct {
-	ServerAddr     string `env:"ADDRESS"`
-	PollInterval   int64  `env:"POLL_INTERVAL"`
-	ReportInterval int64  `env:"REPORT_INTERVAL"`
-	UseGzip        bool   `env:"USE_GZIP" envDefault:"true"`
+	ServerAddr         string `env:"ADDRESS"`
+	PollInterval       int64  `env:"POLL_INTERVAL"`
+	ReportInterval     int64  `env:"REPORT_INTERVAL"`
+	UseGzip            bool   `env:"USE_GZIP" envDefault:"true"`
+	Labels             string `env:"LABELS"`
+	Key                string `env:"KEY"`
+	CryptoKey          string `env:"CRYPTO_KEY"`
+	TLSCA              string `env:"TLS_CA"`
+	TLSCert            string `env:"TLS_CERT"`
+	TLSKey             string `env:"TLS_KEY"`
+	GRPCAddr           string `env:"GRPC_ADDRESS"`
+	RetryAttempts      int    `env:"RETRY_ATTEMPTS"`
+	SpoolDir           string `env:"SPOOL_DIR"`
+	SpoolMax           int    `env:"SPOOL_MAX"`
+	HostMetrics        bool   `env:"HOST_METRICS"`
+	HostProc           string `env:"HOST_PROC"`
+	HostSys            string `env:"HOST_SYS"`
+	DisabledCollectors string `env:"DISABLED_COLLECTORS"`
+	CollectorIntervals string `env:"COLLECTOR_INTERVALS"`
+	RateLimit          int    `env:"RATE_LIMIT"`
+	FlushTimeout       int64  `env:"FLUSH_TIMEOUT"`
 }
 
 // выставляет значения конфигу из аргументов командной строки
@@ -32,6 +59,23 @@ func SetConfig() (Config, error) {
 	a := flag.String("a", DefaultServerAddr, "Адрес сервера")
 	p := flag.Int64("p", DefaultPollInterval, "Интервал сбора метрик")
 	r := flag.Int64("r", DefaultReportInterval, "Интервал отправки метрик")
+	l := flag.String("l", "", "Метки всех метрик агента, например host=h1,service=api")
+	k := flag.String("k", "", "Ключ подписи запросов HMAC-SHA256")
+	ck := flag.String("crypto-key", "", "Путь к открытому ключу RSA сервера для шифрования запросов")
+	tca := flag.String("tls-ca", "", "Сертификаты центров, которым доверяет агент при проверке сервера")
+	tc := flag.String("tls-cert", "", "Клиентский сертификат агента для mTLS")
+	tk := flag.String("tls-key", "", "Ключ клиентского сертификата агента")
+	g := flag.String("g", "", "Адрес gRPC сервера, если задан, метрики отправляются по gRPC")
+	ra := flag.Int("retry-attempts", DefaultRetryAttempts, "Число попыток отправки пакета")
+	sd := flag.String("spool-dir", DefaultSpoolDir, "Каталог очереди неотправленных пакетов, по умолчанию очередь выключена")
+	sm := flag.Int("spool-max", DefaultSpoolMax, "Максимум пакетов в очереди, старые вытесняются")
+	hm := flag.Bool("host-metrics", true, "Собирать метрики хоста из procfs и sysfs, только в Linux")
+	hp := flag.String("host-proc", DefaultHostProc, "Путь к procfs хоста")
+	hs := flag.String("host-sys", DefaultHostSys, "Путь к sysfs хоста")
+	dc := flag.String("disable-collectors", "", "Выключенные сборщики через запятую, например host,runtime")
+	ci := flag.String("collector-intervals", "", "Интервалы сборщиков, например host=10s,runtime=2s")
+	rl := flag.Int("rate-limit", DefaultRateLimit, "Максимум одновременных запросов к серверу")
+	ft := flag.Int64("flush-timeout", DefaultFlushTimeout, "Секунд на отправку накопленных метрик при остановке агента")
 	flag.Parse()
 
 	if strings.TrimSpace(cfg.ServerAddr) == "" {
@@ -46,5 +90,114 @@ func SetConfig() (Config, error) {
 		cfg.ReportInterval = *r
 	}
 
+	if strings.TrimSpace(cfg.Labels) == "" {
+		cfg.Labels = *l
+	}
+
+	if strings.TrimSpace(cfg.Key) == "" {
+		cfg.Key = *k
+	}
+
+	if strings.TrimSpace(cfg.CryptoKey) == "" {
+		cfg.CryptoKey = *ck
+	}
+
+	if strings.TrimSpace(cfg.TLSCA) == "" {
+		cfg.TLSCA = *tca
+	}
+
+	if strings.TrimSpace(cfg.TLSCert) == "" {
+		cfg.TLSCert = *tc
+	}
+
+	if strings.TrimSpace(cfg.TLSKey) == "" {
+		cfg.TLSKey = *tk
+	}
+
+	if strings.TrimSpace(cfg.GRPCAddr) == "" {
+		cfg.GRPCAddr = *g
+	}
+
+	if cfg.RetryAttempts == 0 {
+		cfg.RetryAttempts = *ra
+	}
+
+	// Пустой SPOOL_DIR в окружении отключает очередь, поэтому смотрим на наличие переменной
+	if _, ok := os.LookupEnv("SPOOL_DIR"); !ok {
+		cfg.SpoolDir = *sd
+	}
+
+	if cfg.SpoolMax == 0 {
+		cfg.SpoolMax = *sm
+	}
+
+	// Как и для SPOOL_DIR, явное HOST_METRICS=false в окружении должно отключать сбор
+	if _, ok := os.LookupEnv("HOST_METRICS"); !ok {
+		cfg.HostMetrics = *hm
+	}
+
+	if strings.TrimSpace(cfg.HostProc) == "" {
+		cfg.HostProc = *hp
+	}
+
+	if strings.TrimSpace(cfg.HostSys) == "" {
+		cfg.HostSys = *hs
+	}
+
+	if strings.TrimSpace(cfg.DisabledCollectors) == "" {
+		cfg.DisabledCollectors = *dc
+	}
+
+	if strings.TrimSpace(cfg.CollectorIntervals) == "" {
+		cfg.CollectorIntervals = *ci
+	}
+
+	if cfg.RateLimit <= 0 {
+		cfg.RateLimit = *rl
+	}
+
+	if cfg.FlushTimeout <= 0 {
+		cfg.FlushTimeout = *ft
+	}
+
 	return cfg, err
 }
+
+// UseTLS - нужно ли агенту подключаться по https
+func (c Config) UseTLS() bool {
+	return c.TLSCA != "" || c.TLSCert != "" || c.TLSKey != ""
+}
+
+// Disabled - имена выключенных сборщиков
+func (c Config) Disabled() []string {
+	var names []string
+	for _, name := range strings.Split(c.DisabledCollectors, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Intervals - интервалы сборщиков по именам из строки вида host=10s,runtime=2s
+func (c Config) Intervals() (map[string]time.Duration, error) {
+	intervals := make(map[string]time.Duration)
+	for _, pair := range strings.Split(c.CollectorIntervals, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid collector interval %q, want name=duration", pair)
+		}
+
+		interval, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid interval for collector %s: %q", name, value)
+		}
+		intervals[name] = interval
+	}
+	return intervals, nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"flag"
 	"github.com/caarlos0/env/v11"
 	"os"
@@ -14,6 +15,12 @@ const (
 	DefaultStoreInterval   = 300 * time.Second
 	DefaultFileStoragePath = "tmp/metrics-db.json"
 	DefaultRestore         = true
+	DefaultStorageType     = "file"
+	DefaultSQLitePath      = "tmp/metrics.db"
+	DefaultSnapshotKeep    = 3
+	DefaultHistoryWindow   = time.Hour
+	DefaultHistoryMax      = 100000
+	DefaultRulesInterval   = 15 * time.Second
 )
 
 type ServerConfig struct {
@@ -21,7 +28,28 @@ type ServerConfig struct {
 	StoreInterval   time.Duration
 	FileStoragePath string
 	Restore         bool
-	UseGzip         bool `env:"USE_GZIP" envDefault:"true"`
+	UseGzip         bool   `env:"USE_GZIP" envDefault:"true"`
+	StorageType     string `env:"STORAGE_TYPE"`
+	DatabaseDSN     string `env:"DATABASE_DSN"`
+	SQLitePath      string `env:"SQLITE_PATH"`
+	SnapshotKeep    int    `env:"SNAPSHOT_KEEP"`
+	WALPath         string `env:"WAL_PATH"`
+	WALSync         bool   `env:"WAL_SYNC"`
+	Key             string `env:"KEY"`
+	CryptoKey       string `env:"CRYPTO_KEY"`
+	TLSCert         string `env:"TLS_CERT"`
+	TLSKey          string `env:"TLS_KEY"`
+	TLSClientCA     string `env:"TLS_CLIENT_CA"`
+	TrustedSubnet   string `env:"TRUSTED_SUBNET"`
+	GRPCAddr        string `env:"GRPC_ADDRESS"`
+	// HistoryRetention - сколько хранить историю значений, 0 отключает историю
+	HistoryRetention time.Duration
+	// HistoryMaxSamples - ограничение на общее число точек истории, 0 снимает ограничение
+	HistoryMaxSamples int
+	// RulesFile - файл правил оповещений, пустое значение отключает оповещения
+	RulesFile string `env:"RULES_FILE"`
+	// RulesInterval - интервал вычисления правил оповещений
+	RulesInterval time.Duration `env:"RULES_INTERVAL"`
 }
 
 // Выставляет значения конфиг из аргументов командной строки
@@ -33,12 +61,27 @@ func SetServerConfig() ServerConfig {
 		middlewares.Log.Fatal(err.Error())
 	}
 
+	// Все флаги объявляем до разбора, иначе flag.Parse падает на неизвестных флагах
 	a := flag.String("a", DefaultServerAddr, "Адрес сервера")
-	flag.Parse()
+	s := flag.String("s", "", "storage type: memory, file, postgres, sqlite")
+	d := flag.String("d", "", "database DSN")
+	l := flag.String("l", DefaultSQLitePath, "sqlite database path")
+	n := flag.Int("n", DefaultSnapshotKeep, "number of file snapshots to keep")
+	w := flag.String("w", "", "write-ahead log path, empty disables the log")
+	ws := flag.Bool("wal-sync", false, "fsync write-ahead log after every update")
+	k := flag.String("k", "", "HMAC-SHA256 key for request signing")
+	ck := flag.String("crypto-key", "", "path to RSA private key for request decryption")
+	tc := flag.String("tls-cert", "", "TLS certificate path, enables https")
+	tk := flag.String("tls-key", "", "TLS private key path")
+	tca := flag.String("tls-client-ca", "", "CA bundle for client certificate verification (mTLS)")
+	t := flag.String("t", "", "trusted subnets in CIDR notation, comma separated")
+	g := flag.String("g", "", "gRPC server address, empty disables gRPC")
 
-	if strings.TrimSpace(cfg.ServerAddr) == "" {
-		cfg.ServerAddr = *a
-	}
+	hr := flag.Duration("history-retention", DefaultHistoryWindow, "how long to keep metric history, 0 disables history")
+	hm := flag.Int("history-max-samples", DefaultHistoryMax, "max number of history samples, 0 means unlimited")
+
+	rf := flag.String("rules", "", "alerting rules file, empty disables alerting")
+	ri := flag.Duration("rules-interval", DefaultRulesInterval, "alerting rules evaluation interval")
 
 	var storeIntervalSeconds int
 	flag.IntVar(&storeIntervalSeconds, "i", int(DefaultStoreInterval.Seconds()), "store interval in seconds")
@@ -47,6 +90,10 @@ func SetServerConfig() ServerConfig {
 
 	flag.Parse()
 
+	if strings.TrimSpace(cfg.ServerAddr) == "" {
+		cfg.ServerAddr = *a
+	}
+
 	// Переопределяем, фиксим кейс выше, когда в енвах может быть пустая строка, разрешаем такие значения
 	if envInterval := os.Getenv("STORE_INTERVAL"); envInterval != "" {
 		if i, err := strconv.Atoi(envInterval); err == nil {
@@ -64,5 +111,106 @@ func SetServerConfig() ServerConfig {
 		cfg.Restore = envRestore == "true"
 	}
 
+	if strings.TrimSpace(cfg.DatabaseDSN) == "" {
+		cfg.DatabaseDSN = *d
+	}
+
+	if strings.TrimSpace(cfg.SQLitePath) == "" {
+		cfg.SQLitePath = *l
+	}
+
+	if cfg.SnapshotKeep == 0 {
+		cfg.SnapshotKeep = *n
+	}
+
+	if strings.TrimSpace(cfg.WALPath) == "" {
+		cfg.WALPath = *w
+	}
+
+	if !cfg.WALSync {
+		cfg.WALSync = *ws
+	}
+
+	if strings.TrimSpace(cfg.StorageType) == "" {
+		cfg.StorageType = *s
+	}
+
+	if strings.TrimSpace(cfg.Key) == "" {
+		cfg.Key = *k
+	}
+
+	if strings.TrimSpace(cfg.CryptoKey) == "" {
+		cfg.CryptoKey = *ck
+	}
+
+	if strings.TrimSpace(cfg.TLSCert) == "" {
+		cfg.TLSCert = *tc
+	}
+
+	if strings.TrimSpace(cfg.TLSKey) == "" {
+		cfg.TLSKey = *tk
+	}
+
+	if strings.TrimSpace(cfg.TLSClientCA) == "" {
+		cfg.TLSClientCA = *tca
+	}
+
+	if strings.TrimSpace(cfg.TrustedSubnet) == "" {
+		cfg.TrustedSubnet = *t
+	}
+
+	if strings.TrimSpace(cfg.GRPCAddr) == "" {
+		cfg.GRPCAddr = *g
+	}
+
+	// Значение 0 в окружении допустимо, поэтому смотрим на наличие переменной, а не на нулевое значение
+	cfg.HistoryRetention = *hr
+	if envRetention := os.Getenv("HISTORY_RETENTION"); envRetention != "" {
+		if d, err := time.ParseDuration(envRetention); err == nil {
+			cfg.HistoryRetention = d
+		}
+	}
+
+	cfg.HistoryMaxSamples = *hm
+	if envMax := os.Getenv("HISTORY_MAX_SAMPLES"); envMax != "" {
+		if i, err := strconv.Atoi(envMax); err == nil {
+			cfg.HistoryMaxSamples = i
+		}
+	}
+
+	if strings.TrimSpace(cfg.RulesFile) == "" {
+		cfg.RulesFile = *rf
+	}
+
+	if cfg.RulesInterval <= 0 {
+		cfg.RulesInterval = *ri
+	}
+
+	// Если тип хранилища не задан явно, то наличие DSN означает работу с БД
+	if strings.TrimSpace(cfg.StorageType) == "" {
+		cfg.StorageType = DefaultStorageType
+		if cfg.DatabaseDSN != "" {
+			cfg.StorageType = "postgres"
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		middlewares.Log.Fatal(err.Error())
+	}
+
 	return cfg
 }
+
+// Validate - проверяет сочетания настроек. Клиентские сертификаты проверяются только
+// при https, поэтому TLS_CLIENT_CA без сертификата и ключа сервера молча оставил бы mTLS выключенным
+func (c ServerConfig) Validate() error {
+	if c.TLSClientCA != "" && (c.TLSCert == "" || c.TLSKey == "") {
+		return errors.New("TLS_CLIENT_CA requires TLS_CERT and TLS_KEY")
+	}
+	return nil
+}
+
+// UseTLS - нужно ли серверу принимать соединения по https
+func (c ServerConfig) UseTLS() bool {
+	return c.TLSCert != "" || c.TLSKey != ""
+}
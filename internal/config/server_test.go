@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestServerConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ServerConfig
+		wantErr bool
+	}{
+		{name: "Без_TLS", cfg: ServerConfig{}},
+		{name: "TLS_без_mTLS", cfg: ServerConfig{TLSCert: "cert.pem", TLSKey: "key.pem"}},
+		{name: "mTLS", cfg: ServerConfig{TLSCert: "cert.pem", TLSKey: "key.pem", TLSClientCA: "ca.pem"}},
+		{name: "CA_клиентов_без_сертификата_сервера", cfg: ServerConfig{TLSClientCA: "ca.pem"}, wantErr: true},
+		{name: "CA_клиентов_без_ключа_сервера", cfg: ServerConfig{TLSCert: "cert.pem", TLSClientCA: "ca.pem"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Float - значение gauge, которое переживает кодирование в JSON. Обновление через URL
+// принимает NaN и бесконечности, а JSON их не умеет, поэтому такие значения пишутся
+// строками "NaN", "+Inf", "-Inf", а конечные - обычным числом
+type Float float64
+
+// MarshalJSON - число или строка для NaN и бесконечностей
+func (f Float) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	switch {
+	case math.IsNaN(v):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(v, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-Inf"`), nil
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON - принимает число или одну из строк "NaN", "+Inf", "-Inf"
+func (f *Float) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var v float64
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*f = Float(v)
+		return nil
+	}
+
+	switch s {
+	case "NaN":
+		*f = Float(math.NaN())
+	case "+Inf":
+		*f = Float(math.Inf(1))
+	case "-Inf":
+		*f = Float(math.Inf(-1))
+	default:
+		return fmt.Errorf("invalid float %q", s)
+	}
+	return nil
+}
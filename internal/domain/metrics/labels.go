@@ -0,0 +1,210 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidID       = errors.New("metric id must not contain { or }")
+	ErrInvalidLabel    = errors.New("invalid label name")
+	ErrInvalidSelector = errors.New("invalid label selector")
+)
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Labels - метки метрики, вместе с именем определяют временной ряд
+type Labels map[string]string
+
+// Validate - проверяет имена меток
+func (l Labels) Validate() error {
+	for name := range l {
+		if !labelNameRe.MatchString(name) {
+			return fmt.Errorf("%w: %q", ErrInvalidLabel, name)
+		}
+	}
+	return nil
+}
+
+// String - метки в каноническом виде {a="1",b="2"}, отсортированные по имени
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(l[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ParseLabels - разбирает метки из строки вида host=h1,service=api
+func ParseLabels(s string) (Labels, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	labels := make(Labels)
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidLabel, pair)
+		}
+		labels[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// SeriesKey - ключ временного ряда в хранилище. Для метрик без меток совпадает с именем,
+// поэтому старые данные читаются без миграций.
+func SeriesKey(name string, labels Labels) string {
+	return name + labels.String()
+}
+
+// ParseSeriesKey - разбирает ключ временного ряда обратно на имя и метки
+func ParseSeriesKey(key string) (string, Labels, error) {
+	i := strings.IndexByte(key, '{')
+	if i < 0 {
+		return key, nil, nil
+	}
+	if !strings.HasSuffix(key, "}") {
+		return "", nil, fmt.Errorf("%w: %s", ErrInvalidSelector, key)
+	}
+
+	matchers, err := ParseMatchers(key[i+1 : len(key)-1])
+	if err != nil {
+		return "", nil, err
+	}
+
+	labels := make(Labels, len(matchers))
+	for _, m := range matchers {
+		if m.Op != MatchEqual {
+			return "", nil, fmt.Errorf("%w: %s", ErrInvalidSelector, key)
+		}
+		labels[m.Name] = m.Value
+	}
+
+	return key[:i], labels, nil
+}
+
+// Операторы сравнения меток, как в селекторах Prometheus
+const (
+	MatchEqual     = "="
+	MatchNotEqual  = "!="
+	MatchRegexp    = "=~"
+	MatchNotRegexp = "!~"
+)
+
+// Matcher - условие на значение одной метки
+type Matcher struct {
+	Name  string
+	Op    string
+	Value string
+	re    *regexp.Regexp
+}
+
+// Matches - подходит ли набор меток под условие. Отсутствующая метка считается пустой строкой.
+func (m Matcher) Matches(labels Labels) bool {
+	value := labels[m.Name]
+	switch m.Op {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+// MatchAll - подходит ли набор меток под все условия
+func MatchAll(matchers []Matcher, labels Labels) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseMatchers - разбирает селектор вида host="a",env=~"prod.*" (фигурные скобки необязательны)
+func ParseMatchers(selector string) ([]Matcher, error) {
+	s := strings.TrimSpace(selector)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+
+	var matchers []Matcher
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return matchers, nil
+		}
+
+		opStart := strings.IndexAny(s, "=!")
+		if opStart <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSelector, selector)
+		}
+
+		m := Matcher{Name: strings.TrimSpace(s[:opStart])}
+		if !labelNameRe.MatchString(m.Name) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidLabel, m.Name)
+		}
+
+		rest := s[opStart:]
+		for _, op := range []string{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+			if strings.HasPrefix(rest, op) {
+				m.Op = op
+				break
+			}
+		}
+		if m.Op == "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSelector, selector)
+		}
+		rest = strings.TrimSpace(rest[len(m.Op):])
+
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSelector, selector)
+		}
+		m.Value, _ = strconv.Unquote(quoted)
+
+		// Условия разделяются запятой, после последнего селектор заканчивается
+		s = strings.TrimLeft(rest[len(quoted):], " ")
+		if s != "" && !strings.HasPrefix(s, ",") {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSelector, selector)
+		}
+
+		if m.Op == MatchRegexp || m.Op == MatchNotRegexp {
+			// Как и в Prometheus, регулярное выражение должно совпасть со всем значением
+			m.re, err = regexp.Compile("^(?:" + m.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidSelector, err)
+			}
+		}
+
+		matchers = append(matchers, m)
+	}
+}
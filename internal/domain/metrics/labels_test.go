@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"testing"
+)
+
+func TestSeriesKey_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		labels  Labels
+		wantKey string
+	}{
+		{"Без_меток", "Alloc", nil, "Alloc"},
+		{"Метки_сортируются", "Alloc", Labels{"service": "api", "host": "h1"}, `Alloc{host="h1",service="api"}`},
+		{"Экранирование_значений", "Alloc", Labels{"path": `a"b,c}`}, `Alloc{path="a\"b,c}"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := SeriesKey(tt.id, tt.labels)
+			if key != tt.wantKey {
+				t.Errorf("SeriesKey() = %s, want %s", key, tt.wantKey)
+			}
+
+			id, labels, err := ParseSeriesKey(key)
+			if err != nil {
+				t.Fatalf("ParseSeriesKey() ошибка %v", err)
+			}
+			if id != tt.id || labels.String() != tt.labels.String() {
+				t.Errorf("ParseSeriesKey() = %s %v, want %s %v", id, labels, tt.id, tt.labels)
+			}
+		})
+	}
+}
+
+func TestParseMatchers(t *testing.T) {
+	labels := Labels{"host": "web-1", "env": "prod"}
+
+	tests := []struct {
+		selector  string
+		wantMatch bool
+		wantErr   bool
+	}{
+		{`host="web-1"`, true, false},
+		{`{host="web-1",env="prod"}`, true, false},
+		{`host!="web-1"`, false, false},
+		{`host=~"web-.*"`, true, false},
+		{`host=~"web"`, false, false},
+		{`env!~"dev|test"`, true, false},
+		{`region=""`, true, false},
+		{`host=web-1`, false, true},
+		{`host=~"("`, false, true},
+		{`1host="a"`, false, true},
+		{`{host="web-1"env="prod"}`, false, true},
+		{`{host="web-1"}env="prod"`, false, true},
+		{`host="web-1" , env="prod",`, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			matchers, err := ParseMatchers(tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMatchers() ошибка %v, ожидали ошибку %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := MatchAll(matchers, labels); got != tt.wantMatch {
+				t.Errorf("MatchAll() = %v, want %v", got, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestMetrics_Validate(t *testing.T) {
+	value := 1.0
+	tests := []struct {
+		name    string
+		metric  Metrics
+		wantErr bool
+	}{
+		{"Корректная_метрика", Metrics{ID: "a", MType: TypeGauge, Value: &value, Labels: Labels{"host": "h1"}}, false},
+		{"Фигурные_скобки_в_имени", Metrics{ID: "a{b}", MType: TypeGauge, Value: &value}, true},
+		{"Некорректное_имя_метки", Metrics{ID: "a", MType: TypeGauge, Value: &value, Labels: Labels{"host-name": "h1"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.metric.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() ошибка %v, ожидали ошибку %v", err, tt.wantErr)
+			}
+		})
+	}
+}
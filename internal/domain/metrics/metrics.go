@@ -1,8 +1,62 @@
 package metrics
 
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	TypeGauge   = "gauge"
+	TypeCounter = "counter"
+)
+
+var (
+	ErrEmptyID      = errors.New("metric id is required")
+	ErrInvalidType  = errors.New("invalid metric type")
+	ErrMissingValue = errors.New("value is required")
+	ErrMissingDelta = errors.New("delta is required")
+)
+
 type Metrics struct {
 	ID    string   `json:"id"`              // имя метрики
 	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
 	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
 	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+	// метки временного ряда, например host и service
+	Labels Labels `json:"labels,omitempty"`
+}
+
+// Key - ключ временного ряда метрики в хранилище
+func (m Metrics) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// Validate - проверяет, что метрику можно записать в хранилище
+func (m Metrics) Validate() error {
+	if m.ID == "" {
+		return ErrEmptyID
+	}
+
+	if strings.ContainsAny(m.ID, "{}") {
+		return ErrInvalidID
+	}
+
+	if err := m.Labels.Validate(); err != nil {
+		return err
+	}
+
+	switch m.MType {
+	case TypeGauge:
+		if m.Value == nil {
+			return ErrMissingValue
+		}
+	case TypeCounter:
+		if m.Delta == nil {
+			return ErrMissingDelta
+		}
+	default:
+		return ErrInvalidType
+	}
+
+	return nil
 }
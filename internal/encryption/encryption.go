@@ -0,0 +1,170 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Header - заголовок, которым агент помечает зашифрованное тело запроса
+const Header = "X-Encrypted"
+
+// Scheme - значение заголовка Header: ключ AES-256-GCM зашифрован RSA-OAEP
+const Scheme = "rsa-oaep-aes-gcm"
+
+var ErrInvalidMessage = errors.New("invalid encrypted message")
+
+// RSA напрямую шифрует только блоки меньше размера ключа, поэтому тело шифруется
+// случайным ключом AES-GCM, а RSA шифруется только этот ключ.
+// Формат сообщения: [2 байта длина ключа][зашифрованный ключ][nonce][шифртекст]
+
+// Encrypt - шифрует данные открытым ключом
+func Encrypt(pub *rsa.PublicKey, data []byte) ([]byte, error) {
+	sessionKey := make([]byte, 32)
+	if _, err := rand.Read(sessionKey); err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, sessionKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt session key: %w", err)
+	}
+
+	gcm, err := newGCM(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, 2, 2+len(encryptedKey)+len(nonce)+len(data)+gcm.Overhead())
+	binary.BigEndian.PutUint16(msg, uint16(len(encryptedKey)))
+	msg = append(msg, encryptedKey...)
+	msg = append(msg, nonce...)
+	return gcm.Seal(msg, nonce, data, nil), nil
+}
+
+// Decrypt - расшифровывает сообщение закрытым ключом
+func Decrypt(priv *rsa.PrivateKey, msg []byte) ([]byte, error) {
+	if len(msg) < 2 {
+		return nil, ErrInvalidMessage
+	}
+	keyLen := int(binary.BigEndian.Uint16(msg))
+	msg = msg[2:]
+	if len(msg) < keyLen {
+		return nil, ErrInvalidMessage
+	}
+
+	sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, msg[:keyLen], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	msg = msg[keyLen:]
+
+	gcm, err := newGCM(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) < gcm.NonceSize() {
+		return nil, ErrInvalidMessage
+	}
+
+	data, err := gcm.Open(nil, msg[:gcm.NonceSize()], msg[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	return data, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// GenerateKeys - новая пара ключей RSA в PEM: закрытый в PKCS#1, открытый в PKIX
+func GenerateKeys(bits int) (privatePEM, publicPEM []byte, err error) {
+	priv, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privatePEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	publicPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	return privatePEM, publicPEM, nil
+}
+
+// LoadPublicKey - читает открытый ключ RSA из PEM файла
+func LoadPublicKey(path string) (*rsa.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA public key", path)
+	}
+	return pub, nil
+}
+
+// LoadPrivateKey - читает закрытый ключ RSA из PEM файла в PKCS#1 или PKCS#8
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA private key", path)
+	}
+	return priv, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
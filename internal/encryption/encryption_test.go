@@ -0,0 +1,66 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	privatePEM, publicPEM, err := GenerateKeys(2048)
+	if err != nil {
+		t.Fatalf("GenerateKeys() error = %v", err)
+	}
+
+	dir := t.TempDir()
+	privatePath := filepath.Join(dir, "private.pem")
+	publicPath := filepath.Join(dir, "public.pem")
+	os.WriteFile(privatePath, privatePEM, 0600)
+	os.WriteFile(publicPath, publicPEM, 0644)
+
+	priv, err := LoadPrivateKey(privatePath)
+	if err != nil {
+		t.Fatalf("LoadPrivateKey() error = %v", err)
+	}
+	pub, err := LoadPublicKey(publicPath)
+	if err != nil {
+		t.Fatalf("LoadPublicKey() error = %v", err)
+	}
+
+	// Тело больше размера ключа RSA, напрямую RSA его бы не зашифровал
+	data := bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":1}`), 100)
+
+	msg, err := Encrypt(pub, data)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if bytes.Contains(msg, []byte("Alloc")) {
+		t.Error("Зашифрованное сообщение содержит открытый текст")
+	}
+
+	t.Run("Успешная_расшифровка", func(t *testing.T) {
+		got, err := Decrypt(priv, msg)
+		if err != nil {
+			t.Fatalf("Decrypt() error = %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Error("Расшифрованные данные не совпадают с исходными")
+		}
+	})
+
+	t.Run("Измененное_сообщение", func(t *testing.T) {
+		broken := bytes.Clone(msg)
+		broken[len(broken)-1] ^= 0xff
+		if _, err := Decrypt(priv, broken); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("Decrypt() error = %v, want ErrInvalidMessage", err)
+		}
+	})
+
+	t.Run("Обрезанное_сообщение", func(t *testing.T) {
+		if _, err := Decrypt(priv, msg[:10]); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("Decrypt() error = %v, want ErrInvalidMessage", err)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package grpctransport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"yupi/internal/domain/metrics"
+	"yupi/internal/grpctransport/interceptors"
+	"yupi/internal/netutil"
+	pb "yupi/internal/proto"
+	"yupi/internal/retry"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// streamChunk - сколько метрик отправляется в одном сообщении потока
+const streamChunk = 100
+
+// Client - отправка метрик агента по gRPC
+type Client struct {
+	conn   *grpc.ClientConn
+	client pb.MetricsClient
+}
+
+// NewClient - клиент gRPC сервиса метрик. key подписывает запросы, tlsConfig == nil
+// означает соединение без шифрования
+func NewClient(addr, key string, tlsConfig *tls.Config) (*Client, error) {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	// Адрес агента для проверки доверенной подсети на сервере, при ошибке x-real-ip не передается
+	ip, _ := netutil.OutboundIP(addr)
+
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithChainUnaryInterceptor(
+			interceptors.RealIPUnaryClientInterceptor(ip),
+			interceptors.HashUnaryClientInterceptor(key),
+		),
+		grpc.WithChainStreamInterceptor(
+			interceptors.RealIPStreamClientInterceptor(ip),
+			interceptors.HashStreamClientInterceptor(key),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+
+	return &Client{conn: conn, client: pb.NewMetricsClient(conn)}, nil
+}
+
+// SendMetrics - отправляет пакет метрик потоком UpdateMetrics, сервер применяет его целиком после закрытия потока
+func (c *Client) SendMetrics(ctx context.Context, batch []metrics.Metrics) error {
+	stream, err := c.client.UpdateMetrics(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open stream: %w", classify(err))
+	}
+
+	for start := 0; start < len(batch); start += streamChunk {
+		end := min(start+streamChunk, len(batch))
+
+		req := &pb.UpdateMetricsRequest{Metrics: make([]*pb.Metric, 0, end-start)}
+		for _, m := range batch[start:end] {
+			req.Metrics = append(req.Metrics, ToProto(m))
+		}
+
+		if err := stream.Send(req); err != nil {
+			// Причину ошибки сервер отдает в статусе, который приходит при закрытии потока
+			if _, closeErr := stream.CloseAndRecv(); closeErr != nil {
+				return fmt.Errorf("failed to send metrics: %w", classify(closeErr))
+			}
+			return fmt.Errorf("failed to send metrics: %w", classify(err))
+		}
+	}
+
+	if _, err := stream.CloseAndRecv(); err != nil {
+		return fmt.Errorf("failed to send metrics: %w", classify(err))
+	}
+	return nil
+}
+
+// classify - помечает как повторяемые ошибки недоступности и перегрузки сервера
+func classify(err error) error {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return retry.Temporary(err)
+	}
+	return err
+}
+
+// Metrics - клиент сервиса для остальных вызовов
+func (c *Client) Metrics() pb.MetricsClient {
+	return c.client
+}
+
+// Close - закрывает соединение
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
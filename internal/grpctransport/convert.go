@@ -0,0 +1,57 @@
+package grpctransport
+
+import (
+	"yupi/internal/domain/metrics"
+	pb "yupi/internal/proto"
+)
+
+func typeToProto(mType string) pb.MType {
+	switch mType {
+	case metrics.TypeGauge:
+		return pb.MType_GAUGE
+	case metrics.TypeCounter:
+		return pb.MType_COUNTER
+	}
+	return pb.MType_MTYPE_UNSPECIFIED
+}
+
+func typeFromProto(mType pb.MType) string {
+	switch mType {
+	case pb.MType_GAUGE:
+		return metrics.TypeGauge
+	case pb.MType_COUNTER:
+		return metrics.TypeCounter
+	}
+	return ""
+}
+
+// ToProto - метрика в сообщение gRPC
+func ToProto(m metrics.Metrics) *pb.Metric {
+	msg := &pb.Metric{Id: m.ID, Type: typeToProto(m.MType), Labels: m.Labels}
+	if m.Value != nil {
+		msg.Value = *m.Value
+	}
+	if m.Delta != nil {
+		msg.Delta = *m.Delta
+	}
+	return msg
+}
+
+// FromProto - сообщение gRPC в метрику. В proto3 у скалярных полей нет признака
+// наличия, поэтому значение берется из поля, соответствующего типу
+func FromProto(msg *pb.Metric) metrics.Metrics {
+	m := metrics.Metrics{ID: msg.GetId(), MType: typeFromProto(msg.GetType())}
+	if len(msg.GetLabels()) > 0 {
+		m.Labels = metrics.Labels(msg.GetLabels())
+	}
+
+	switch m.MType {
+	case metrics.TypeGauge:
+		value := msg.GetValue()
+		m.Value = &value
+	case metrics.TypeCounter:
+		delta := msg.GetDelta()
+		m.Delta = &delta
+	}
+	return m
+}
@@ -0,0 +1,210 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"yupi/internal/signature"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// hashMetadata - ключ метаданных с подписью, в gRPC ключи метаданных в нижнем регистре
+const hashMetadata = "hashsha256"
+
+// hashField - поле сообщения потока с его подписью. Метаданные передаются один раз
+// на весь поток, поэтому каждое сообщение потока несет подпись в себе
+const hashField = protoreflect.Name("hash")
+
+var errNoHashField = errors.New("stream message has no hash field")
+
+// signedBytes - данные сообщения для подписи: сообщение с пустым полем hash. Маршалинг
+// детерминированный, иначе порядок ключей map у клиента и сервера может отличаться
+func signedBytes(m any) ([]byte, error) {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return nil, errors.New("not a protobuf message")
+	}
+
+	if fd := msg.ProtoReflect().Descriptor().Fields().ByName(hashField); fd != nil {
+		msg = proto.Clone(msg)
+		msg.ProtoReflect().Clear(fd)
+	}
+
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+// messageSignature - подпись сообщения общим ключом
+func messageSignature(key string, m any) (string, error) {
+	data, err := signedBytes(m)
+	if err != nil {
+		return "", err
+	}
+	return signature.Sign(key, data), nil
+}
+
+// validMessage - совпадает ли подпись с сообщением
+func validMessage(key string, m any, sign string) bool {
+	data, err := signedBytes(m)
+	return err == nil && signature.Valid(key, data, sign)
+}
+
+func messageHash(m any) (protoreflect.Message, protoreflect.FieldDescriptor, error) {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return nil, nil, errNoHashField
+	}
+	fd := msg.ProtoReflect().Descriptor().Fields().ByName(hashField)
+	if fd == nil || fd.Kind() != protoreflect.StringKind {
+		return nil, nil, errNoHashField
+	}
+	return msg.ProtoReflect(), fd, nil
+}
+
+// HashUnaryInterceptor - проверяет подпись запроса из метаданных и подписывает ответ.
+// С ключом каждый вызов обязан быть подписан
+func HashUnaryInterceptor(key string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if key == "" {
+			return handler(ctx, req)
+		}
+
+		var sign string
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(hashMetadata)) > 0 {
+			sign = md.Get(hashMetadata)[0]
+		}
+
+		if !validMessage(key, req, sign) {
+			return nil, status.Error(codes.InvalidArgument, "invalid signature")
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+
+		if respSign, err := messageSignature(key, resp); err == nil {
+			grpc.SetHeader(ctx, metadata.Pairs(hashMetadata, respSign)) //nolint:errcheck
+		}
+		return resp, nil
+	}
+}
+
+// HashStreamInterceptor - проверяет подпись каждого сообщения потока в поле hash
+// и подписывает ответ в заголовке
+func HashStreamInterceptor(key string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if key == "" {
+			return handler(srv, ss)
+		}
+		return handler(srv, &signedServerStream{ServerStream: ss, key: key})
+	}
+}
+
+type signedServerStream struct {
+	grpc.ServerStream
+	key string
+}
+
+func (s *signedServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	msg, fd, err := messageHash(m)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if !validMessage(s.key, m, msg.Get(fd).String()) {
+		return status.Error(codes.InvalidArgument, "invalid signature")
+	}
+	return nil
+}
+
+func (s *signedServerStream) SendMsg(m any) error {
+	if sign, err := messageSignature(s.key, m); err == nil {
+		s.SetHeader(metadata.Pairs(hashMetadata, sign)) //nolint:errcheck
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// HashUnaryClientInterceptor - подписывает запрос и проверяет подпись ответа, если сервер ее прислал
+func HashUnaryClientInterceptor(key string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if key == "" {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		sign, err := messageSignature(key, req)
+		if err != nil {
+			return err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, hashMetadata, sign)
+
+		var header metadata.MD
+		if err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Header(&header))...); err != nil {
+			return err
+		}
+		return verifyReply(key, header, reply)
+	}
+}
+
+// HashStreamClientInterceptor - подписывает каждое сообщение потока в поле hash
+func HashStreamClientInterceptor(key string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil || key == "" {
+			return cs, err
+		}
+		return &signedClientStream{ClientStream: cs, key: key}, nil
+	}
+}
+
+type signedClientStream struct {
+	grpc.ClientStream
+	key string
+}
+
+func (s *signedClientStream) SendMsg(m any) error {
+	msg, fd, err := messageHash(m)
+	if err != nil {
+		return err
+	}
+
+	sign, err := messageSignature(s.key, m)
+	if err != nil {
+		return err
+	}
+	msg.Set(fd, protoreflect.ValueOfString(sign))
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *signedClientStream) RecvMsg(m any) error {
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	header, err := s.Header()
+	if err != nil {
+		return err
+	}
+	return verifyReply(s.key, header, m)
+}
+
+// verifyReply - проверяет подпись ответа, ответ без подписи принимается, как и в HTTP агенте
+func verifyReply(key string, header metadata.MD, reply any) error {
+	signs := header.Get(hashMetadata)
+	if len(signs) == 0 {
+		return nil
+	}
+
+	if !validMessage(key, reply, signs[0]) {
+		return errors.New("invalid response signature")
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package interceptors
+
+import (
+	"context"
+	"time"
+	"yupi/internal/httptransport/middlewares"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// LoggingUnaryInterceptor - логирует входящие unary вызовы, как LoggingRequestMiddleware для HTTP
+func LoggingUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(info.FullMethod, start, err)
+	return resp, err
+}
+
+// LoggingStreamInterceptor - логирует входящие потоковые вызовы
+func LoggingStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logCall(info.FullMethod, start, err)
+	return err
+}
+
+func logCall(method string, start time.Time, err error) {
+	middlewares.Log.Info("got incoming gRPC request",
+		zap.String("method", method),
+		zap.Duration("duration", time.Since(start).Round(time.Millisecond)),
+		zap.String("code", status.Code(err).String()),
+	)
+}
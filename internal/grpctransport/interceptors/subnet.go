@@ -0,0 +1,76 @@
+package interceptors
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"yupi/internal/httptransport/middlewares"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// realIPMetadata - адрес агента, аналог заголовка X-Real-IP
+const realIPMetadata = "x-real-ip"
+
+// trustedPeer - входят ли адрес из x-real-ip и адрес соединения в доверенные подсети
+func trustedPeer(ctx context.Context, subnets []*net.IPNet) bool {
+	var realIP net.IP
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(realIPMetadata)) > 0 {
+		realIP = net.ParseIP(strings.TrimSpace(md.Get(realIPMetadata)[0]))
+	}
+
+	var connIP net.IP
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			connIP = net.ParseIP(host)
+		}
+	}
+
+	return middlewares.InSubnets(subnets, realIP) && middlewares.InSubnets(subnets, connIP)
+}
+
+// TrustedSubnetUnaryInterceptor - пропускает вызовы методов methods только из доверенных подсетей,
+// как TrustedSubnetMiddleware для HTTP. Пустой список подсетей отключает проверку
+func TrustedSubnetUnaryInterceptor(subnets []*net.IPNet, methods ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if len(subnets) > 0 && slices.Contains(methods, info.FullMethod) && !trustedPeer(ctx, subnets) {
+			return nil, status.Error(codes.PermissionDenied, "forbidden")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// TrustedSubnetStreamInterceptor - то же для потоковых методов
+func TrustedSubnetStreamInterceptor(subnets []*net.IPNet, methods ...string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if len(subnets) > 0 && slices.Contains(methods, info.FullMethod) && !trustedPeer(ss.Context(), subnets) {
+			return status.Error(codes.PermissionDenied, "forbidden")
+		}
+		return handler(srv, ss)
+	}
+}
+
+// RealIPUnaryClientInterceptor - передает адрес агента в x-real-ip
+func RealIPUnaryClientInterceptor(ip net.IP) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if ip != nil {
+			ctx = metadata.AppendToOutgoingContext(ctx, realIPMetadata, ip.String())
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// RealIPStreamClientInterceptor - передает адрес агента в x-real-ip для потоковых вызовов
+func RealIPStreamClientInterceptor(ip net.IP) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if ip != nil {
+			ctx = metadata.AppendToOutgoingContext(ctx, realIPMetadata, ip.String())
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,184 @@
+package grpctransport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"yupi/internal/domain/metrics"
+	"yupi/internal/grpctransport/interceptors"
+	pb "yupi/internal/proto"
+	"yupi/internal/repository"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsServer - gRPC сервис метрик поверх того же хранилища, что и handlers.MetricServer
+type MetricsServer struct {
+	pb.UnimplementedMetricsServer
+	storage repository.Storage
+}
+
+// NewMetricsServer - конструктор gRPC сервиса метрик
+func NewMetricsServer(storage repository.Storage) *MetricsServer {
+	return &MetricsServer{storage: storage}
+}
+
+// UpdateMetric - обновление одной метрики
+func (s *MetricsServer) UpdateMetric(ctx context.Context, req *pb.UpdateMetricRequest) (*pb.UpdateMetricResponse, error) {
+	if req.GetMetric() == nil {
+		return nil, status.Error(codes.InvalidArgument, "metric is required")
+	}
+
+	m := FromProto(req.GetMetric())
+	if err := m.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var err error
+	switch m.MType {
+	case metrics.TypeGauge:
+		err = s.storage.UpdateGauge(ctx, m.Key(), *m.Value)
+	case metrics.TypeCounter:
+		err = s.storage.UpdateCounter(ctx, m.Key(), *m.Delta)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+
+	return &pb.UpdateMetricResponse{Metric: ToProto(m)}, nil
+}
+
+// UpdateMetrics - потоковое обновление, все сообщения потока применяются одним пакетом после его закрытия.
+// Оборванный поток не меняет хранилище, поэтому повторная отправка пакета не удваивает счетчики
+func (s *MetricsServer) UpdateMetrics(stream pb.Metrics_UpdateMetricsServer) error {
+	var batch []metrics.Metrics
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// Сначала проверяем все метрики, чтобы не применить пакет частично
+		for _, msg := range req.GetMetrics() {
+			m := FromProto(msg)
+			if err := m.Validate(); err != nil {
+				return status.Errorf(codes.InvalidArgument, "metric %d (%s): %v", len(batch), m.ID, err)
+			}
+			batch = append(batch, m)
+		}
+	}
+
+	if err := s.storage.UpdateBatch(stream.Context(), batch); err != nil {
+		return status.Error(codes.Internal, "internal server error")
+	}
+	return stream.SendAndClose(&pb.UpdateMetricsResponse{Updated: int64(len(batch))})
+}
+
+// GetMetric - текущее значение одного временного ряда
+func (s *MetricsServer) GetMetric(ctx context.Context, req *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
+	m := metrics.Metrics{ID: req.GetId(), MType: typeFromProto(req.GetType())}
+	if len(req.GetLabels()) > 0 {
+		m.Labels = metrics.Labels(req.GetLabels())
+	}
+	if err := m.Labels.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var found bool
+	var err error
+	switch m.MType {
+	case metrics.TypeGauge:
+		var value float64
+		value, found, err = s.storage.GetGauge(ctx, m.Key())
+		m.Value = &value
+	case metrics.TypeCounter:
+		var delta int64
+		delta, found, err = s.storage.GetCounter(ctx, m.Key())
+		m.Delta = &delta
+	default:
+		return nil, status.Error(codes.InvalidArgument, metrics.ErrInvalidType.Error())
+	}
+
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+	if !found {
+		return nil, status.Error(codes.NotFound, "metric not found")
+	}
+
+	return &pb.GetMetricResponse{Metric: ToProto(m)}, nil
+}
+
+// ListMetrics - текущие значения всех временных рядов, сначала gauge, затем counter, по ключу
+func (s *MetricsServer) ListMetrics(ctx context.Context, _ *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+	gauges, err := s.storage.GetAllGauges(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+	counters, err := s.storage.GetAllCounters(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal server error")
+	}
+
+	resp := &pb.ListMetricsResponse{Metrics: make([]*pb.Metric, 0, len(gauges)+len(counters))}
+	for _, key := range sortedKeys(gauges) {
+		name, labels, err := metrics.ParseSeriesKey(key)
+		if err != nil {
+			continue
+		}
+		resp.Metrics = append(resp.Metrics, &pb.Metric{Id: name, Type: pb.MType_GAUGE, Value: gauges[key], Labels: labels})
+	}
+	for _, key := range sortedKeys(counters) {
+		name, labels, err := metrics.ParseSeriesKey(key)
+		if err != nil {
+			continue
+		}
+		resp.Metrics = append(resp.Metrics, &pb.Metric{Id: name, Type: pb.MType_COUNTER, Delta: counters[key], Labels: labels})
+	}
+
+	return resp, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// NewServer - gRPC сервер с сервисом метрик и теми же проверками, что и у HTTP API:
+// логирование, подпись ключом key и доверенные подсети для методов записи
+func NewServer(storage repository.Storage, key string, subnets []*net.IPNet, tlsConfig *tls.Config) *grpc.Server {
+	writeMethods := []string{pb.Metrics_UpdateMetric_FullMethodName, pb.Metrics_UpdateMetrics_FullMethodName}
+
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			interceptors.LoggingUnaryInterceptor,
+			interceptors.TrustedSubnetUnaryInterceptor(subnets, writeMethods...),
+			interceptors.HashUnaryInterceptor(key),
+		),
+		grpc.ChainStreamInterceptor(
+			interceptors.LoggingStreamInterceptor,
+			interceptors.TrustedSubnetStreamInterceptor(subnets, writeMethods...),
+			interceptors.HashStreamInterceptor(key),
+		),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	srv := grpc.NewServer(opts...)
+	pb.RegisterMetricsServer(srv, NewMetricsServer(storage))
+	return srv
+}
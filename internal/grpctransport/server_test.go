@@ -0,0 +1,220 @@
+package grpctransport
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+	"yupi/internal/domain/metrics"
+	"yupi/internal/httptransport/middlewares"
+	pb "yupi/internal/proto"
+	"yupi/internal/repository"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// startServer - gRPC сервер на свободном локальном порту
+func startServer(t *testing.T, storage repository.Storage, key, subnets string) string {
+	trusted, err := middlewares.ParseSubnets(subnets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := NewServer(storage, key, trusted, nil)
+	go srv.Serve(listener) //nolint:errcheck
+	t.Cleanup(srv.Stop)
+
+	return listener.Addr().String()
+}
+
+func newClient(t *testing.T, addr, key string) *Client {
+	client, err := NewClient(addr, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestMetricsServer(t *testing.T) {
+	ctx := context.Background()
+	storage := repository.NewMemStorage()
+	addr := startServer(t, storage, "secret", "")
+	client := newClient(t, addr, "secret")
+
+	value := 1.5
+	delta := int64(3)
+	batch := []metrics.Metrics{
+		{ID: "Alloc", MType: metrics.TypeGauge, Value: &value, Labels: metrics.Labels{"host": "h1"}},
+		{ID: "PollCount", MType: metrics.TypeCounter, Delta: &delta},
+	}
+	// Больше одного сообщения потока
+	for i := 0; i < streamChunk; i++ {
+		batch = append(batch, metrics.Metrics{ID: "PollCount", MType: metrics.TypeCounter, Delta: &delta})
+	}
+
+	t.Run("Успешная_отправка_потоком", func(t *testing.T) {
+		if err := client.SendMetrics(ctx, batch); err != nil {
+			t.Fatalf("SendMetrics() error = %v", err)
+		}
+
+		got, _, _ := storage.GetCounter(ctx, "PollCount")
+		if want := delta * int64(streamChunk+1); got != want {
+			t.Errorf("PollCount = %d, want %d", got, want)
+		}
+	})
+
+	t.Run("Успешное_обновление_одной_метрики", func(t *testing.T) {
+		resp, err := client.Metrics().UpdateMetric(ctx, &pb.UpdateMetricRequest{
+			Metric: &pb.Metric{Id: "Load", Type: pb.MType_GAUGE, Value: 0.5},
+		})
+		if err != nil {
+			t.Fatalf("UpdateMetric() error = %v", err)
+		}
+		if resp.GetMetric().GetValue() != 0.5 {
+			t.Errorf("UpdateMetric() value = %v, want 0.5", resp.GetMetric().GetValue())
+		}
+	})
+
+	t.Run("Успешное_получение_по_меткам", func(t *testing.T) {
+		resp, err := client.Metrics().GetMetric(ctx, &pb.GetMetricRequest{
+			Id: "Alloc", Type: pb.MType_GAUGE, Labels: map[string]string{"host": "h1"},
+		})
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+		if resp.GetMetric().GetValue() != value {
+			t.Errorf("GetMetric() value = %v, want %v", resp.GetMetric().GetValue(), value)
+		}
+	})
+
+	t.Run("Метрика_не_найдена", func(t *testing.T) {
+		_, err := client.Metrics().GetMetric(ctx, &pb.GetMetricRequest{Id: "Alloc", Type: pb.MType_GAUGE})
+		if status.Code(err) != codes.NotFound {
+			t.Errorf("GetMetric() code = %v, want NotFound", status.Code(err))
+		}
+	})
+
+	t.Run("Список_метрик", func(t *testing.T) {
+		resp, err := client.Metrics().ListMetrics(ctx, &pb.ListMetricsRequest{})
+		if err != nil {
+			t.Fatalf("ListMetrics() error = %v", err)
+		}
+
+		var ids []string
+		for _, m := range resp.GetMetrics() {
+			ids = append(ids, m.GetType().String()+":"+m.GetId())
+		}
+		want := []string{"GAUGE:Alloc", "GAUGE:Load", "COUNTER:PollCount"}
+		if len(ids) != len(want) {
+			t.Fatalf("ListMetrics() = %v, want %v", ids, want)
+		}
+		for i := range want {
+			if ids[i] != want[i] {
+				t.Errorf("ListMetrics()[%d] = %s, want %s", i, ids[i], want[i])
+			}
+		}
+	})
+
+	t.Run("Оборванный_поток_не_применяется", func(t *testing.T) {
+		before, _, _ := storage.GetCounter(ctx, "PollCount")
+
+		streamCtx, cancel := context.WithCancel(ctx)
+		stream, err := client.Metrics().UpdateMetrics(streamCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = stream.Send(&pb.UpdateMetricsRequest{Metrics: []*pb.Metric{{Id: "PollCount", Type: pb.MType_COUNTER, Delta: delta}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Даем серверу принять сообщение и обрываем поток, не закрывая его
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+
+		// Повторная отправка того же пакета учитывается один раз
+		if err := client.SendMetrics(ctx, batch[1:2]); err != nil {
+			t.Fatalf("SendMetrics() error = %v", err)
+		}
+		if after, _, _ := storage.GetCounter(ctx, "PollCount"); after != before+delta {
+			t.Errorf("PollCount = %d, want %d", after, before+delta)
+		}
+	})
+
+	t.Run("Пакет_с_неверной_метрикой_не_применяется", func(t *testing.T) {
+		before, _, _ := storage.GetCounter(ctx, "PollCount")
+		err := client.SendMetrics(ctx, []metrics.Metrics{
+			{ID: "PollCount", MType: metrics.TypeCounter, Delta: &delta},
+			{ID: "", MType: metrics.TypeGauge, Value: &value},
+		})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("SendMetrics() code = %v, want InvalidArgument", status.Code(err))
+		}
+		if after, _, _ := storage.GetCounter(ctx, "PollCount"); after != before {
+			t.Errorf("PollCount изменился с %d на %d", before, after)
+		}
+	})
+}
+
+func TestMetricsServer_Signature(t *testing.T) {
+	ctx := context.Background()
+	addr := startServer(t, repository.NewMemStorage(), "secret", "")
+
+	value := 1.0
+	batch := []metrics.Metrics{{ID: "Alloc", MType: metrics.TypeGauge, Value: &value}}
+
+	tests := []struct {
+		name     string
+		key      string
+		wantCode codes.Code
+	}{
+		{"Успешная_проверка_подписи", "secret", codes.OK},
+		{"Неверный_ключ", "other", codes.InvalidArgument},
+		{"Без_подписи", "", codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClient(t, addr, tt.key)
+
+			if err := client.SendMetrics(ctx, batch); status.Code(err) != tt.wantCode {
+				t.Errorf("SendMetrics() code = %v, want %v", status.Code(err), tt.wantCode)
+			}
+			_, err := client.Metrics().ListMetrics(ctx, &pb.ListMetricsRequest{})
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("ListMetrics() code = %v, want %v", status.Code(err), tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestMetricsServer_TrustedSubnet(t *testing.T) {
+	ctx := context.Background()
+	value := 1.0
+	batch := []metrics.Metrics{{ID: "Alloc", MType: metrics.TypeGauge, Value: &value}}
+
+	t.Run("Запись_из_доверенной_сети", func(t *testing.T) {
+		client := newClient(t, startServer(t, repository.NewMemStorage(), "", "127.0.0.0/8"), "")
+		if err := client.SendMetrics(ctx, batch); err != nil {
+			t.Errorf("SendMetrics() error = %v", err)
+		}
+	})
+
+	t.Run("Запись_из_недоверенной_сети", func(t *testing.T) {
+		client := newClient(t, startServer(t, repository.NewMemStorage(), "", "10.0.0.0/8"), "")
+		if err := client.SendMetrics(ctx, batch); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("SendMetrics() code = %v, want PermissionDenied", status.Code(err))
+		}
+
+		// Чтение доверенной сетью не ограничено
+		if _, err := client.Metrics().ListMetrics(ctx, &pb.ListMetricsRequest{}); err != nil {
+			t.Errorf("ListMetrics() error = %v", err)
+		}
+	})
+}
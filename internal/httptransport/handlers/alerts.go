@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"yupi/internal/service/alerting"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AlertsServer - обработчик запросов оповещений
+type AlertsServer struct {
+	engine *alerting.Engine
+}
+
+// NewAlertsServer - конструктор обработчика оповещений
+func NewAlertsServer(engine *alerting.Engine) *AlertsServer {
+	return &AlertsServer{engine: engine}
+}
+
+// ListHandler - текущие оповещения: GET /alerts?state=<pending|firing|resolved>
+func (s *AlertsServer) ListHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	state := alerting.State(r.URL.Query().Get("state"))
+	switch state {
+	case "", alerting.StatePending, alerting.StateFiring, alerting.StateResolved:
+	default:
+		http.Error(w, `{"error":"invalid state"}`, http.StatusBadRequest)
+		return
+	}
+
+	alerts := make([]alerting.Alert, 0)
+	for _, alert := range s.engine.Alerts() {
+		if state == "" || alert.State == state {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	respondJSON(w, alerts)
+}
+
+// ackRequest - кто подтверждает оповещение и почему
+type ackRequest struct {
+	By      string `json:"by"`
+	Comment string `json:"comment"`
+}
+
+// AckHandler - подтверждает сработавшее оповещение: POST /alerts/{id}/ack
+func (s *AlertsServer) AckHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req ackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+
+	alert, err := s.engine.Acknowledge(chi.URLParam(r, "id"), req.By, req.Comment)
+	switch {
+	case errors.Is(err, alerting.ErrAlertNotFound):
+		http.Error(w, `{"error":"alert not found"}`, http.StatusNotFound)
+		return
+	case errors.Is(err, alerting.ErrAlertNotFiring):
+		http.Error(w, `{"error":"alert is not firing"}`, http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, alert)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yupi/internal/repository"
+	"yupi/internal/service/alerting"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestAlertsServer_ListHandler(t *testing.T) {
+	ctx := context.Background()
+	storage := repository.NewMemStorage()
+	storage.UpdateGauge(ctx, `HeapAlloc{host="web-1"}`, 2048) //nolint:errcheck
+	storage.UpdateGauge(ctx, `HeapAlloc{host="web-2"}`, 4096) //nolint:errcheck
+
+	rules, err := alerting.ParseRules([]byte(`{"rules":[
+		{"name":"HighHeap","expr":"HeapAlloc > 1KB"},
+		{"name":"VeryHighHeap","expr":"HeapAlloc > 3KB","for":"1h"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := alerting.NewEngine(storage, nil, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	server := NewAlertsServer(engine)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantCount  int
+	}{
+		{name: "Все_оповещения", query: "", wantStatus: http.StatusOK, wantCount: 3},
+		{name: "Только_сработавшие", query: "?state=firing", wantStatus: http.StatusOK, wantCount: 2},
+		{name: "Только_ожидающие", query: "?state=pending", wantStatus: http.StatusOK, wantCount: 1},
+		{name: "Нет_разрешенных", query: "?state=resolved", wantStatus: http.StatusOK, wantCount: 0},
+		{name: "Неизвестное_состояние", query: "?state=silenced", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.ListHandler(w, httptest.NewRequest(http.MethodGet, "/alerts"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("ListHandler() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var alerts []alerting.Alert
+			if err := json.Unmarshal(w.Body.Bytes(), &alerts); err != nil {
+				t.Fatalf("Не удалось разобрать ответ: %v", err)
+			}
+			if len(alerts) != tt.wantCount {
+				t.Errorf("ListHandler() вернул %d оповещений, want %d: %s", len(alerts), tt.wantCount, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAlertsServer_ListHandler_NonFinite(t *testing.T) {
+	ctx := context.Background()
+	storage := repository.NewMemStorage()
+	storage.UpdateGauge(ctx, "Load", math.Inf(1)) //nolint:errcheck
+	storage.UpdateGauge(ctx, "Ratio", math.NaN()) //nolint:errcheck
+
+	rules, err := alerting.ParseRules([]byte(`{"rules":[
+		{"name":"HighLoad","expr":"Load > 1"},
+		{"name":"BadRatio","expr":"Ratio != 0"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := alerting.NewEngine(storage, nil, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	NewAlertsServer(engine).ListHandler(w, httptest.NewRequest(http.MethodGet, "/alerts", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("ListHandler() status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var alerts []struct {
+		Rule  string `json:"rule"`
+		Value any    `json:"value"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &alerts); err != nil {
+		t.Fatalf("Не удалось разобрать ответ: %v: %s", err, w.Body.String())
+	}
+	want := map[string]any{"HighLoad": "+Inf", "BadRatio": "NaN"}
+	if len(alerts) != len(want) {
+		t.Fatalf("ListHandler() вернул %d оповещений, want %d: %s", len(alerts), len(want), w.Body.String())
+	}
+	for _, alert := range alerts {
+		if alert.Value != want[alert.Rule] {
+			t.Errorf("Значение %s = %v, want %v", alert.Rule, alert.Value, want[alert.Rule])
+		}
+	}
+}
+
+func TestAlertsServer_AckHandler(t *testing.T) {
+	ctx := context.Background()
+	storage := repository.NewMemStorage()
+	storage.UpdateGauge(ctx, "HeapAlloc", 2048) //nolint:errcheck
+
+	rules, err := alerting.ParseRules([]byte(`{"rules":[
+		{"name":"HighHeap","expr":"HeapAlloc > 1KB"},
+		{"name":"SlowHeap","expr":"HeapAlloc > 1KB","for":"1h"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := alerting.NewEngine(storage, nil, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Evaluate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.Post("/alerts/{id}/ack", NewAlertsServer(engine).AckHandler)
+
+	alerts := engine.Alerts()
+	tests := []struct {
+		name       string
+		id         string
+		body       string
+		wantStatus int
+	}{
+		{name: "Успешное_подтверждение", id: alerts[0].ID, body: `{"by":"oncall","comment":"смотрю"}`, wantStatus: http.StatusOK},
+		{name: "Ожидающее_оповещение", id: alerts[1].ID, body: `{"by":"oncall"}`, wantStatus: http.StatusConflict},
+		{name: "Неизвестное_оповещение", id: "unknown", body: `{"by":"oncall"}`, wantStatus: http.StatusNotFound},
+		{name: "Неверный_JSON", id: alerts[0].ID, body: `{"by":`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/alerts/"+tt.id+"/ack", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("AckHandler() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var alert alerting.Alert
+			if err := json.Unmarshal(w.Body.Bytes(), &alert); err != nil {
+				t.Fatalf("Не удалось разобрать ответ: %v", err)
+			}
+			if alert.Ack == nil || alert.Ack.By != "oncall" {
+				t.Errorf("AckHandler() = %s, want подтверждение от oncall", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"yupi/internal/domain/metrics"
+	"yupi/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// HistoryServer - обработчик запросов истории значений метрик
+type HistoryServer struct {
+	history *repository.History
+}
+
+// NewHistoryServer - конструктор обработчика истории
+func NewHistoryServer(history *repository.History) *HistoryServer {
+	return &HistoryServer{history: history}
+}
+
+// HistoryResponse - точки одного временного ряда
+type HistoryResponse struct {
+	ID      string              `json:"id"`
+	MType   string              `json:"type"`
+	Labels  metrics.Labels      `json:"labels,omitempty"`
+	Samples []repository.Sample `json:"samples"`
+}
+
+// RangeHandler - точки ряда между from и to:
+// GET /history/<ТИП_МЕТРИКИ>/<ИМЯ_МЕТРИКИ>?from=<ВРЕМЯ>&to=<ВРЕМЯ>&<МЕТКА>=<ЗНАЧЕНИЕ>
+// Время задается в RFC3339 или в секундах unix, по умолчанию отдается вся сохраненная история
+func (s *HistoryServer) RangeHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	metricType := chi.URLParam(r, "type")
+	metricName := chi.URLParam(r, "name")
+
+	if metricType != metrics.TypeGauge && metricType != metrics.TypeCounter {
+		http.Error(w, `{"error":"Invalid metric type"}`, http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(metricName) == "" || strings.ContainsAny(metricName, "{}") {
+		http.Error(w, `{"error":"Метрика не найдена"}`, http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	from, err := parseTime(query.Get("from"), time.Time{})
+	if err != nil {
+		http.Error(w, `{"error":"invalid from"}`, http.StatusBadRequest)
+		return
+	}
+	to, err := parseTime(query.Get("to"), time.Now())
+	if err != nil {
+		http.Error(w, `{"error":"invalid to"}`, http.StatusBadRequest)
+		return
+	}
+	if to.Before(from) {
+		http.Error(w, `{"error":"to must not be before from"}`, http.StatusBadRequest)
+		return
+	}
+
+	labels, err := labelsFromQuery(r, "from", "to")
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	respondJSON(w, HistoryResponse{
+		ID:      metricName,
+		MType:   metricType,
+		Labels:  labels,
+		Samples: s.history.Range(metricType, metrics.SeriesKey(metricName, labels), from, to),
+	})
+}
+
+// parseTime - разбирает время в RFC3339 или в секундах unix, пустая строка дает def
+func parseTime(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
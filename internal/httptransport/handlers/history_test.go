@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"yupi/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestHistoryServer_RangeHandler(t *testing.T) {
+	history := repository.NewHistory(time.Hour, 0)
+	storage := repository.WithHistory(repository.NewMemStorage(), history)
+	storage.UpdateGauge(context.Background(), "Alloc", 1)
+	storage.UpdateGauge(context.Background(), "Alloc", 2)
+	storage.UpdateGauge(context.Background(), `Alloc{host="h1"}`, 10)
+
+	r := chi.NewRouter()
+	r.Get("/history/{type}/{name}", NewHistoryServer(history).RangeHandler)
+
+	future := strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+	later := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantValues []float64
+	}{
+		{"Успешное_получение_истории", "/history/gauge/Alloc", http.StatusOK, []float64{1, 2}},
+		{"Успешное_получение_по_меткам", "/history/gauge/Alloc?host=h1&to=" + future, http.StatusOK, []float64{10}},
+		{"Пустой_интервал", "/history/gauge/Alloc?from=" + future + "&to=" + later, http.StatusOK, []float64{}},
+		{"Неизвестная_метрика", "/history/gauge/Unknown", http.StatusOK, []float64{}},
+		{"Неверный_тип", "/history/unknown/Alloc", http.StatusBadRequest, nil},
+		{"Неверное_время", "/history/gauge/Alloc?from=yesterday", http.StatusBadRequest, nil},
+		{"Начало_позже_конца", "/history/gauge/Alloc?from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("RangeHandler() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantValues == nil {
+				return
+			}
+
+			var resp HistoryResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Не удалось разобрать ответ: %v", err)
+			}
+			if len(resp.Samples) != len(tt.wantValues) {
+				t.Fatalf("samples = %v, want %v", resp.Samples, tt.wantValues)
+			}
+			for i, s := range resp.Samples {
+				if s.Value != tt.wantValues[i] {
+					t.Errorf("samples[%d] = %v, want %v", i, s.Value, tt.wantValues[i])
+				}
+			}
+		})
+	}
+}
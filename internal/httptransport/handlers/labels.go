@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"yupi/internal/domain/metrics"
+
+	"github.com/go-chi/render"
+)
+
+// labelsFromQuery - метки из параметров запроса ?host=h1&service=api, параметр match
+// и служебные параметры reserved меткой не считаются
+func labelsFromQuery(r *http.Request, reserved ...string) (metrics.Labels, error) {
+	var labels metrics.Labels
+	for name, values := range r.URL.Query() {
+		if name == "match" || slices.Contains(reserved, name) || len(values) == 0 {
+			continue
+		}
+		if labels == nil {
+			labels = make(metrics.Labels)
+		}
+		labels[name] = values[0]
+	}
+
+	if err := labels.Validate(); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// findSeries - все ряды метрики name типа mType, метки которых подходят под условия, упорядоченные по ключу
+func (s *MetricServer) findSeries(ctx context.Context, mType, name string, matchers []metrics.Matcher) ([]metrics.Metrics, error) {
+	var keys []string
+	var gauges map[string]float64
+	var counters map[string]int64
+	var err error
+
+	switch mType {
+	case metrics.TypeGauge:
+		gauges, err = s.storage.GetAllGauges(ctx)
+		keys = sortedKeys(gauges)
+	case metrics.TypeCounter:
+		counters, err = s.storage.GetAllCounters(ctx)
+		keys = sortedKeys(counters)
+	default:
+		return nil, metrics.ErrInvalidType
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	series := make([]metrics.Metrics, 0)
+	for _, key := range keys {
+		seriesName, labels, err := metrics.ParseSeriesKey(key)
+		if err != nil || seriesName != name || !metrics.MatchAll(matchers, labels) {
+			continue
+		}
+
+		m := metrics.Metrics{ID: seriesName, MType: mType, Labels: labels}
+		if mType == metrics.TypeGauge {
+			value := gauges[key]
+			m.Value = &value
+		} else {
+			delta := counters[key]
+			m.Delta = &delta
+		}
+		series = append(series, m)
+	}
+
+	return series, nil
+}
+
+// matchValues - отдает в текстовом виде все ряды, подходящие под селектор
+func (s *MetricServer) matchValues(w http.ResponseWriter, r *http.Request, mType, name, selector string) {
+	matchers, err := metrics.ParseMatchers(selector)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := s.findSeries(r.Context(), mType, name, matchers)
+	if errors.Is(err, metrics.ErrInvalidType) {
+		http.Error(w, "Invalid metric type", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if len(series) == 0 {
+		http.Error(w, "Метрика не найдена", http.StatusNotFound)
+		return
+	}
+
+	var b strings.Builder
+	for _, m := range series {
+		if m.Value != nil {
+			fmt.Fprintf(&b, "%s %v\n", m.Key(), *m.Value)
+		} else {
+			fmt.Fprintf(&b, "%s %d\n", m.Key(), *m.Delta)
+		}
+	}
+
+	render.Status(r, http.StatusOK)
+	render.PlainText(w, r, b.String())
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"yupi/internal/domain/metrics"
+	"yupi/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestMetricServer_Labels(t *testing.T) {
+	storage := repository.NewMemStorage()
+	server := NewMetricServer(storage)
+
+	r := chi.NewRouter()
+	r.Post("/update/{type}/{name}/{value}", server.UpdateHandler)
+	r.Get("/value/{type}/{name}", server.ValueHandler)
+	r.Post("/update/", server.JSONUpdateHandler)
+	r.Post("/value/", server.JSONValueHandler)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	do(http.MethodPost, "/update/", `{"id":"Alloc","type":"gauge","value":1,"labels":{"host":"web-1"}}`)
+	do(http.MethodPost, "/update/", `{"id":"Alloc","type":"gauge","value":2,"labels":{"host":"web-2"}}`)
+	do(http.MethodPost, "/update/gauge/Alloc/3?host=db-1", "")
+	do(http.MethodPost, "/update/gauge/Alloc/4", "")
+
+	// Ряды с разными метками хранятся раздельно
+	if got, _, _ := storage.GetGauge(context.Background(), `Alloc{host="web-1"}`); got != 1 {
+		t.Errorf("Alloc{host=web-1} = %v, want 1", got)
+	}
+	if got, _, _ := storage.GetGauge(context.Background(), "Alloc"); got != 4 {
+		t.Errorf("Alloc без меток = %v, want 4", got)
+	}
+
+	t.Run("Точные_метки_в_текстовом_запросе", func(t *testing.T) {
+		w := do(http.MethodGet, "/value/gauge/Alloc?host=db-1", "")
+		if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "3" {
+			t.Errorf("ValueHandler() = %d %q, want 200 \"3\"", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Точные_метки_в_JSON_запросе", func(t *testing.T) {
+		w := do(http.MethodPost, "/value/", `{"id":"Alloc","type":"gauge","labels":{"host":"web-2"}}`)
+		want := `{"id":"Alloc","type":"gauge","value":2,"labels":{"host":"web-2"}}`
+		if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != want {
+			t.Errorf("JSONValueHandler() = %d %s, want 200 %s", w.Code, w.Body.String(), want)
+		}
+	})
+
+	t.Run("Селектор_в_JSON_запросе", func(t *testing.T) {
+		w := do(http.MethodPost, "/value/", `{"id":"Alloc","type":"gauge","match":"host=~\"web-.*\""}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("JSONValueHandler() status = %d, want 200", w.Code)
+		}
+
+		var series []metrics.Metrics
+		if err := json.Unmarshal(w.Body.Bytes(), &series); err != nil {
+			t.Fatalf("Не удалось разобрать ответ: %v", err)
+		}
+		if len(series) != 2 || series[0].Labels["host"] != "web-1" || series[1].Labels["host"] != "web-2" {
+			t.Errorf("JSONValueHandler() = %s, ожидали ряды web-1 и web-2", w.Body.String())
+		}
+	})
+
+	t.Run("Селектор_в_текстовом_запросе", func(t *testing.T) {
+		w := do(http.MethodGet, "/value/gauge/Alloc?match="+url.QueryEscape(`host!~"web-.*"`), "")
+		want := "Alloc 4\nAlloc{host=\"db-1\"} 3"
+		if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != want {
+			t.Errorf("ValueHandler() = %d %q, want 200 %q", w.Code, w.Body.String(), want)
+		}
+	})
+
+	t.Run("Некорректный_селектор", func(t *testing.T) {
+		w := do(http.MethodGet, "/value/gauge/Alloc?match="+url.QueryEscape(`host=web`), "")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("ValueHandler() status = %d, want 400", w.Code)
+		}
+	})
+}
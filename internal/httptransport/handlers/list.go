@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"yupi/internal/domain/metrics"
+)
+
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// MetricsPage - страница списка метрик, NextCursor пуст на последней странице
+type MetricsPage struct {
+	Metrics    []ListedMetric `json:"metrics"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// ListedMetric - метрика в списке. JSON не умеет NaN и бесконечности, которые принимает
+// обновление через URL, поэтому такие значения gauge отдаются строками "NaN", "+Inf", "-Inf"
+type ListedMetric struct {
+	metrics.Metrics
+	Value any `json:"value,omitempty"`
+}
+
+func newListedMetric(m metrics.Metrics) ListedMetric {
+	listed := ListedMetric{Metrics: m}
+	if m.Value != nil {
+		listed.Value = *m.Value
+		if math.IsNaN(*m.Value) || math.IsInf(*m.Value, 0) {
+			listed.Value = formatFloat(*m.Value)
+		}
+	}
+	return listed
+}
+
+// listQuery - фильтры, порядок и позиция запроса списка метрик
+type listQuery struct {
+	mType    string
+	prefix   string
+	regex    *regexp.Regexp
+	matchers []metrics.Matcher
+	sort     string
+	desc     bool
+	limit    int
+	after    *listCursor
+}
+
+// listItem - ряд в списке с ключами сортировки
+type listItem struct {
+	metric metrics.Metrics
+	key    string
+	value  float64
+}
+
+// listCursor - последний отданный ряд, следующая страница начинается сразу после него.
+// Хранит все ключи сортировки, поэтому позиция не сбивается при добавлении и удалении рядов между запросами.
+// Значение хранится строкой, чтобы курсор пережил NaN и бесконечности
+type listCursor struct {
+	Type  string `json:"t"`
+	Key   string `json:"k"`
+	Value string `json:"v"`
+}
+
+// ListHandler - все метрики обоих типов постранично:
+// GET /api/v1/metrics?type=<ТИП>&prefix=<НАЧАЛО_ИМЕНИ>&regex=<ВЫРАЖЕНИЕ>&match=<СЕЛЕКТОР>&sort=name|type|value&order=asc|desc&limit=<N>&cursor=<КУРСОР>
+// Курсор следующей страницы возвращается в next_cursor
+func (s *MetricServer) ListHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	q, err := parseListQuery(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	items, err := s.listItems(r.Context(), q)
+	if err != nil {
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	slices.SortFunc(items, q.compare)
+
+	// Пропускаем все ряды до курсора включительно
+	start := 0
+	if q.after != nil {
+		value, _ := strconv.ParseFloat(q.after.Value, 64)
+		after := listItem{metric: metrics.Metrics{MType: q.after.Type}, key: q.after.Key, value: value}
+		start, _ = slices.BinarySearchFunc(items, after, q.compare)
+		if start < len(items) && q.compare(items[start], after) == 0 {
+			start++
+		}
+	}
+
+	page := MetricsPage{Metrics: make([]ListedMetric, 0)}
+	end := min(start+q.limit, len(items))
+	for _, item := range items[start:end] {
+		page.Metrics = append(page.Metrics, newListedMetric(item.metric))
+	}
+	if end < len(items) {
+		last := items[end-1]
+		cursor, err := encodeCursor(listCursor{
+			Type:  last.metric.MType,
+			Key:   last.key,
+			Value: strconv.FormatFloat(last.value, 'g', -1, 64),
+		})
+		if err != nil {
+			http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+			return
+		}
+		page.NextCursor = cursor
+	}
+
+	respondJSON(w, page)
+}
+
+// parseListQuery - разбирает параметры запроса списка
+func parseListQuery(r *http.Request) (listQuery, error) {
+	query := r.URL.Query()
+	q := listQuery{
+		mType:  query.Get("type"),
+		prefix: query.Get("prefix"),
+		sort:   cmp.Or(query.Get("sort"), "name"),
+		limit:  DefaultListLimit,
+	}
+
+	if q.mType != "" && q.mType != metrics.TypeGauge && q.mType != metrics.TypeCounter {
+		return q, metrics.ErrInvalidType
+	}
+
+	if expr := query.Get("regex"); expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return q, fmt.Errorf("invalid regex: %w", err)
+		}
+		q.regex = re
+	}
+
+	if selector := query.Get("match"); selector != "" {
+		matchers, err := metrics.ParseMatchers(selector)
+		if err != nil {
+			return q, err
+		}
+		q.matchers = matchers
+	}
+
+	if !slices.Contains([]string{"name", "type", "value"}, q.sort) {
+		return q, fmt.Errorf("invalid sort %q, want name, type or value", q.sort)
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.desc = true
+	default:
+		return q, fmt.Errorf("invalid order %q, want asc or desc", order)
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > MaxListLimit {
+			return q, fmt.Errorf("invalid limit, want 1..%d", MaxListLimit)
+		}
+		q.limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			return q, err
+		}
+		q.after = &cursor
+	}
+
+	return q, nil
+}
+
+// listItems - ряды хранилища, подходящие под фильтры запроса
+func (s *MetricServer) listItems(ctx context.Context, q listQuery) ([]listItem, error) {
+	var gauges map[string]float64
+	var counters map[string]int64
+	var err error
+
+	if q.mType != metrics.TypeCounter {
+		if gauges, err = s.storage.GetAllGauges(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if q.mType != metrics.TypeGauge {
+		if counters, err = s.storage.GetAllCounters(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	items := make([]listItem, 0, len(gauges)+len(counters))
+	for key, value := range gauges {
+		if m, ok := q.match(key, metrics.TypeGauge); ok {
+			m.Value = &value
+			items = append(items, listItem{metric: m, key: key, value: value})
+		}
+	}
+	for key, delta := range counters {
+		if m, ok := q.match(key, metrics.TypeCounter); ok {
+			m.Delta = &delta
+			items = append(items, listItem{metric: m, key: key, value: float64(delta)})
+		}
+	}
+
+	return items, nil
+}
+
+// match - метрика без значения, если ряд key подходит под фильтры по имени и меткам
+func (q listQuery) match(key, mType string) (metrics.Metrics, bool) {
+	name, labels, err := metrics.ParseSeriesKey(key)
+	if err != nil || !strings.HasPrefix(name, q.prefix) || !metrics.MatchAll(q.matchers, labels) {
+		return metrics.Metrics{}, false
+	}
+	if q.regex != nil && !q.regex.MatchString(name) {
+		return metrics.Metrics{}, false
+	}
+	return metrics.Metrics{ID: name, MType: mType, Labels: labels}, true
+}
+
+// compare - полный порядок рядов: по выбранному полю, затем по ключу ряда и типу
+func (q listQuery) compare(a, b listItem) int {
+	var c int
+	switch q.sort {
+	case "type":
+		c = cmp.Compare(a.metric.MType, b.metric.MType)
+	case "value":
+		c = cmp.Compare(a.value, b.value)
+	}
+	c = cmp.Or(c, cmp.Compare(a.key, b.key), cmp.Compare(a.metric.MType, b.metric.MType))
+
+	if q.desc {
+		return -c
+	}
+	return c
+}
+
+func encodeCursor(c listCursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(value string) (listCursor, error) {
+	var c listCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(data, &c) != nil || c.Key == "" {
+		return c, errInvalidCursor
+	}
+	if _, err := strconv.ParseFloat(c.Value, 64); err != nil {
+		return c, errInvalidCursor
+	}
+	if c.Type != metrics.TypeGauge && c.Type != metrics.TypeCounter {
+		return c, errInvalidCursor
+	}
+	return c, nil
+}
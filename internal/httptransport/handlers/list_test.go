@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"yupi/internal/repository"
+)
+
+func TestMetricServer_ListHandler(t *testing.T) {
+	ctx := context.Background()
+	storage := repository.NewMemStorage()
+	storage.UpdateGauge(ctx, "Alloc", 30)                         //nolint:errcheck
+	storage.UpdateGauge(ctx, `HeapAlloc{host="web-1"}`, 20)       //nolint:errcheck
+	storage.UpdateGauge(ctx, `HeapAlloc{host="web-2"}`, 10)       //nolint:errcheck
+	storage.UpdateCounter(ctx, "PollCount", 5)                    //nolint:errcheck
+	storage.UpdateCounter(ctx, `HeapAlloc{host="web-1"}`, 40)     //nolint:errcheck
+	storage.UpdateCounter(ctx, `NetRxBytes{interface="eth0"}`, 1) //nolint:errcheck
+	server := NewMetricServer(storage)
+
+	list := func(t *testing.T, query string) (int, MetricsPage) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.ListHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/metrics?"+query, nil))
+
+		var page MetricsPage
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatalf("Не удалось разобрать ответ: %v", err)
+			}
+		}
+		return w.Code, page
+	}
+
+	keys := func(page MetricsPage) []string {
+		keys := make([]string, 0, len(page.Metrics))
+		for _, m := range page.Metrics {
+			keys = append(keys, m.MType+":"+m.Key())
+		}
+		return keys
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       []string
+	}{
+		{
+			name:       "Все_метрики_по_имени",
+			wantStatus: http.StatusOK,
+			want: []string{
+				"gauge:Alloc", `counter:HeapAlloc{host="web-1"}`, `gauge:HeapAlloc{host="web-1"}`, `gauge:HeapAlloc{host="web-2"}`,
+				`counter:NetRxBytes{interface="eth0"}`, "counter:PollCount",
+			},
+		},
+		{
+			name:       "Только_счетчики",
+			query:      "type=counter",
+			wantStatus: http.StatusOK,
+			want:       []string{`counter:HeapAlloc{host="web-1"}`, `counter:NetRxBytes{interface="eth0"}`, "counter:PollCount"},
+		},
+		{
+			name:       "По_началу_имени",
+			query:      "prefix=Heap&type=gauge",
+			wantStatus: http.StatusOK,
+			want:       []string{`gauge:HeapAlloc{host="web-1"}`, `gauge:HeapAlloc{host="web-2"}`},
+		},
+		{
+			name:       "По_выражению_и_меткам",
+			query:      "regex=" + url.QueryEscape("Alloc$") + "&match=" + url.QueryEscape(`host!="web-1"`),
+			wantStatus: http.StatusOK,
+			want:       []string{"gauge:Alloc", `gauge:HeapAlloc{host="web-2"}`},
+		},
+		{
+			name:       "По_значению_по_убыванию",
+			query:      "sort=value&order=desc&limit=3",
+			wantStatus: http.StatusOK,
+			want:       []string{`counter:HeapAlloc{host="web-1"}`, "gauge:Alloc", `gauge:HeapAlloc{host="web-1"}`},
+		},
+		{
+			name:       "Ничего_не_найдено",
+			query:      "prefix=Unknown",
+			wantStatus: http.StatusOK,
+			want:       []string{},
+		},
+		{name: "Неизвестный_тип", query: "type=histogram", wantStatus: http.StatusBadRequest},
+		{name: "Неверное_выражение", query: "regex=" + url.QueryEscape("("), wantStatus: http.StatusBadRequest},
+		{name: "Неверный_селектор", query: "match=host", wantStatus: http.StatusBadRequest},
+		{name: "Неизвестная_сортировка", query: "sort=labels", wantStatus: http.StatusBadRequest},
+		{name: "Неизвестный_порядок", query: "order=random", wantStatus: http.StatusBadRequest},
+		{name: "Неверный_лимит", query: "limit=0", wantStatus: http.StatusBadRequest},
+		{name: "Слишком_большой_лимит", query: "limit=1001", wantStatus: http.StatusBadRequest},
+		{name: "Неверный_курсор", query: "cursor=abc", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, page := list(t, tt.query)
+			if status != tt.wantStatus {
+				t.Fatalf("ListHandler() status = %d, want %d", status, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			got := keys(page)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ListHandler() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ListHandler()[%d] = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	t.Run("Постраничный_обход", func(t *testing.T) {
+		var all []string
+		query := "sort=value&limit=2"
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatal("Слишком много страниц")
+			}
+			_, page := list(t, query)
+			all = append(all, keys(page)...)
+
+			// Новый ряд в начале порядка не сдвигает следующие страницы
+			if pages == 0 {
+				storage.UpdateGauge(ctx, "Negative", -1) //nolint:errcheck
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			query = "sort=value&limit=2&cursor=" + page.NextCursor
+		}
+
+		want := []string{
+			`counter:NetRxBytes{interface="eth0"}`, "counter:PollCount",
+			`gauge:HeapAlloc{host="web-2"}`, `gauge:HeapAlloc{host="web-1"}`,
+			"gauge:Alloc", `counter:HeapAlloc{host="web-1"}`,
+		}
+		if len(all) != len(want) {
+			t.Fatalf("Обход = %v, want %v", all, want)
+		}
+		for i := range all {
+			if all[i] != want[i] {
+				t.Errorf("Обход[%d] = %s, want %s", i, all[i], want[i])
+			}
+		}
+	})
+}
+
+func TestMetricServer_ListHandler_NonFinite(t *testing.T) {
+	ctx := context.Background()
+	storage := repository.NewMemStorage()
+	storage.UpdateGauge(ctx, "Alloc", 1)               //nolint:errcheck
+	storage.UpdateGauge(ctx, "Broken", math.NaN())     //nolint:errcheck
+	storage.UpdateGauge(ctx, "Huge", math.Inf(1))      //nolint:errcheck
+	storage.UpdateGauge(ctx, "Negative", math.Inf(-1)) //nolint:errcheck
+	server := NewMetricServer(storage)
+
+	var got []string
+	query := "sort=value&limit=1"
+	for pages := 0; ; pages++ {
+		if pages > 4 {
+			t.Fatal("Слишком много страниц")
+		}
+		w := httptest.NewRecorder()
+		server.ListHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/metrics?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("ListHandler() status = %d: %s", w.Code, w.Body.String())
+		}
+
+		var page MetricsPage
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("Не удалось разобрать ответ: %v", err)
+		}
+		for _, m := range page.Metrics {
+			got = append(got, fmt.Sprintf("%s=%v", m.ID, m.Value))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query = "sort=value&limit=1&cursor=" + page.NextCursor
+	}
+
+	// NaN меньше любого числа, поэтому идет первым
+	want := []string{"Broken=NaN", "Negative=-Inf", "Alloc=1", "Huge=+Inf"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Обход = %v, want %v", got, want)
+	}
+}
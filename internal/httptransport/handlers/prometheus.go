@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"yupi/internal/domain/metrics"
+)
+
+const (
+	prometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// PrometheusHandler - отдает все метрики хранилища в текстовом формате Prometheus,
+// либо в формате OpenMetrics, если клиент его запросил в Accept
+func (s *MetricServer) PrometheusHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	gauges, err := s.storage.GetAllGauges(r.Context())
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	counters, err := s.storage.GetAllCounters(r.Context())
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+
+	families := make(map[string]*promFamily)
+	var order []string
+
+	// addSeries - добавляет ряд в семейство. Имена после очистки могут совпасть,
+	// а в выдаче у семейства должен быть один тип, поэтому конфликтующие ряды пропускаем
+	addSeries := func(key, metricType, value string) {
+		name, labels, err := metrics.ParseSeriesKey(key)
+		if err != nil {
+			return
+		}
+
+		family := sanitizeMetricName(name)
+		// В OpenMetrics значения счетчика обязаны иметь суффикс _total, а семейство - нет
+		if openMetrics && metricType == metrics.TypeCounter {
+			family = strings.TrimSuffix(family, "_total")
+		}
+
+		f, ok := families[family]
+		if !ok {
+			f = &promFamily{name: family, metricType: metricType, help: name}
+			families[family] = f
+			order = append(order, family)
+		}
+		if f.metricType != metricType || f.help != name {
+			return
+		}
+
+		f.samples = append(f.samples, promSample{labels: formatPromLabels(labels), value: value})
+	}
+
+	for _, key := range sortedKeys(gauges) {
+		addSeries(key, metrics.TypeGauge, formatFloat(gauges[key]))
+	}
+	for _, key := range sortedKeys(counters) {
+		addSeries(key, metrics.TypeCounter, strconv.FormatInt(counters[key], 10))
+	}
+
+	buf := &bytes.Buffer{}
+	for _, family := range order {
+		f := families[family]
+		writeMetricHeader(buf, f.name, f.metricType, f.help)
+
+		sample := f.name
+		if openMetrics && f.metricType == metrics.TypeCounter {
+			sample = f.name + "_total"
+		}
+		for _, smp := range f.samples {
+			fmt.Fprintf(buf, "%s%s %s\n", sample, smp.labels, smp.value)
+		}
+	}
+
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", prometheusContentType)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes()) //nolint:errcheck
+}
+
+// promFamily - семейство метрик Prometheus: одно имя, один тип, ряды с разными метками
+type promFamily struct {
+	name       string
+	metricType string
+	help       string
+	samples    []promSample
+}
+
+type promSample struct {
+	labels string
+	value  string
+}
+
+func writeMetricHeader(buf *bytes.Buffer, promName, metricType, originalName string) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(originalName)
+	fmt.Fprintf(buf, "# HELP %s %s metric %s\n", promName, metricType, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", promName, metricType)
+}
+
+// formatPromLabels - метки в формате экспозиции {a="1",b="2"}: в значениях экранируются только
+// обратная косая черта, кавычка и перевод строки
+func formatPromLabels(labels metrics.Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	parts := make([]string, 0, len(labels))
+	for _, name := range sortedKeys(labels) {
+		parts = append(parts, name+`="`+escape.Replace(labels[name])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// sanitizeMetricName - приводит имя к виду [a-zA-Z_:][a-zA-Z0-9_:]*, недопустимые символы заменяются на _
+func sanitizeMetricName(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		switch {
+		case c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			b.WriteRune(c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(c)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
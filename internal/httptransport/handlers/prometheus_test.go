@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yupi/internal/repository"
+)
+
+func TestSanitizeMetricName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Alloc", "Alloc"},
+		{"http.requests-count", "http_requests_count"},
+		{"1st_metric", "_1st_metric"},
+		{"ns:metric", "ns:metric"},
+		{"память", "______"},
+		{"", "_"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := sanitizeMetricName(tt.name); got != tt.want {
+				t.Errorf("sanitizeMetricName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricServer_PrometheusHandler(t *testing.T) {
+	storage := repository.NewMemStorage()
+	ctx := context.Background()
+	storage.UpdateGauge(ctx, "Alloc", 1.5)
+	storage.UpdateGauge(ctx, "heap.size", 1024)
+	storage.UpdateCounter(ctx, "PollCount", 7)
+	storage.UpdateGauge(ctx, `Alloc{host="web-1"}`, 2.5)
+	server := NewMetricServer(storage)
+
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+		wantLines       []string
+	}{
+		{
+			name:            "Текстовый_формат_Prometheus",
+			wantContentType: prometheusContentType,
+			wantLines: []string{
+				"# HELP Alloc gauge metric Alloc",
+				"# TYPE Alloc gauge",
+				"Alloc 1.5",
+				`Alloc{host="web-1"} 2.5`,
+				"# TYPE heap_size gauge",
+				"heap_size 1024",
+				"# TYPE PollCount counter",
+				"PollCount 7",
+			},
+		},
+		{
+			name:            "Формат_OpenMetrics",
+			accept:          "application/openmetrics-text; version=1.0.0",
+			wantContentType: openMetricsContentType,
+			wantLines: []string{
+				"# TYPE PollCount counter",
+				"PollCount_total 7",
+				"# EOF",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			server.PrometheusHandler(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("PrometheusHandler() status = %v, want %v", w.Code, http.StatusOK)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("PrometheusHandler() Content-Type = %v, want %v", got, tt.wantContentType)
+			}
+
+			lines := strings.Split(w.Body.String(), "\n")
+			for _, want := range tt.wantLines {
+				found := false
+				for _, line := range lines {
+					if line == want {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("PrometheusHandler() нет строки %q в ответе:\n%s", want, w.Body.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"yupi/internal/service/alerting"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// SilencesServer - обработчик запросов тишин оповещений
+type SilencesServer struct {
+	silences *alerting.Silences
+}
+
+// NewSilencesServer - конструктор обработчика тишин
+func NewSilencesServer(silences *alerting.Silences) *SilencesServer {
+	return &SilencesServer{silences: silences}
+}
+
+// silenceRequest - запрос создания тишины, окончание задается временем ends_at или длительностью duration
+type silenceRequest struct {
+	Metric    string    `json:"metric"`
+	Matchers  string    `json:"matchers"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Duration  string    `json:"duration"`
+	CreatedBy string    `json:"created_by"`
+	Comment   string    `json:"comment"`
+}
+
+// CreateHandler - создает тишину: POST /silences
+func (s *SilencesServer) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req silenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+
+	endsAt := req.EndsAt
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			http.Error(w, `{"error":"invalid duration"}`, http.StatusBadRequest)
+			return
+		}
+		start := req.StartsAt
+		if start.IsZero() {
+			start = time.Now()
+		}
+		endsAt = start.Add(d)
+	}
+
+	silence, err := s.silences.Add(alerting.Silence{
+		Metric:    req.Metric,
+		Matchers:  req.Matchers,
+		StartsAt:  req.StartsAt,
+		EndsAt:    endsAt,
+		CreatedBy: req.CreatedBy,
+		Comment:   req.Comment,
+	})
+	if errors.Is(err, alerting.ErrInvalidSilence) {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(silence) //nolint:errcheck
+}
+
+// ListHandler - все тишины, включая недавно истекшие: GET /silences
+func (s *SilencesServer) ListHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	respondJSON(w, s.silences.List())
+}
+
+// ExpireHandler - досрочно завершает тишину: DELETE /silences/{id}
+func (s *SilencesServer) ExpireHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	silence, err := s.silences.Expire(chi.URLParam(r, "id"))
+	if errors.Is(err, alerting.ErrSilenceNotFound) {
+		http.Error(w, `{"error":"silence not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, silence)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yupi/internal/service/alerting"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestSilencesServer(t *testing.T) {
+	server := NewSilencesServer(alerting.NewSilences())
+
+	r := chi.NewRouter()
+	r.Get("/silences", server.ListHandler)
+	r.Post("/silences", server.CreateHandler)
+	r.Delete("/silences/{id}", server.ExpireHandler)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	createTests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "Успешное_создание_по_метрике", body: `{"metric":"HeapAlloc","duration":"1h","created_by":"oncall"}`, wantStatus: http.StatusCreated},
+		{name: "Успешное_создание_по_меткам", body: `{"matchers":"host=~\"web-.*\"","duration":"30m"}`, wantStatus: http.StatusCreated},
+		{name: "Неверный_JSON", body: `{"metric":`, wantStatus: http.StatusBadRequest},
+		{name: "Неверная_длительность", body: `{"metric":"HeapAlloc","duration":"-1h"}`, wantStatus: http.StatusBadRequest},
+		{name: "Без_окончания", body: `{"metric":"HeapAlloc"}`, wantStatus: http.StatusBadRequest},
+		{name: "Без_условий", body: `{"duration":"1h"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	var created alerting.Silence
+	for _, tt := range createTests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(http.MethodPost, "/silences", tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("CreateHandler() status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code == http.StatusCreated && created.ID == "" {
+				if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+					t.Fatalf("Не удалось разобрать ответ: %v", err)
+				}
+			}
+		})
+	}
+
+	t.Run("Список_тишин", func(t *testing.T) {
+		w := do(http.MethodGet, "/silences", "")
+		var silences []alerting.Silence
+		if err := json.Unmarshal(w.Body.Bytes(), &silences); err != nil {
+			t.Fatalf("Не удалось разобрать ответ: %v", err)
+		}
+		if len(silences) != 2 || silences[0].Status != alerting.SilenceActive {
+			t.Errorf("ListHandler() = %s, want 2 активные тишины", w.Body.String())
+		}
+	})
+
+	t.Run("Досрочное_завершение", func(t *testing.T) {
+		w := do(http.MethodDelete, "/silences/"+created.ID, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("ExpireHandler() status = %d, want %d", w.Code, http.StatusOK)
+		}
+		var silence alerting.Silence
+		json.Unmarshal(w.Body.Bytes(), &silence) //nolint:errcheck
+		if silence.Status != alerting.SilenceExpired {
+			t.Errorf("ExpireHandler() status тишины = %s, want expired", silence.Status)
+		}
+	})
+
+	t.Run("Неизвестная_тишина", func(t *testing.T) {
+		if w := do(http.MethodDelete, "/silences/unknown", ""); w.Code != http.StatusNotFound {
+			t.Errorf("ExpireHandler() status = %d, want %d", w.Code, http.StatusNotFound)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
@@ -16,11 +17,11 @@ import (
 
 // MetricServer - сервер для обработки метрик
 type MetricServer struct {
-	storage *repository.MemStorage
+	storage repository.Storage
 }
 
 // NewMetricServer - конструктор сервера метрик
-func NewMetricServer(storage *repository.MemStorage) *MetricServer {
+func NewMetricServer(storage repository.Storage) *MetricServer {
 	return &MetricServer{storage: storage}
 }
 
@@ -32,17 +33,67 @@ func (s *MetricServer) JSONUpdateHandler(w http.ResponseWriter, r *http.Request)
 	}
 	defer r.Body.Close()
 
+	if err := m.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	var err error
 	switch m.MType {
-	case "gauge":
-		s.storage.UpdateGaugeV2(&m)
-	case "counter":
-		s.storage.UpdateCounterV2(&m)
-	default:
-		http.Error(w, `{"error":"Invalid metric type"}`, http.StatusBadRequest)
+	case metrics.TypeGauge:
+		err = s.storage.UpdateGauge(r.Context(), m.Key(), *m.Value)
+	case metrics.TypeCounter:
+		err = s.storage.UpdateCounter(r.Context(), m.Key(), *m.Delta)
+	}
+
+	if err != nil {
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
 		return
 	}
 
-	respondJSON(w, metrics.Metrics{ID: m.ID, MType: m.MType, Value: m.Value, Delta: m.Delta})
+	respondJSON(w, metrics.Metrics{ID: m.ID, MType: m.MType, Value: m.Value, Delta: m.Delta, Labels: m.Labels})
+}
+
+// BatchResult - результат обработки одной метрики из пакета
+type BatchResult struct {
+	metrics.Metrics
+	Error string `json:"error,omitempty"`
+}
+
+// JSONUpdatesHandler - пакетное обновление метрик, пакет применяется целиком или не применяется вовсе
+func (s *MetricServer) JSONUpdatesHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var batch []metrics.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Сначала проверяем все метрики, чтобы не применить пакет частично
+	results := make([]BatchResult, len(batch))
+	valid := true
+	for i, m := range batch {
+		results[i] = BatchResult{Metrics: m}
+		if err := m.Validate(); err != nil {
+			results[i].Error = err.Error()
+			valid = false
+		}
+	}
+
+	if !valid {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(results) //nolint:errcheck
+		return
+	}
+
+	if err := s.storage.UpdateBatch(r.Context(), batch); err != nil {
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, results)
 }
 
 // UpdateHandler - обработчик обновления метрик
@@ -59,17 +110,24 @@ func (s *MetricServer) UpdateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Разбираем URL: /update/<ТИП_МЕТРИКИ>/<ИМЯ_МЕТРИКИ>/<ЗНАЧЕНИЕ_МЕТРИКИ>
+	// Разбираем URL: /update/<ТИП_МЕТРИКИ>/<ИМЯ_МЕТРИКИ>/<ЗНАЧЕНИЕ_МЕТРИКИ>?<МЕТКА>=<ЗНАЧЕНИЕ>
 	metricType := chi.URLParam(r, "type")
 	metricName := chi.URLParam(r, "name")
 	metricValue := chi.URLParam(r, "value")
 
 	// Проверяем что username не пустой
-	if strings.TrimSpace(metricName) == "" || strings.ContainsAny(metricName, "!@#$%^&*") {
+	if strings.TrimSpace(metricName) == "" || strings.ContainsAny(metricName, "!@#$%^&*{}") {
 		render.Status(r, http.StatusNotFound)
 		return
 	}
 
+	labels, err := labelsFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := metrics.SeriesKey(metricName, labels)
+
 	switch metricType {
 	case "gauge":
 		value, err := strconv.ParseFloat(metricValue, 64)
@@ -77,7 +135,10 @@ func (s *MetricServer) UpdateHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid gauge value", http.StatusBadRequest)
 			return
 		}
-		s.storage.UpdateGauge(metricName, value)
+		if err := s.storage.UpdateGauge(r.Context(), key, value); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	case "counter":
 		value, err := strconv.ParseInt(metricValue, 10, 64)
@@ -85,7 +146,10 @@ func (s *MetricServer) UpdateHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid counter value", http.StatusBadRequest)
 			return
 		}
-		s.storage.UpdateCounter(metricName, value)
+		if err := s.storage.UpdateCounter(r.Context(), key, value); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	default:
 		http.Error(w, "Invalid metric type", http.StatusBadRequest)
@@ -103,19 +167,36 @@ func (s *MetricServer) ValueHandler(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 
-	// Разбираем URL: /value/<ТИП_МЕТРИКИ>/<ИМЯ_МЕТРИКИ>
+	// Разбираем URL: /value/<ТИП_МЕТРИКИ>/<ИМЯ_МЕТРИКИ>?<МЕТКА>=<ЗНАЧЕНИЕ> или ?match=<СЕЛЕКТОР>
 	metricType := chi.URLParam(r, "type")
 	metricName := chi.URLParam(r, "name")
 
 	// Проверяем что username не пустой
-	if strings.TrimSpace(metricName) == "" || strings.ContainsAny(metricName, "!@#$%^&*") {
+	if strings.TrimSpace(metricName) == "" || strings.ContainsAny(metricName, "!@#$%^&*{}") {
 		render.Status(r, http.StatusNotFound)
 		return
 	}
 
+	// С селектором отдаем все подходящие ряды построчно: <ключ ряда> <значение>
+	if selector := r.URL.Query().Get("match"); selector != "" {
+		s.matchValues(w, r, metricType, metricName, selector)
+		return
+	}
+
+	labels, err := labelsFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	key := metrics.SeriesKey(metricName, labels)
+
 	switch metricType {
 	case "gauge":
-		value, exist := s.storage.GetGauge(metricName)
+		value, exist, err := s.storage.GetGauge(r.Context(), key)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 		if !exist {
 			http.Error(w, "Метрика не найдена", http.StatusNotFound)
 			return
@@ -125,7 +206,11 @@ func (s *MetricServer) ValueHandler(w http.ResponseWriter, r *http.Request) {
 		render.Status(r, http.StatusOK)
 		render.PlainText(w, r, result)
 	case "counter":
-		value, exist := s.storage.GetCounter(metricName)
+		value, exist, err := s.storage.GetCounter(r.Context(), key)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 		if !exist {
 			http.Error(w, "Метрика не найдена", http.StatusNotFound)
 			return
@@ -139,18 +224,56 @@ func (s *MetricServer) ValueHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// valueRequest - запрос значения: метрика с точным набором меток либо селектор по меткам
+type valueRequest struct {
+	metrics.Metrics
+	Match string `json:"match,omitempty"`
+}
+
 func (s *MetricServer) JSONValueHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	var m metrics.Metrics
-	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+	var req valueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
 		return
 	}
+	m := req.Metrics
+
+	if err := m.Labels.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	// С селектором отдаем массив всех подходящих рядов
+	if req.Match != "" {
+		matchers, err := metrics.ParseMatchers(req.Match)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		series, err := s.findSeries(r.Context(), m.MType, m.ID, matchers)
+		if errors.Is(err, metrics.ErrInvalidType) {
+			http.Error(w, `{"error":"Invalid metric type"}`, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+			return
+		}
+
+		respondJSON(w, series)
+		return
+	}
 
 	switch m.MType {
 	case "gauge":
-		value, exist := s.storage.GetGauge(m.ID)
+		value, exist, err := s.storage.GetGauge(r.Context(), m.Key())
+		if err != nil {
+			http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+			return
+		}
 		if !exist {
 			http.Error(w, `{"error":"Метрика не найдена"}`, http.StatusNotFound)
 			return
@@ -158,7 +281,11 @@ func (s *MetricServer) JSONValueHandler(w http.ResponseWriter, r *http.Request)
 		m.Value = new(float64)
 		*m.Value = value
 	case "counter":
-		delta, exist := s.storage.GetCounter(m.ID)
+		delta, exist, err := s.storage.GetCounter(r.Context(), m.Key())
+		if err != nil {
+			http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+			return
+		}
 		if !exist {
 			http.Error(w, "Метрика не найдена", http.StatusNotFound)
 			return
@@ -170,7 +297,7 @@ func (s *MetricServer) JSONValueHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	respondJSON(w, metrics.Metrics{ID: m.ID, MType: m.MType, Value: m.Value, Delta: m.Delta})
+	respondJSON(w, metrics.Metrics{ID: m.ID, MType: m.MType, Value: m.Value, Delta: m.Delta, Labels: m.Labels})
 }
 
 /*
@@ -184,7 +311,11 @@ func (s *MetricServer) MainHandler(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 
-	values := s.storage.GetAllGauges()
+	values, err := s.storage.GetAllGauges(r.Context())
+	if err != nil {
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
 	// Устанавливаем Content-Type до сжатия
 	w.Header().Set("Content-Type", "text/html")
 
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -95,12 +97,12 @@ func TestMetricServer_UpdateHandler(t *testing.T) {
 
 			if tt.checkMetric {
 				if strings.Contains(tt.path, "gauge") {
-					if value, exists := storage.GetGauge("test_gauge"); !exists || value != tt.wantGauge {
+					if value, exists, _ := storage.GetGauge(context.Background(), "test_gauge"); !exists || value != tt.wantGauge {
 						t.Errorf("UpdateHandler() gauge = %v, want %v", value, tt.wantGauge)
 					}
 				} else if strings.Contains(tt.path, "counter") {
 					metricName := strings.Split(tt.path, "/")[3]
-					if value, exists := storage.GetCounter(metricName); !exists || value != tt.wantCounter {
+					if value, exists, _ := storage.GetCounter(context.Background(), metricName); !exists || value != tt.wantCounter {
 						t.Errorf("UpdateHandler() counter = %v, want %v", value, tt.wantCounter)
 					}
 				}
@@ -175,11 +177,11 @@ func TestMetricServer_JSONUpdateHandler(t *testing.T) {
 
 			if tt.checkMetric {
 				if strings.Contains(tt.requestBody, "gauge") {
-					if value, exists := storage.GetGauge("test_gauge"); !exists || value != tt.wantGaugeValue {
+					if value, exists, _ := storage.GetGauge(context.Background(), "test_gauge"); !exists || value != tt.wantGaugeValue {
 						t.Errorf("JSONUpdateHandler() gauge = %v, want %v", value, tt.wantGaugeValue)
 					}
 				} else if strings.Contains(tt.requestBody, "counter") {
-					if value, exists := storage.GetCounter("test_counter"); !exists || value != tt.wantCounterValue {
+					if value, exists, _ := storage.GetCounter(context.Background(), "test_counter"); !exists || value != tt.wantCounterValue {
 						t.Errorf("JSONUpdateHandler() counter = %v, want %v", value, tt.wantCounterValue)
 					}
 				}
@@ -259,3 +261,102 @@ func TestMetricServer_JSONValueHandler(t *testing.T) {
 		})
 	}
 }
+
+// failingStorage - хранилище, которое всегда возвращает ошибку
+type failingStorage struct {
+	repository.MemStorage
+}
+
+var errStorage = errors.New("storage unavailable")
+
+func (f *failingStorage) UpdateGauge(_ context.Context, _ string, _ float64) error {
+	return errStorage
+}
+
+func (f *failingStorage) GetCounter(_ context.Context, _ string) (int64, bool, error) {
+	return 0, false, errStorage
+}
+
+func TestMetricServer_StorageError(t *testing.T) {
+	server := NewMetricServer(&failingStorage{})
+
+	req := httptest.NewRequest(http.MethodPost, "/update", strings.NewReader(`{"id":"test","type":"gauge","value":1}`))
+	w := httptest.NewRecorder()
+	server.JSONUpdateHandler(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("JSONUpdateHandler() status = %v, want %v", w.Code, http.StatusInternalServerError)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/value", strings.NewReader(`{"id":"test","type":"counter"}`))
+	w = httptest.NewRecorder()
+	server.JSONValueHandler(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("JSONValueHandler() status = %v, want %v", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestMetricServer_JSONUpdatesHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		requestBody string
+		wantStatus  int
+		wantGauge   float64
+		wantCounter int64
+		wantApplied bool
+	}{
+		{
+			name:        "Успешное_пакетное_обновление",
+			requestBody: `[{"id":"test_gauge","type":"gauge","value":1.5},{"id":"test_counter","type":"counter","delta":2},{"id":"test_counter","type":"counter","delta":3}]`,
+			wantStatus:  http.StatusOK,
+			wantGauge:   1.5,
+			wantCounter: 5,
+			wantApplied: true,
+		},
+		{
+			name:        "Пакет_с_некорректной_метрикой_не_применяется",
+			requestBody: `[{"id":"test_gauge","type":"gauge","value":1.5},{"id":"test_counter","type":"counter"}]`,
+			wantStatus:  http.StatusBadRequest,
+			wantApplied: false,
+		},
+		{
+			name:        "Некорректный_JSON",
+			requestBody: `[{"id":"test_gauge","type":"gauge","value":1.5}`,
+			wantStatus:  http.StatusBadRequest,
+			wantApplied: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := repository.NewMemStorage()
+			server := NewMetricServer(storage)
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(tt.requestBody))
+			w := httptest.NewRecorder()
+			server.JSONUpdatesHandler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("JSONUpdatesHandler() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+
+			gauge, gaugeExists, _ := storage.GetGauge(context.Background(), "test_gauge")
+			counter, counterExists, _ := storage.GetCounter(context.Background(), "test_counter")
+
+			if !tt.wantApplied {
+				if gaugeExists || counterExists {
+					t.Error("JSONUpdatesHandler() пакет применен частично")
+				}
+				return
+			}
+
+			if gauge != tt.wantGauge {
+				t.Errorf("JSONUpdatesHandler() gauge = %v, want %v", gauge, tt.wantGauge)
+			}
+			if counter != tt.wantCounter {
+				t.Errorf("JSONUpdatesHandler() counter = %v, want %v", counter, tt.wantCounter)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"yupi/internal/encryption"
+)
+
+// DecryptMiddleware - расшифровывает тело запроса закрытым ключом.
+// Должен стоять до GzipMiddleware: агент сначала сжимает, потом шифрует.
+// С ключом все POST-запросы с телом обязаны быть зашифрованы.
+func DecryptMiddleware(key *rsa.PrivateKey) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if key == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme := r.Header.Get(encryption.Header)
+			if scheme == "" {
+				if r.Method == http.MethodPost && r.ContentLength != 0 {
+					http.Error(w, `{"error":"request body must be encrypted"}`, http.StatusBadRequest)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if scheme != encryption.Scheme {
+				http.Error(w, `{"error":"unsupported encryption scheme"}`, http.StatusBadRequest)
+				return
+			}
+
+			msg, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, `{"error":"failed to read body"}`, http.StatusBadRequest)
+				return
+			}
+			r.Body.Close()
+
+			data, err := encryption.Decrypt(key, msg)
+			if err != nil {
+				Log.Warn("Не удалось расшифровать запрос " + r.URL.Path + ": " + err.Error())
+				http.Error(w, `{"error":"failed to decrypt body"}`, http.StatusBadRequest)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(data))
+			r.ContentLength = int64(len(data))
+			r.Header.Del(encryption.Header)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
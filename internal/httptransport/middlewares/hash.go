@@ -0,0 +1,61 @@
+package middlewares
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"yupi/internal/signature"
+)
+
+// HashMiddleware - проверяет подпись HMAC-SHA256 тела запроса общим ключом и подписывает ответ.
+// Все POST-запросы обязаны быть подписаны, GET-запросы без подписи пропускаются.
+// Должен стоять после GzipMiddleware, так как подписывается несжатое тело.
+func HashMiddleware(key string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if key == "" {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sign := r.Header.Get(signature.Header)
+			if sign != "" || r.Method == http.MethodPost {
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					http.Error(w, `{"error":"failed to read body"}`, http.StatusBadRequest)
+					return
+				}
+				r.Body.Close()
+
+				if !signature.Valid(key, body, sign) {
+					Log.Warn("Отклонен запрос с неверной подписью " + r.URL.Path)
+					http.Error(w, `{"error":"invalid signature"}`, http.StatusBadRequest)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			// Подпись ставится в заголовок, поэтому ответ копим целиком и отдаем после подписи
+			sw := &signWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+
+			w.Header().Set(signature.Header, signature.Sign(key, sw.body.Bytes()))
+			w.WriteHeader(sw.status)
+			w.Write(sw.body.Bytes()) //nolint:errcheck
+		})
+	}
+}
+
+// signWriter - буферизует ответ, чтобы подписать его перед отправкой
+type signWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (s *signWriter) WriteHeader(statusCode int) {
+	s.status = statusCode
+}
+
+func (s *signWriter) Write(p []byte) (int, error) {
+	return s.body.Write(p)
+}
@@ -0,0 +1,71 @@
+package middlewares
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"yupi/internal/signature"
+)
+
+func TestHashMiddleware(t *testing.T) {
+	const key = "secret"
+	body := `{"id":"Alloc","type":"gauge","value":1}`
+
+	handler := HashMiddleware(key)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+		w.Write(data) //nolint:errcheck
+	}))
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		sign       string
+		wantStatus int
+	}{
+		{"Успешная_проверка_подписи", http.MethodPost, body, signature.Sign(key, []byte(body)), http.StatusOK},
+		{"Неверная_подпись", http.MethodPost, body, signature.Sign("other", []byte(body)), http.StatusBadRequest},
+		{"POST_без_подписи", http.MethodPost, body, "", http.StatusBadRequest},
+		{"GET_без_подписи", http.MethodGet, "", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/update/", strings.NewReader(tt.body))
+			if tt.sign != "" {
+				req.Header.Set(signature.Header, tt.sign)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			// Ответ подписан тем же ключом и тело передано обработчику без изменений
+			if w.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.body)
+			}
+			if !signature.Valid(key, w.Body.Bytes(), w.Header().Get(signature.Header)) {
+				t.Error("Ответ не подписан или подпись неверна")
+			}
+		})
+	}
+
+	t.Run("Без_ключа_проверка_отключена", func(t *testing.T) {
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		req := httptest.NewRequest(http.MethodPost, "/update/", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		HashMiddleware("")(next).ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || w.Header().Get(signature.Header) != "" {
+			t.Errorf("status = %d, sign = %q, want 200 без подписи", w.Code, w.Header().Get(signature.Header))
+		}
+	})
+}
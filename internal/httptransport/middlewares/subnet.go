@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseSubnets - разбирает список подсетей CIDR через запятую, пустая строка дает пустой список
+func ParseSubnets(s string) ([]*net.IPNet, error) {
+	var subnets []*net.IPNet
+	for _, cidr := range strings.Split(s, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted subnet %q: %w", cidr, err)
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets, nil
+}
+
+// TrustedSubnetMiddleware - пропускает только запросы, у которых и адрес из X-Real-IP,
+// и адрес соединения входят в одну из доверенных подсетей. Заголовок подделать легко,
+// поэтому одного его недостаточно. Пустой список подсетей отключает проверку.
+func TrustedSubnetMiddleware(subnets []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(subnets) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+
+			var connIP net.IP
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				connIP = net.ParseIP(host)
+			}
+
+			if !InSubnets(subnets, realIP) || !InSubnets(subnets, connIP) {
+				Log.Warn("Отклонен запрос из недоверенной сети: X-Real-IP=" + r.Header.Get("X-Real-IP") + ", remote=" + r.RemoteAddr)
+				http.Error(w, `{"error":"forbidden"}`, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// InSubnets - входит ли адрес в одну из подсетей, nil не входит никуда
+func InSubnets(subnets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
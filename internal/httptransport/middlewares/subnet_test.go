@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedSubnetMiddleware(t *testing.T) {
+	subnets, err := ParseSubnets("10.0.0.0/8, 192.168.1.0/24")
+	if err != nil {
+		t.Fatalf("ParseSubnets() error = %v", err)
+	}
+
+	handler := TrustedSubnetMiddleware(subnets)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		realIP     string
+		remoteAddr string
+		wantStatus int
+	}{
+		{"Успешный_запрос_из_доверенной_сети", "10.1.2.3", "10.1.2.3:5000", http.StatusOK},
+		{"Адреса_из_разных_доверенных_сетей", "192.168.1.10", "10.0.0.1:5000", http.StatusOK},
+		{"Без_X-Real-IP", "", "10.1.2.3:5000", http.StatusForbidden},
+		{"X-Real-IP_не_из_доверенной_сети", "172.16.0.1", "10.1.2.3:5000", http.StatusForbidden},
+		{"Подделанный_X-Real-IP", "10.1.2.3", "8.8.8.8:5000", http.StatusForbidden},
+		{"Некорректный_X-Real-IP", "not-an-ip", "10.1.2.3:5000", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/update/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	t.Run("Некорректная_подсеть", func(t *testing.T) {
+		if _, err := ParseSubnets("10.0.0.0/8,bad"); err == nil {
+			t.Error("ParseSubnets() должен вернуть ошибку")
+		}
+	})
+}
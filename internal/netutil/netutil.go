@@ -0,0 +1,19 @@
+package netutil
+
+import "net"
+
+// OutboundIP - локальный адрес, который ОС выберет для соединения с host.
+// UDP сокет ничего не отправляет, только выбирает маршрут
+func OutboundIP(host string) (net.IP, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "80")
+	}
+
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
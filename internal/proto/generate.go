@@ -0,0 +1,4 @@
+// Package proto - сгенерированный код gRPC сервиса метрик из api/proto/metrics.proto
+package proto
+
+//go:generate sh -c "cd ../.. && buf generate"
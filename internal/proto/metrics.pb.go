@@ -0,0 +1,641 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: metrics.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type MType int32
+
+const (
+	MType_MTYPE_UNSPECIFIED MType = 0
+	MType_GAUGE             MType = 1
+	MType_COUNTER           MType = 2
+)
+
+// Enum value maps for MType.
+var (
+	MType_name = map[int32]string{
+		0: "MTYPE_UNSPECIFIED",
+		1: "GAUGE",
+		2: "COUNTER",
+	}
+	MType_value = map[string]int32{
+		"MTYPE_UNSPECIFIED": 0,
+		"GAUGE":             1,
+		"COUNTER":           2,
+	}
+)
+
+func (x MType) Enum() *MType {
+	p := new(MType)
+	*p = x
+	return p
+}
+
+func (x MType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (MType) Descriptor() protoreflect.EnumDescriptor {
+	return file_metrics_proto_enumTypes[0].Descriptor()
+}
+
+func (MType) Type() protoreflect.EnumType {
+	return &file_metrics_proto_enumTypes[0]
+}
+
+func (x MType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use MType.Descriptor instead.
+func (MType) EnumDescriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{0}
+}
+
+type Metric struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type  MType                  `protobuf:"varint,2,opt,name=type,proto3,enum=yupi.metrics.MType" json:"type,omitempty"`
+	// delta - значение counter
+	Delta int64 `protobuf:"varint,3,opt,name=delta,proto3" json:"delta,omitempty"`
+	// value - значение gauge
+	Value         float64           `protobuf:"fixed64,4,opt,name=value,proto3" json:"value,omitempty"`
+	Labels        map[string]string `protobuf:"bytes,5,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Metric) Reset() {
+	*x = Metric{}
+	mi := &file_metrics_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Metric) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Metric) ProtoMessage() {}
+
+func (x *Metric) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Metric.ProtoReflect.Descriptor instead.
+func (*Metric) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Metric) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Metric) GetType() MType {
+	if x != nil {
+		return x.Type
+	}
+	return MType_MTYPE_UNSPECIFIED
+}
+
+func (x *Metric) GetDelta() int64 {
+	if x != nil {
+		return x.Delta
+	}
+	return 0
+}
+
+func (x *Metric) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *Metric) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+type UpdateMetricRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metric        *Metric                `protobuf:"bytes,1,opt,name=metric,proto3" json:"metric,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateMetricRequest) Reset() {
+	*x = UpdateMetricRequest{}
+	mi := &file_metrics_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateMetricRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateMetricRequest) ProtoMessage() {}
+
+func (x *UpdateMetricRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateMetricRequest.ProtoReflect.Descriptor instead.
+func (*UpdateMetricRequest) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UpdateMetricRequest) GetMetric() *Metric {
+	if x != nil {
+		return x.Metric
+	}
+	return nil
+}
+
+type UpdateMetricResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metric        *Metric                `protobuf:"bytes,1,opt,name=metric,proto3" json:"metric,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateMetricResponse) Reset() {
+	*x = UpdateMetricResponse{}
+	mi := &file_metrics_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateMetricResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateMetricResponse) ProtoMessage() {}
+
+func (x *UpdateMetricResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateMetricResponse.ProtoReflect.Descriptor instead.
+func (*UpdateMetricResponse) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *UpdateMetricResponse) GetMetric() *Metric {
+	if x != nil {
+		return x.Metric
+	}
+	return nil
+}
+
+type UpdateMetricsRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Metrics []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	// hash - подпись HMAC-SHA256 сообщения с пустым hash, ставится интерцептором клиента
+	Hash          string `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateMetricsRequest) Reset() {
+	*x = UpdateMetricsRequest{}
+	mi := &file_metrics_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateMetricsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateMetricsRequest) ProtoMessage() {}
+
+func (x *UpdateMetricsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateMetricsRequest.ProtoReflect.Descriptor instead.
+func (*UpdateMetricsRequest) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *UpdateMetricsRequest) GetMetrics() []*Metric {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *UpdateMetricsRequest) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+type UpdateMetricsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Updated       int64                  `protobuf:"varint,1,opt,name=updated,proto3" json:"updated,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateMetricsResponse) Reset() {
+	*x = UpdateMetricsResponse{}
+	mi := &file_metrics_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateMetricsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateMetricsResponse) ProtoMessage() {}
+
+func (x *UpdateMetricsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateMetricsResponse.ProtoReflect.Descriptor instead.
+func (*UpdateMetricsResponse) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *UpdateMetricsResponse) GetUpdated() int64 {
+	if x != nil {
+		return x.Updated
+	}
+	return 0
+}
+
+type GetMetricRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type          MType                  `protobuf:"varint,2,opt,name=type,proto3,enum=yupi.metrics.MType" json:"type,omitempty"`
+	Labels        map[string]string      `protobuf:"bytes,3,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMetricRequest) Reset() {
+	*x = GetMetricRequest{}
+	mi := &file_metrics_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMetricRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMetricRequest) ProtoMessage() {}
+
+func (x *GetMetricRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMetricRequest.ProtoReflect.Descriptor instead.
+func (*GetMetricRequest) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetMetricRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *GetMetricRequest) GetType() MType {
+	if x != nil {
+		return x.Type
+	}
+	return MType_MTYPE_UNSPECIFIED
+}
+
+func (x *GetMetricRequest) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+type GetMetricResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metric        *Metric                `protobuf:"bytes,1,opt,name=metric,proto3" json:"metric,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetMetricResponse) Reset() {
+	*x = GetMetricResponse{}
+	mi := &file_metrics_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetMetricResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetMetricResponse) ProtoMessage() {}
+
+func (x *GetMetricResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetMetricResponse.ProtoReflect.Descriptor instead.
+func (*GetMetricResponse) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetMetricResponse) GetMetric() *Metric {
+	if x != nil {
+		return x.Metric
+	}
+	return nil
+}
+
+type ListMetricsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListMetricsRequest) Reset() {
+	*x = ListMetricsRequest{}
+	mi := &file_metrics_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListMetricsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListMetricsRequest) ProtoMessage() {}
+
+func (x *ListMetricsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListMetricsRequest.ProtoReflect.Descriptor instead.
+func (*ListMetricsRequest) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{7}
+}
+
+type ListMetricsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metrics       []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListMetricsResponse) Reset() {
+	*x = ListMetricsResponse{}
+	mi := &file_metrics_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListMetricsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListMetricsResponse) ProtoMessage() {}
+
+func (x *ListMetricsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListMetricsResponse.ProtoReflect.Descriptor instead.
+func (*ListMetricsResponse) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListMetricsResponse) GetMetrics() []*Metric {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+var File_metrics_proto protoreflect.FileDescriptor
+
+const file_metrics_proto_rawDesc = "" +
+	"\n" +
+	"\rmetrics.proto\x12\fyupi.metrics\"\xe2\x01\n" +
+	"\x06Metric\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12'\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x13.yupi.metrics.MTypeR\x04type\x12\x14\n" +
+	"\x05delta\x18\x03 \x01(\x03R\x05delta\x12\x14\n" +
+	"\x05value\x18\x04 \x01(\x01R\x05value\x128\n" +
+	"\x06labels\x18\x05 \x03(\v2 .yupi.metrics.Metric.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"C\n" +
+	"\x13UpdateMetricRequest\x12,\n" +
+	"\x06metric\x18\x01 \x01(\v2\x14.yupi.metrics.MetricR\x06metric\"D\n" +
+	"\x14UpdateMetricResponse\x12,\n" +
+	"\x06metric\x18\x01 \x01(\v2\x14.yupi.metrics.MetricR\x06metric\"Z\n" +
+	"\x14UpdateMetricsRequest\x12.\n" +
+	"\ametrics\x18\x01 \x03(\v2\x14.yupi.metrics.MetricR\ametrics\x12\x12\n" +
+	"\x04hash\x18\x02 \x01(\tR\x04hash\"1\n" +
+	"\x15UpdateMetricsResponse\x12\x18\n" +
+	"\aupdated\x18\x01 \x01(\x03R\aupdated\"\xca\x01\n" +
+	"\x10GetMetricRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12'\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x13.yupi.metrics.MTypeR\x04type\x12B\n" +
+	"\x06labels\x18\x03 \x03(\v2*.yupi.metrics.GetMetricRequest.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"A\n" +
+	"\x11GetMetricResponse\x12,\n" +
+	"\x06metric\x18\x01 \x01(\v2\x14.yupi.metrics.MetricR\x06metric\"\x14\n" +
+	"\x12ListMetricsRequest\"E\n" +
+	"\x13ListMetricsResponse\x12.\n" +
+	"\ametrics\x18\x01 \x03(\v2\x14.yupi.metrics.MetricR\ametrics*6\n" +
+	"\x05MType\x12\x15\n" +
+	"\x11MTYPE_UNSPECIFIED\x10\x00\x12\t\n" +
+	"\x05GAUGE\x10\x01\x12\v\n" +
+	"\aCOUNTER\x10\x022\xde\x02\n" +
+	"\aMetrics\x12U\n" +
+	"\fUpdateMetric\x12!.yupi.metrics.UpdateMetricRequest\x1a\".yupi.metrics.UpdateMetricResponse\x12Z\n" +
+	"\rUpdateMetrics\x12\".yupi.metrics.UpdateMetricsRequest\x1a#.yupi.metrics.UpdateMetricsResponse(\x01\x12L\n" +
+	"\tGetMetric\x12\x1e.yupi.metrics.GetMetricRequest\x1a\x1f.yupi.metrics.GetMetricResponse\x12R\n" +
+	"\vListMetrics\x12 .yupi.metrics.ListMetricsRequest\x1a!.yupi.metrics.ListMetricsResponseB\x15Z\x13yupi/internal/protob\x06proto3"
+
+var (
+	file_metrics_proto_rawDescOnce sync.Once
+	file_metrics_proto_rawDescData []byte
+)
+
+func file_metrics_proto_rawDescGZIP() []byte {
+	file_metrics_proto_rawDescOnce.Do(func() {
+		file_metrics_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_metrics_proto_rawDesc), len(file_metrics_proto_rawDesc)))
+	})
+	return file_metrics_proto_rawDescData
+}
+
+var file_metrics_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_metrics_proto_goTypes = []any{
+	(MType)(0),                    // 0: yupi.metrics.MType
+	(*Metric)(nil),                // 1: yupi.metrics.Metric
+	(*UpdateMetricRequest)(nil),   // 2: yupi.metrics.UpdateMetricRequest
+	(*UpdateMetricResponse)(nil),  // 3: yupi.metrics.UpdateMetricResponse
+	(*UpdateMetricsRequest)(nil),  // 4: yupi.metrics.UpdateMetricsRequest
+	(*UpdateMetricsResponse)(nil), // 5: yupi.metrics.UpdateMetricsResponse
+	(*GetMetricRequest)(nil),      // 6: yupi.metrics.GetMetricRequest
+	(*GetMetricResponse)(nil),     // 7: yupi.metrics.GetMetricResponse
+	(*ListMetricsRequest)(nil),    // 8: yupi.metrics.ListMetricsRequest
+	(*ListMetricsResponse)(nil),   // 9: yupi.metrics.ListMetricsResponse
+	nil,                           // 10: yupi.metrics.Metric.LabelsEntry
+	nil,                           // 11: yupi.metrics.GetMetricRequest.LabelsEntry
+}
+var file_metrics_proto_depIdxs = []int32{
+	0,  // 0: yupi.metrics.Metric.type:type_name -> yupi.metrics.MType
+	10, // 1: yupi.metrics.Metric.labels:type_name -> yupi.metrics.Metric.LabelsEntry
+	1,  // 2: yupi.metrics.UpdateMetricRequest.metric:type_name -> yupi.metrics.Metric
+	1,  // 3: yupi.metrics.UpdateMetricResponse.metric:type_name -> yupi.metrics.Metric
+	1,  // 4: yupi.metrics.UpdateMetricsRequest.metrics:type_name -> yupi.metrics.Metric
+	0,  // 5: yupi.metrics.GetMetricRequest.type:type_name -> yupi.metrics.MType
+	11, // 6: yupi.metrics.GetMetricRequest.labels:type_name -> yupi.metrics.GetMetricRequest.LabelsEntry
+	1,  // 7: yupi.metrics.GetMetricResponse.metric:type_name -> yupi.metrics.Metric
+	1,  // 8: yupi.metrics.ListMetricsResponse.metrics:type_name -> yupi.metrics.Metric
+	2,  // 9: yupi.metrics.Metrics.UpdateMetric:input_type -> yupi.metrics.UpdateMetricRequest
+	4,  // 10: yupi.metrics.Metrics.UpdateMetrics:input_type -> yupi.metrics.UpdateMetricsRequest
+	6,  // 11: yupi.metrics.Metrics.GetMetric:input_type -> yupi.metrics.GetMetricRequest
+	8,  // 12: yupi.metrics.Metrics.ListMetrics:input_type -> yupi.metrics.ListMetricsRequest
+	3,  // 13: yupi.metrics.Metrics.UpdateMetric:output_type -> yupi.metrics.UpdateMetricResponse
+	5,  // 14: yupi.metrics.Metrics.UpdateMetrics:output_type -> yupi.metrics.UpdateMetricsResponse
+	7,  // 15: yupi.metrics.Metrics.GetMetric:output_type -> yupi.metrics.GetMetricResponse
+	9,  // 16: yupi.metrics.Metrics.ListMetrics:output_type -> yupi.metrics.ListMetricsResponse
+	13, // [13:17] is the sub-list for method output_type
+	9,  // [9:13] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_metrics_proto_init() }
+func file_metrics_proto_init() {
+	if File_metrics_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_metrics_proto_rawDesc), len(file_metrics_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_metrics_proto_goTypes,
+		DependencyIndexes: file_metrics_proto_depIdxs,
+		EnumInfos:         file_metrics_proto_enumTypes,
+		MessageInfos:      file_metrics_proto_msgTypes,
+	}.Build()
+	File_metrics_proto = out.File
+	file_metrics_proto_goTypes = nil
+	file_metrics_proto_depIdxs = nil
+}
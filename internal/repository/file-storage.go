@@ -1,78 +1,405 @@
 package repository
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"yupi/internal/config"
+	"yupi/internal/domain/metrics"
+	"yupi/internal/httptransport/middlewares"
 )
 
+var ErrChecksumMismatch = errors.New("контрольная сумма снимка не совпадает")
+
 // StorageData структура для сериализации данных
 type StorageData struct {
-	Gauges   map[string]float64 `json:"gauges"`
-	Counters map[string]int64   `json:"counters"`
+	// Gauges - значения gauge, NaN и бесконечности пишутся строками
+	Gauges   map[string]metrics.Float `json:"gauges"`
+	Counters map[string]int64         `json:"counters"`
+	// WALSeq - номер последней записи журнала, вошедшей в снимок
+	WALSeq uint64 `json:"wal_seq,omitempty"`
+	// State - состояние других подсистем сервера по именам разделов
+	State map[string]json.RawMessage `json:"state,omitempty"`
+}
+
+// StateSection - состояние подсистемы сервера, например тишины оповещений,
+// которое сохраняется в снимке вместе с метриками
+type StateSection interface {
+	SnapshotState() (json.RawMessage, error)
+	RestoreState(data json.RawMessage) error
+}
+
+// snapshotFile - формат файла снимка: данные и их контрольная сумма sha256
+type snapshotFile struct {
+	Checksum string          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
 }
 
+// FileStorage - хранилище в памяти с возможностью сохранения снимка в файл
+// и необязательным журналом обновлений между снимками
 type FileStorage struct {
-	memStorage *MemStorage
+	*MemStorage
+	// mu упорядочивает запись в журнал и обновление памяти и исключает их на время снимка
+	mu  sync.Mutex
+	wal *WAL
+	// restoredSeq - номер последней записи журнала в восстановленном снимке
+	restoredSeq uint64
+	sections    map[string]StateSection
+	// restoredState - разделы снимка, для которых еще не зарегистрирован владелец
+	restoredState map[string]json.RawMessage
 }
 
 func NewFileStorage(storage *MemStorage) *FileStorage {
 	return &FileStorage{
-		memStorage: storage,
+		MemStorage: storage,
+	}
+}
+
+// RegisterState - добавляет раздел состояния в снимки. Если раздел уже загружен
+// из снимка, он сразу восстанавливается, поэтому регистрировать можно и после LoadFromFile
+func (fs *FileStorage) RegisterState(name string, section StateSection) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.sections == nil {
+		fs.sections = make(map[string]StateSection)
+	}
+	if _, ok := fs.sections[name]; ok {
+		return fmt.Errorf("state section %s already registered", name)
+	}
+	fs.sections[name] = section
+
+	if data, ok := fs.restoredState[name]; ok {
+		delete(fs.restoredState, name)
+		if err := section.RestoreState(data); err != nil {
+			return fmt.Errorf("не удалось восстановить раздел %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// OpenWAL - включает журнал обновлений, каждое обновление сначала пишется в журнал
+func (fs *FileStorage) OpenWAL(path string, syncEach bool) error {
+	wal, err := OpenWAL(path, syncEach)
+	if err != nil {
+		return err
 	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.wal = wal
+	return nil
 }
 
+// UpdateGauge - обновление метрики типа gauge с записью в журнал
+func (fs *FileStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	return fs.UpdateBatch(ctx, []metrics.Metrics{{ID: name, MType: metrics.TypeGauge, Value: &value}})
+}
+
+// UpdateCounter - обновление метрики типа counter с записью в журнал
+func (fs *FileStorage) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	return fs.UpdateBatch(ctx, []metrics.Metrics{{ID: name, MType: metrics.TypeCounter, Delta: &delta}})
+}
+
+// UpdateBatch - пишет пакет в журнал и только потом применяет его в памяти
+func (fs *FileStorage) UpdateBatch(ctx context.Context, batch []metrics.Metrics) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.wal != nil {
+		if _, err := fs.wal.Append(batch); err != nil {
+			return err
+		}
+	}
+
+	return fs.MemStorage.UpdateBatch(ctx, batch)
+}
+
+// ReplayWAL - применяет записи журнала, которых нет в восстановленном снимке
+func (fs *FileStorage) ReplayWAL() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.wal == nil {
+		return nil
+	}
+
+	// Новые записи должны получить номера больше вошедших в снимок
+	fs.wal.advance(fs.restoredSeq)
+
+	return fs.wal.Replay(fs.restoredSeq, func(batch []metrics.Metrics) error {
+		return fs.MemStorage.UpdateBatch(context.Background(), batch)
+	})
+}
+
+// Close - закрывает журнал, если он включен
+func (fs *FileStorage) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.wal == nil {
+		return nil
+	}
+	return fs.wal.Close()
+}
+
+// SaveToFile - атомарно записывает снимок: временный файл, fsync, ротация старых снимков, rename.
+// На время записи обновления блокируются, после записи журнал очищается.
 func (fs *FileStorage) SaveToFile(config config.ServerConfig) error {
-	data := StorageData{
-		Gauges:   fs.memStorage.GetAllGauges(),
-		Counters: make(map[string]int64),
+	ctx := context.Background()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	gauges, err := fs.GetAllGauges(ctx)
+	if err != nil {
+		return err
+	}
+
+	counters, err := fs.GetAllCounters(ctx)
+	if err != nil {
+		return err
 	}
 
-	// Получаем все counters (нужно добавить метод GetAllCounters в MemStorage)
-	fs.memStorage.mu.RLock()
-	for k, v := range fs.memStorage.counters {
-		data.Counters[k] = v
+	var walSeq uint64
+	if fs.wal != nil {
+		walSeq = fs.wal.Seq()
 	}
-	fs.memStorage.mu.RUnlock()
 
-	fileData, err := json.Marshal(data)
+	state := make(map[string]json.RawMessage, len(fs.sections))
+	for name, section := range fs.sections {
+		if state[name], err = section.SnapshotState(); err != nil {
+			return fmt.Errorf("не удалось сохранить раздел %s: %w", name, err)
+		}
+	}
+
+	snapshotGauges := make(map[string]metrics.Float, len(gauges))
+	for name, value := range gauges {
+		snapshotGauges[name] = metrics.Float(value)
+	}
+
+	data, err := json.Marshal(StorageData{
+		Gauges:   snapshotGauges,
+		Counters: counters,
+		WALSeq:   walSeq,
+		State:    state,
+	})
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	fileData, err := json.Marshal(snapshotFile{
+		Checksum: hex.EncodeToString(sum[:]),
+		Data:     data,
+	})
 	if err != nil {
 		return err
 	}
 
 	// Создаем директорию если нужно
-	if err := os.MkdirAll(filepath.Dir(config.FileStoragePath), 0755); err != nil {
+	dir := filepath.Dir(config.FileStoragePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("не удалось создать директорию: %w", err)
 	}
 
-	return os.WriteFile(config.FileStoragePath, fileData, 0644)
+	tmpPath, err := writeTempFile(dir, filepath.Base(config.FileStoragePath), fileData)
+	if err != nil {
+		return err
+	}
+
+	if err := rotateSnapshots(config.FileStoragePath, config.SnapshotKeep); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, config.FileStoragePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("не удалось переименовать снимок: %w", err)
+	}
+
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+
+	// Снимок на диске, записи журнала до walSeq больше не нужны.
+	// Если упадем до очистки, при восстановлении они будут пропущены по номеру.
+	if fs.wal != nil {
+		return fs.wal.Truncate()
+	}
+
+	return nil
 }
 
+// LoadFromFile - загружает самый свежий корректный снимок, при повреждении откатывается на предыдущие
 func (fs *FileStorage) LoadFromFile(config config.ServerConfig) error {
-	fileData, err := os.ReadFile(config.FileStoragePath)
+	var firstErr error
+
+	for _, path := range snapshotPaths(config.FileStoragePath, config.SnapshotKeep) {
+		data, err := readSnapshot(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			middlewares.Log.Warn("Снимок метрик поврежден, пробуем предыдущий: " + err.Error())
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		return fs.restore(data)
+	}
+
+	// Если файлов нет совсем, это не ошибка при первом запуске
+	return firstErr
+}
+
+func (fs *FileStorage) restore(data StorageData) error {
+	ctx := context.Background()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// Обновляем данные в хранилище напрямую, минуя журнал
+	for name, value := range data.Gauges {
+		if err := fs.MemStorage.UpdateGauge(ctx, name, float64(value)); err != nil {
+			return err
+		}
+	}
+
+	for name, value := range data.Counters {
+		if err := fs.MemStorage.UpdateCounter(ctx, name, value); err != nil {
+			return err
+		}
+	}
+
+	fs.restoredSeq = data.WALSeq
+
+	for name, state := range data.State {
+		section, ok := fs.sections[name]
+		if !ok {
+			if fs.restoredState == nil {
+				fs.restoredState = make(map[string]json.RawMessage)
+			}
+			fs.restoredState[name] = state
+			continue
+		}
+		if err := section.RestoreState(state); err != nil {
+			return fmt.Errorf("не удалось восстановить раздел %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// readSnapshot - читает снимок и проверяет контрольную сумму.
+// Файлы старого формата (без контрольной суммы) читаются как есть.
+func readSnapshot(path string) (StorageData, error) {
+	var data StorageData
+
+	fileData, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			// Если файл не существует, это не ошибка при первом запуске
-			return nil
+			return data, err
 		}
-		return fmt.Errorf("ошибка чтения файла %s: %w", config.FileStoragePath, err)
+		return data, fmt.Errorf("ошибка чтения файла %s: %w", path, err)
 	}
 
-	var data StorageData
-	if err := json.Unmarshal(fileData, &data); err != nil {
-		return err
+	var snapshot snapshotFile
+	if err := json.Unmarshal(fileData, &snapshot); err != nil {
+		return data, fmt.Errorf("ошибка разбора файла %s: %w", path, err)
 	}
 
-	// Обновляем данные в хранилище
-	for name, value := range data.Gauges {
-		fs.memStorage.UpdateGauge(name, value)
+	payload := []byte(snapshot.Data)
+	if snapshot.Checksum == "" && len(payload) == 0 {
+		payload = fileData
+	} else {
+		sum := sha256.Sum256(payload)
+		if hex.EncodeToString(sum[:]) != snapshot.Checksum {
+			return data, fmt.Errorf("%s: %w", path, ErrChecksumMismatch)
+		}
 	}
 
-	for name, value := range data.Counters {
-		fs.memStorage.UpdateCounter(name, value)
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return data, fmt.Errorf("ошибка разбора файла %s: %w", path, err)
+	}
+
+	return data, nil
+}
+
+// snapshotPaths - пути снимков от самого нового к самому старому: path, path.1, ..., path.(keep-1)
+func snapshotPaths(path string, keep int) []string {
+	if keep < 1 {
+		keep = 1
+	}
+
+	paths := make([]string, 0, keep)
+	paths = append(paths, path)
+	for i := 1; i < keep; i++ {
+		paths = append(paths, fmt.Sprintf("%s.%d", path, i))
+	}
+	return paths
+}
+
+// rotateSnapshots - сдвигает старые снимки: path.(keep-2) -> path.(keep-1), ..., path -> path.1
+func rotateSnapshots(path string, keep int) error {
+	paths := snapshotPaths(path, keep)
+
+	for i := len(paths) - 1; i > 0; i-- {
+		if err := os.Rename(paths[i-1], paths[i]); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("не удалось сохранить предыдущий снимок: %w", err)
+		}
 	}
 
 	return nil
 }
+
+// writeTempFile - пишет данные во временный файл в той же директории и делает fsync
+func writeTempFile(dir, name string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, name+".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("не удалось создать временный файл: %w", err)
+	}
+
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("не удалось записать временный файл: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", fmt.Errorf("не удалось сбросить временный файл на диск: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// syncDir - сбрасывает на диск запись директории, чтобы переименование пережило падение
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
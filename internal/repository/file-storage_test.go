@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"yupi/internal/config"
+)
+
+func newTestFileConfig(t *testing.T) config.ServerConfig {
+	t.Helper()
+	return config.ServerConfig{
+		FileStoragePath: filepath.Join(t.TempDir(), "metrics-db.json"),
+		SnapshotKeep:    3,
+	}
+}
+
+func TestFileStorage_SaveAndLoad(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestFileConfig(t)
+
+	storage := NewFileStorage(NewMemStorage())
+	storage.UpdateGauge(ctx, "test_gauge", 42.5)
+	storage.UpdateCounter(ctx, "test_counter", 10)
+
+	if err := storage.SaveToFile(cfg); err != nil {
+		t.Fatalf("SaveToFile() ошибка %v", err)
+	}
+
+	restored := NewFileStorage(NewMemStorage())
+	if err := restored.LoadFromFile(cfg); err != nil {
+		t.Fatalf("LoadFromFile() ошибка %v", err)
+	}
+
+	if got, _, _ := restored.GetGauge(ctx, "test_gauge"); got != 42.5 {
+		t.Errorf("gauge = %v, ожидали 42.5", got)
+	}
+	if got, _, _ := restored.GetCounter(ctx, "test_counter"); got != 10 {
+		t.Errorf("counter = %v, ожидали 10", got)
+	}
+
+	// Временных файлов после записи оставаться не должно
+	matches, _ := filepath.Glob(cfg.FileStoragePath + ".tmp-*")
+	if len(matches) != 0 {
+		t.Errorf("Остались временные файлы: %v", matches)
+	}
+}
+
+func TestFileStorage_Rotation(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestFileConfig(t)
+	storage := NewFileStorage(NewMemStorage())
+
+	for i := 0; i < 5; i++ {
+		storage.UpdateCounter(ctx, "test_counter", 1)
+		if err := storage.SaveToFile(cfg); err != nil {
+			t.Fatalf("SaveToFile() ошибка %v", err)
+		}
+	}
+
+	for _, path := range snapshotPaths(cfg.FileStoragePath, cfg.SnapshotKeep) {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Снимок %s не найден: %v", path, err)
+		}
+	}
+
+	if _, err := os.Stat(cfg.FileStoragePath + ".3"); !os.IsNotExist(err) {
+		t.Error("Хранится больше снимков, чем задано в SnapshotKeep")
+	}
+}
+
+func TestFileStorage_LoadFallback(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestFileConfig(t)
+	storage := NewFileStorage(NewMemStorage())
+
+	storage.UpdateGauge(ctx, "test_gauge", 1.0)
+	if err := storage.SaveToFile(cfg); err != nil {
+		t.Fatalf("SaveToFile() ошибка %v", err)
+	}
+
+	storage.UpdateGauge(ctx, "test_gauge", 2.0)
+	if err := storage.SaveToFile(cfg); err != nil {
+		t.Fatalf("SaveToFile() ошибка %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"Обрезанный_файл", `{"checksum":"abc","data":{"gauges":`},
+		{"Неверная_контрольная_сумма", `{"checksum":"abc","data":{"gauges":{"test_gauge":3},"counters":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(cfg.FileStoragePath, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			restored := NewFileStorage(NewMemStorage())
+			if err := restored.LoadFromFile(cfg); err != nil {
+				t.Fatalf("LoadFromFile() ошибка %v", err)
+			}
+
+			// Последний снимок поврежден, поэтому ожидаем значение из предыдущего
+			if got, _, _ := restored.GetGauge(ctx, "test_gauge"); got != 1.0 {
+				t.Errorf("gauge = %v, ожидали 1.0 из предыдущего снимка", got)
+			}
+		})
+	}
+}
+
+func TestFileStorage_LoadLegacyFormat(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestFileConfig(t)
+
+	legacy := `{"gauges":{"test_gauge":42.5},"counters":{"test_counter":10}}`
+	if err := os.WriteFile(cfg.FileStoragePath, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	storage := NewFileStorage(NewMemStorage())
+	if err := storage.LoadFromFile(cfg); err != nil {
+		t.Fatalf("LoadFromFile() ошибка %v", err)
+	}
+
+	if got, _, _ := storage.GetCounter(ctx, "test_counter"); got != 10 {
+		t.Errorf("counter = %v, ожидали 10", got)
+	}
+}
+
+// testSection - раздел состояния из одной строки
+type testSection struct {
+	value string
+}
+
+func (s *testSection) SnapshotState() (json.RawMessage, error) {
+	return json.Marshal(s.value)
+}
+
+func (s *testSection) RestoreState(data json.RawMessage) error {
+	return json.Unmarshal(data, &s.value)
+}
+
+func TestFileStorage_StateSections(t *testing.T) {
+	cfg := newTestFileConfig(t)
+
+	storage := NewFileStorage(NewMemStorage())
+	if err := storage.RegisterState("silences", &testSection{value: "saved"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.RegisterState("silences", &testSection{}); err == nil {
+		t.Error("RegisterState() должен отклонить повторную регистрацию")
+	}
+	if err := storage.SaveToFile(cfg); err != nil {
+		t.Fatalf("SaveToFile() ошибка %v", err)
+	}
+
+	t.Run("Регистрация_до_загрузки", func(t *testing.T) {
+		section := &testSection{}
+		restored := NewFileStorage(NewMemStorage())
+		restored.RegisterState("silences", section) //nolint:errcheck
+		if err := restored.LoadFromFile(cfg); err != nil {
+			t.Fatalf("LoadFromFile() ошибка %v", err)
+		}
+		if section.value != "saved" {
+			t.Errorf("Раздел = %q, want saved", section.value)
+		}
+	})
+
+	t.Run("Регистрация_после_загрузки", func(t *testing.T) {
+		section := &testSection{}
+		restored := NewFileStorage(NewMemStorage())
+		if err := restored.LoadFromFile(cfg); err != nil {
+			t.Fatalf("LoadFromFile() ошибка %v", err)
+		}
+		if err := restored.RegisterState("silences", section); err != nil {
+			t.Fatal(err)
+		}
+		if section.value != "saved" {
+			t.Errorf("Раздел = %q, want saved", section.value)
+		}
+	})
+}
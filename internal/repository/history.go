@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+	"yupi/internal/domain/metrics"
+)
+
+// Sample - значение временного ряда в момент времени.
+// Для counter хранится накопленное значение после обновления.
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+type seriesID struct {
+	mType string
+	key   string
+}
+
+// queuedSample - точка в общей очереди истории
+type queuedSample struct {
+	id        seriesID
+	timestamp time.Time
+}
+
+// History - хранилище истории значений метрик в памяти
+// с окном хранения и ограничением на общее число точек
+type History struct {
+	mu     sync.Mutex
+	series map[seriesID][]Sample
+	// queue - все точки всех рядов в порядке добавления. Внутри ряда порядок тот же,
+	// поэтому начало очереди - всегда первая точка своего ряда, и самая старая точка
+	// удаляется за O(1) без обхода рядов
+	queue      []queuedSample
+	total      int
+	retention  time.Duration
+	maxSamples int
+	now        func() time.Time
+}
+
+// NewHistory - конструктор истории, maxSamples <= 0 снимает ограничение на число точек
+func NewHistory(retention time.Duration, maxSamples int) *History {
+	return &History{
+		series:     make(map[seriesID][]Sample),
+		retention:  retention,
+		maxSamples: maxSamples,
+		now:        time.Now,
+	}
+}
+
+// Append - добавляет точку в конец ряда и удаляет устаревшие
+func (h *History) Append(mType, key string, value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := h.now()
+	id := seriesID{mType: mType, key: key}
+	h.series[id] = append(h.series[id], Sample{Timestamp: now, Value: value})
+	h.queue = append(h.queue, queuedSample{id: id, timestamp: now})
+	h.total++
+
+	h.expire(now.Add(-h.retention))
+
+	for h.maxSamples > 0 && h.total > h.maxSamples {
+		h.evictOldest()
+	}
+}
+
+// Range - точки ряда в интервале [from, to]
+func (h *History) Range(mType, key string, from, to time.Time) []Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := h.series[seriesID{mType: mType, key: key}]
+	cutoff := h.now().Add(-h.retention)
+	if from.Before(cutoff) {
+		from = cutoff
+	}
+
+	// Точки упорядочены по времени, ищем границы бинарным поиском
+	start := sort.Search(len(samples), func(i int) bool { return !samples[i].Timestamp.Before(from) })
+	end := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp.After(to) })
+	if start >= end {
+		return []Sample{}
+	}
+
+	result := make([]Sample, end-start)
+	copy(result, samples[start:end])
+	return result
+}
+
+// Prune - удаляет устаревшие точки во всех рядах, в том числе в тех, что давно не обновлялись
+func (h *History) Prune() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.expire(h.now().Add(-h.retention))
+}
+
+// expire - удаляет точки старше cutoff с начала общей очереди
+func (h *History) expire(cutoff time.Time) {
+	for len(h.queue) > 0 && h.queue[0].timestamp.Before(cutoff) {
+		h.evictOldest()
+	}
+}
+
+// evictOldest - удаляет самую старую точку среди всех рядов
+func (h *History) evictOldest() {
+	if len(h.queue) == 0 {
+		return
+	}
+	oldest := h.queue[0].id
+	h.queue[0] = queuedSample{}
+	h.queue = h.queue[1:]
+
+	samples := h.series[oldest]
+	h.total--
+	if len(samples) <= 1 {
+		delete(h.series, oldest)
+		return
+	}
+	h.series[oldest] = samples[1:]
+}
+
+// historyStorage - обертка над хранилищем, которая записывает в историю каждое успешное обновление
+type historyStorage struct {
+	Storage
+	history *History
+}
+
+// WithHistory - возвращает хранилище, сохраняющее историю значений в history
+func WithHistory(storage Storage, history *History) Storage {
+	return &historyStorage{Storage: storage, history: history}
+}
+
+func (s *historyStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	if err := s.Storage.UpdateGauge(ctx, name, value); err != nil {
+		return err
+	}
+	s.history.Append(metrics.TypeGauge, name, value)
+	return nil
+}
+
+func (s *historyStorage) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	if err := s.Storage.UpdateCounter(ctx, name, delta); err != nil {
+		return err
+	}
+	s.recordCounter(ctx, name)
+	return nil
+}
+
+func (s *historyStorage) UpdateBatch(ctx context.Context, batch []metrics.Metrics) error {
+	if err := s.Storage.UpdateBatch(ctx, batch); err != nil {
+		return err
+	}
+
+	for _, m := range batch {
+		switch m.MType {
+		case metrics.TypeGauge:
+			s.history.Append(metrics.TypeGauge, m.Key(), *m.Value)
+		case metrics.TypeCounter:
+			s.recordCounter(ctx, m.Key())
+		}
+	}
+	return nil
+}
+
+// recordCounter - в историю counter пишем накопленное значение, а не приращение
+func (s *historyStorage) recordCounter(ctx context.Context, key string) {
+	total, ok, err := s.Storage.GetCounter(ctx, key)
+	if err != nil || !ok {
+		return
+	}
+	s.history.Append(metrics.TypeCounter, key, float64(total))
+}
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"yupi/internal/domain/metrics"
+)
+
+// fakeClock - управляемые часы для истории
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestHistory(retention time.Duration, maxSamples int) (*History, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := NewHistory(retention, maxSamples)
+	h.now = clock.now
+	return h, clock
+}
+
+func values(samples []Sample) []float64 {
+	result := make([]float64, len(samples))
+	for i, s := range samples {
+		result[i] = s.Value
+	}
+	return result
+}
+
+func equalValues(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHistory_Range(t *testing.T) {
+	h, clock := newTestHistory(time.Hour, 0)
+	start := clock.t
+
+	for i := 1; i <= 5; i++ {
+		h.Append(metrics.TypeGauge, "Alloc", float64(i))
+		clock.advance(time.Minute)
+	}
+	h.Append(metrics.TypeCounter, "Alloc", 100)
+
+	tests := []struct {
+		name string
+		from time.Time
+		to   time.Time
+		want []float64
+	}{
+		{"Весь_ряд", time.Time{}, clock.t, []float64{1, 2, 3, 4, 5}},
+		{"Границы_включаются", start.Add(time.Minute), start.Add(3 * time.Minute), []float64{2, 3, 4}},
+		{"Пустой_интервал", start.Add(10 * time.Minute), start.Add(20 * time.Minute), []float64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := values(h.Range(metrics.TypeGauge, "Alloc", tt.from, tt.to))
+			if !equalValues(got, tt.want) {
+				t.Errorf("Range() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Ряды_разных_типов_хранятся_раздельно", func(t *testing.T) {
+		got := values(h.Range(metrics.TypeCounter, "Alloc", time.Time{}, clock.t))
+		if !equalValues(got, []float64{100}) {
+			t.Errorf("Range() = %v, want [100]", got)
+		}
+	})
+}
+
+func TestHistory_Retention(t *testing.T) {
+	h, clock := newTestHistory(10*time.Minute, 0)
+
+	h.Append(metrics.TypeGauge, "Old", 1)
+	h.Append(metrics.TypeGauge, "Alloc", 1)
+	clock.advance(6 * time.Minute)
+	h.Append(metrics.TypeGauge, "Alloc", 2)
+	clock.advance(6 * time.Minute)
+	h.Append(metrics.TypeGauge, "Alloc", 3)
+
+	// При добавлении устаревшие точки ряда удаляются сразу
+	if got := values(h.Range(metrics.TypeGauge, "Alloc", time.Time{}, clock.t)); !equalValues(got, []float64{2, 3}) {
+		t.Errorf("Range() = %v, want [2 3]", got)
+	}
+
+	// Необновляемый ряд за окном не отдается, а Prune его удаляет
+	if got := h.Range(metrics.TypeGauge, "Old", time.Time{}, clock.t); len(got) != 0 {
+		t.Errorf("Range() для устаревшего ряда = %v, want []", got)
+	}
+	h.Prune()
+	if _, ok := h.series[seriesID{mType: metrics.TypeGauge, key: "Old"}]; ok {
+		t.Error("Prune() не удалил устаревший ряд")
+	}
+	if h.total != 2 {
+		t.Errorf("total = %d, want 2", h.total)
+	}
+}
+
+func TestHistory_MaxSamples(t *testing.T) {
+	h, clock := newTestHistory(time.Hour, 3)
+
+	h.Append(metrics.TypeGauge, "A", 1)
+	clock.advance(time.Second)
+	h.Append(metrics.TypeGauge, "B", 1)
+	clock.advance(time.Second)
+	h.Append(metrics.TypeGauge, "A", 2)
+	clock.advance(time.Second)
+	h.Append(metrics.TypeGauge, "B", 2)
+
+	// Вытесняется самая старая точка среди всех рядов
+	if got := values(h.Range(metrics.TypeGauge, "A", time.Time{}, clock.t)); !equalValues(got, []float64{2}) {
+		t.Errorf("Range(A) = %v, want [2]", got)
+	}
+	if got := values(h.Range(metrics.TypeGauge, "B", time.Time{}, clock.t)); !equalValues(got, []float64{1, 2}) {
+		t.Errorf("Range(B) = %v, want [1 2]", got)
+	}
+}
+
+func TestHistory_MaxSamplesManySeries(t *testing.T) {
+	h, clock := newTestHistory(time.Hour, 100)
+
+	// Точки по кругу в 50 рядах, после заполнения каждая новая вытесняет самую старую
+	for i := range 1000 {
+		h.Append(metrics.TypeGauge, fmt.Sprintf("S%d", i%50), float64(i))
+		clock.advance(time.Second)
+	}
+
+	if h.total != 100 || len(h.queue) != 100 {
+		t.Fatalf("total = %d, queue = %d, want 100", h.total, len(h.queue))
+	}
+	for i := range 50 {
+		got := values(h.Range(metrics.TypeGauge, fmt.Sprintf("S%d", i), time.Time{}, clock.t))
+		if want := []float64{float64(900 + i), float64(950 + i)}; !equalValues(got, want) {
+			t.Errorf("Range(S%d) = %v, want %v", i, got, want)
+		}
+	}
+
+	// Устаревание по сроку хранения идет по той же очереди
+	clock.advance(time.Hour - 25*time.Second)
+	h.Prune()
+	if h.total != 25 || len(h.series) != 25 {
+		t.Errorf("После Prune total = %d, рядов %d, want 25 и 25", h.total, len(h.series))
+	}
+}
+
+func TestWithHistory(t *testing.T) {
+	ctx := context.Background()
+	h, clock := newTestHistory(time.Hour, 0)
+	storage := WithHistory(NewMemStorage(), h)
+
+	storage.UpdateGauge(ctx, "Alloc", 1.5)
+	storage.UpdateCounter(ctx, "PollCount", 2)
+	value := 2.5
+	delta := int64(3)
+	err := storage.UpdateBatch(ctx, []metrics.Metrics{
+		{ID: "Alloc", MType: metrics.TypeGauge, Value: &value},
+		{ID: "PollCount", MType: metrics.TypeCounter, Delta: &delta, Labels: metrics.Labels{"host": "h1"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateBatch() error = %v", err)
+	}
+
+	if got := values(h.Range(metrics.TypeGauge, "Alloc", time.Time{}, clock.t)); !equalValues(got, []float64{1.5, 2.5}) {
+		t.Errorf("история Alloc = %v, want [1.5 2.5]", got)
+	}
+	// Для counter в истории накопленное значение
+	if got := values(h.Range(metrics.TypeCounter, "PollCount", time.Time{}, clock.t)); !equalValues(got, []float64{2}) {
+		t.Errorf("история PollCount = %v, want [2]", got)
+	}
+	if got := values(h.Range(metrics.TypeCounter, `PollCount{host="h1"}`, time.Time{}, clock.t)); !equalValues(got, []float64{3}) {
+		t.Errorf("история PollCount{host=h1} = %v, want [3]", got)
+	}
+}
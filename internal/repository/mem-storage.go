@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"sync"
 	"yupi/internal/domain/metrics"
 )
@@ -21,42 +22,48 @@ func NewMemStorage() *MemStorage {
 }
 
 // UpdateGauge - обновление метрики типа gauge
-func (s *MemStorage) UpdateGauge(name string, value float64) {
+func (s *MemStorage) UpdateGauge(_ context.Context, name string, value float64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.gauges[name] = value
-}
-
-func (s *MemStorage) UpdateGaugeV2(m *metrics.Metrics) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.gauges[m.ID] = *m.Value
+	return nil
 }
 
 // UpdateCounter - обновление метрики типа counter
-func (s *MemStorage) UpdateCounterV2(m *metrics.Metrics) {
+func (s *MemStorage) UpdateCounter(_ context.Context, name string, delta int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.counters[m.ID] += *m.Delta
+	s.counters[name] += delta
+	return nil
 }
 
-// UpdateCounter - обновление метрики типа counter
-func (s *MemStorage) UpdateCounter(name string, value int64) {
+// UpdateBatch - применяет пакет метрик под одной блокировкой
+func (s *MemStorage) UpdateBatch(_ context.Context, batch []metrics.Metrics) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.counters[name] += value
+
+	for _, m := range batch {
+		switch m.MType {
+		case metrics.TypeGauge:
+			s.gauges[m.Key()] = *m.Value
+		case metrics.TypeCounter:
+			s.counters[m.Key()] += *m.Delta
+		}
+	}
+
+	return nil
 }
 
 // GetGauge - получение значения gauge
-func (s *MemStorage) GetGauge(name string) (float64, bool) {
+func (s *MemStorage) GetGauge(_ context.Context, name string) (float64, bool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	val, ok := s.gauges[name]
-	return val, ok
+	return val, ok, nil
 }
 
 // GetAllGauges возвращает все gauge-метрики из хранилища
-func (s *MemStorage) GetAllGauges() map[string]float64 {
+func (s *MemStorage) GetAllGauges(_ context.Context) (map[string]float64, error) {
 	s.mu.RLock()         // Блокируем для чтения
 	defer s.mu.RUnlock() // Гарантируем разблокировку
 
@@ -66,13 +73,31 @@ func (s *MemStorage) GetAllGauges() map[string]float64 {
 		gaugesCopy[k] = v
 	}
 
-	return gaugesCopy
+	return gaugesCopy, nil
 }
 
 // GetCounter - получение значения counter
-func (s *MemStorage) GetCounter(name string) (int64, bool) {
+func (s *MemStorage) GetCounter(_ context.Context, name string) (int64, bool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	val, ok := s.counters[name]
-	return val, ok
+	return val, ok, nil
+}
+
+// GetAllCounters возвращает все counter-метрики из хранилища
+func (s *MemStorage) GetAllCounters(_ context.Context) (map[string]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	countersCopy := make(map[string]int64, len(s.counters))
+	for k, v := range s.counters {
+		countersCopy[k] = v
+	}
+
+	return countersCopy, nil
+}
+
+// Close - хранилищу в памяти нечего освобождать
+func (s *MemStorage) Close() error {
+	return nil
 }
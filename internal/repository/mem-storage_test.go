@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"testing"
 )
 
@@ -35,9 +36,9 @@ func TestMemStorage_UpdateGauge(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			storage.UpdateGauge(tt.name, tt.value)
+			storage.UpdateGauge(context.Background(), tt.name, tt.value)
 
-			got, exists := storage.GetGauge(tt.name)
+			got, exists, _ := storage.GetGauge(context.Background(), tt.name)
 			if !exists {
 				t.Errorf("Не удалось записать метрику %s с типом gauge", tt.name)
 			}
@@ -72,10 +73,10 @@ func TestMemStorage_UpdateCounter(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			for _, v := range tt.values {
-				storage.UpdateCounter(tt.name, v)
+				storage.UpdateCounter(context.Background(), tt.name, v)
 			}
 
-			got, exists := storage.GetCounter(tt.name)
+			got, exists, _ := storage.GetCounter(context.Background(), tt.name)
 			if !exists {
 				t.Errorf("Не удалось записать метрику %s с типом counter", tt.name)
 			}
@@ -98,11 +99,11 @@ func TestMemStorage_GetAllGauges(t *testing.T) {
 
 	// Заполняем хранилище тестовыми данными
 	for name, value := range testData {
-		storage.UpdateGauge(name, value)
+		storage.UpdateGauge(context.Background(), name, value)
 	}
 
 	// Получаем все метрики
-	gauges := storage.GetAllGauges()
+	gauges, _ := storage.GetAllGauges(context.Background())
 
 	// Проверяем количество метрик
 	if len(gauges) != len(testData) {
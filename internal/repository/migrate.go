@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// migrationTx - транзакция, в которой применяется одна миграция
+type migrationTx interface {
+	Exec(ctx context.Context, query string) error
+	QueryInt(ctx context.Context, query string) (int, error)
+}
+
+// runMigrations - применяет недостающие миграции, каждую в своей транзакции, номер версии равен индексу + 1.
+// inTx открывает транзакцию и при необходимости берет в ней блокировку от других экземпляров сервера,
+// поэтому версия схемы читается заново внутри каждой транзакции
+func runMigrations(ctx context.Context, migrations []string, inTx func(ctx context.Context, fn func(tx migrationTx) error) error) error {
+	for {
+		var done bool
+		var version int
+
+		err := inTx(ctx, func(tx migrationTx) error {
+			if err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+				return err
+			}
+
+			current, err := tx.QueryInt(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+			if err != nil {
+				return err
+			}
+			if current >= len(migrations) {
+				done = true
+				return nil
+			}
+
+			version = current + 1
+			if err := tx.Exec(ctx, migrations[current]); err != nil {
+				return err
+			}
+			return tx.Exec(ctx, fmt.Sprintf(`INSERT INTO schema_migrations (version) VALUES (%d)`, version))
+		})
+		if err != nil && version > 0 {
+			return fmt.Errorf("миграция %d: %w", version, err)
+		}
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
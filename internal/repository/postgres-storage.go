@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"yupi/internal/domain/metrics"
+)
+
+// postgresMigrations - миграции схемы, применяются по порядку, номер версии равен индексу + 1
+var postgresMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS gauges (
+		name  TEXT PRIMARY KEY,
+		value DOUBLE PRECISION NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS counters (
+		name  TEXT PRIMARY KEY,
+		value BIGINT NOT NULL
+	)`,
+}
+
+// PostgresStorage - хранилище метрик в PostgreSQL
+type PostgresStorage struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresStorage - подключается к БД и применяет миграции
+func NewPostgresStorage(ctx context.Context, dsn string) (*PostgresStorage, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось подключиться к БД: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("БД недоступна: %w", err)
+	}
+
+	s := &PostgresStorage{pool: pool}
+	if err := s.migrate(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("не удалось применить миграции: %w", err)
+	}
+
+	return s, nil
+}
+
+// postgresMigrationLock - ключ advisory-блокировки миграций, общий для всех экземпляров сервера
+const postgresMigrationLock = 7_236_001
+
+// migrate - применяет недостающие миграции. Экземпляры, запущенные одновременно,
+// ждут друг друга на advisory-блокировке и не применяют одну миграцию дважды
+func (s *PostgresStorage) migrate(ctx context.Context) error {
+	return runMigrations(ctx, postgresMigrations, func(ctx context.Context, fn func(tx migrationTx) error) error {
+		return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, postgresMigrationLock); err != nil {
+				return err
+			}
+			return fn(pgxMigrationTx{tx: tx})
+		})
+	})
+}
+
+// pgxMigrationTx - транзакция миграции поверх pgx
+type pgxMigrationTx struct {
+	tx pgx.Tx
+}
+
+func (t pgxMigrationTx) Exec(ctx context.Context, query string) error {
+	_, err := t.tx.Exec(ctx, query)
+	return err
+}
+
+func (t pgxMigrationTx) QueryInt(ctx context.Context, query string) (int, error) {
+	var value int
+	err := t.tx.QueryRow(ctx, query).Scan(&value)
+	return value, err
+}
+
+const (
+	postgresUpsertGauge = `
+		INSERT INTO gauges (name, value) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value`
+	postgresIncrementCounter = `
+		INSERT INTO counters (name, value) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET value = counters.value + EXCLUDED.value`
+)
+
+// UpdateGauge - обновление метрики типа gauge через upsert
+func (s *PostgresStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	_, err := s.pool.Exec(ctx, postgresUpsertGauge, name, value)
+	return err
+}
+
+// UpdateCounter - атомарное приращение метрики типа counter
+func (s *PostgresStorage) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	_, err := s.pool.Exec(ctx, postgresIncrementCounter, name, delta)
+	return err
+}
+
+// UpdateBatch - применяет пакет метрик в одной транзакции
+func (s *PostgresStorage) UpdateBatch(ctx context.Context, batch []metrics.Metrics) error {
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		b := &pgx.Batch{}
+		for _, m := range batch {
+			switch m.MType {
+			case metrics.TypeGauge:
+				b.Queue(postgresUpsertGauge, m.Key(), *m.Value)
+			case metrics.TypeCounter:
+				b.Queue(postgresIncrementCounter, m.Key(), *m.Delta)
+			}
+		}
+		return tx.SendBatch(ctx, b).Close()
+	})
+}
+
+// GetGauge - получение значения gauge
+func (s *PostgresStorage) GetGauge(ctx context.Context, name string) (float64, bool, error) {
+	var value float64
+	err := s.pool.QueryRow(ctx, `SELECT value FROM gauges WHERE name = $1`, name).Scan(&value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return value, true, nil
+}
+
+// GetCounter - получение значения counter
+func (s *PostgresStorage) GetCounter(ctx context.Context, name string) (int64, bool, error) {
+	var value int64
+	err := s.pool.QueryRow(ctx, `SELECT value FROM counters WHERE name = $1`, name).Scan(&value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return value, true, nil
+}
+
+// GetAllGauges возвращает все gauge-метрики из БД
+func (s *PostgresStorage) GetAllGauges(ctx context.Context) (map[string]float64, error) {
+	rows, err := s.pool.Query(ctx, `SELECT name, value FROM gauges`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	gauges := make(map[string]float64)
+	for rows.Next() {
+		var name string
+		var value float64
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		gauges[name] = value
+	}
+
+	return gauges, rows.Err()
+}
+
+// GetAllCounters возвращает все counter-метрики из БД
+func (s *PostgresStorage) GetAllCounters(ctx context.Context) (map[string]int64, error) {
+	rows, err := s.pool.Query(ctx, `SELECT name, value FROM counters`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counters := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var value int64
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		counters[name] = value
+	}
+
+	return counters, rows.Err()
+}
+
+// Close - закрывает пул соединений
+func (s *PostgresStorage) Close() error {
+	s.pool.Close()
+	return nil
+}
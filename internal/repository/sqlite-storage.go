@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+	"yupi/internal/domain/metrics"
+)
+
+// sqliteMigrations - миграции схемы, применяются по порядку, номер версии равен индексу + 1
+var sqliteMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS gauges (
+		name  TEXT PRIMARY KEY,
+		value REAL NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS counters (
+		name  TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	)`,
+	// SQLite хранит NaN как NULL, поэтому значение gauge допускает NULL, а чтение возвращает NULL как NaN.
+	// Ограничение столбца не меняется через ALTER TABLE, таблица пересоздается
+	`CREATE TABLE gauges_nullable (
+		name  TEXT PRIMARY KEY,
+		value REAL
+	);
+	INSERT INTO gauges_nullable (name, value) SELECT name, value FROM gauges;
+	DROP TABLE gauges;
+	ALTER TABLE gauges_nullable RENAME TO gauges`,
+}
+
+// SQLiteStorage - хранилище метрик во встроенной БД SQLite, каждая запись сразу попадает на диск
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+// NewSQLiteStorage - открывает (или создает) файл БД и применяет миграции
+func NewSQLiteStorage(ctx context.Context, path string) (*SQLiteStorage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("не удалось создать директорию: %w", err)
+	}
+
+	// WAL-журнал с synchronous=FULL: запись подтверждается только после fsync
+	dsn := "file:" + path + "?_pragma=journal_mode(WAL)&_pragma=synchronous(FULL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть БД %s: %w", path, err)
+	}
+
+	// SQLite допускает только одного писателя, поэтому не плодим соединения
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("БД %s недоступна: %w", path, err)
+	}
+
+	s := &SQLiteStorage{db: db}
+	if err := s.migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("не удалось применить миграции: %w", err)
+	}
+
+	return s, nil
+}
+
+// migrate - применяет недостающие миграции, каждую в своей транзакции
+func (s *SQLiteStorage) migrate(ctx context.Context) error {
+	return runMigrations(ctx, sqliteMigrations, func(ctx context.Context, fn func(tx migrationTx) error) error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback() //nolint:errcheck
+
+		if err := fn(sqlMigrationTx{tx: tx}); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// sqlMigrationTx - транзакция миграции поверх database/sql
+type sqlMigrationTx struct {
+	tx *sql.Tx
+}
+
+func (t sqlMigrationTx) Exec(ctx context.Context, query string) error {
+	_, err := t.tx.ExecContext(ctx, query)
+	return err
+}
+
+func (t sqlMigrationTx) QueryInt(ctx context.Context, query string) (int, error) {
+	var value int
+	err := t.tx.QueryRowContext(ctx, query).Scan(&value)
+	return value, err
+}
+
+const (
+	sqliteUpsertGauge = `
+		INSERT INTO gauges (name, value) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = excluded.value`
+	sqliteIncrementCounter = `
+		INSERT INTO counters (name, value) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = counters.value + excluded.value`
+)
+
+// UpdateGauge - обновление метрики типа gauge через upsert
+func (s *SQLiteStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	_, err := s.db.ExecContext(ctx, sqliteUpsertGauge, name, value)
+	return err
+}
+
+// UpdateCounter - атомарное приращение метрики типа counter
+func (s *SQLiteStorage) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	_, err := s.db.ExecContext(ctx, sqliteIncrementCounter, name, delta)
+	return err
+}
+
+// UpdateBatch - применяет пакет метрик в одной транзакции
+func (s *SQLiteStorage) UpdateBatch(ctx context.Context, batch []metrics.Metrics) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	for _, m := range batch {
+		switch m.MType {
+		case metrics.TypeGauge:
+			_, err = tx.ExecContext(ctx, sqliteUpsertGauge, m.Key(), *m.Value)
+		case metrics.TypeCounter:
+			_, err = tx.ExecContext(ctx, sqliteIncrementCounter, m.Key(), *m.Delta)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetGauge - получение значения gauge
+func (s *SQLiteStorage) GetGauge(ctx context.Context, name string) (float64, bool, error) {
+	var value sql.NullFloat64
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM gauges WHERE name = ?`, name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return gaugeValue(value), true, nil
+}
+
+// gaugeValue - значение gauge из БД, NULL записывается SQLite вместо NaN
+func gaugeValue(value sql.NullFloat64) float64 {
+	if !value.Valid {
+		return math.NaN()
+	}
+	return value.Float64
+}
+
+// GetCounter - получение значения counter
+func (s *SQLiteStorage) GetCounter(ctx context.Context, name string) (int64, bool, error) {
+	var value int64
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM counters WHERE name = ?`, name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return value, true, nil
+}
+
+// GetAllGauges возвращает все gauge-метрики из БД
+func (s *SQLiteStorage) GetAllGauges(ctx context.Context) (map[string]float64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, value FROM gauges`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	gauges := make(map[string]float64)
+	for rows.Next() {
+		var name string
+		var value sql.NullFloat64
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		gauges[name] = gaugeValue(value)
+	}
+
+	return gauges, rows.Err()
+}
+
+// GetAllCounters возвращает все counter-метрики из БД
+func (s *SQLiteStorage) GetAllCounters(ctx context.Context) (map[string]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, value FROM counters`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counters := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var value int64
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		counters[name] = value
+	}
+
+	return counters, rows.Err()
+}
+
+// Close - закрывает БД
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
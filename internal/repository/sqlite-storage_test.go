@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"yupi/internal/domain/metrics"
+)
+
+func TestSQLiteStorage_Persistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.db")
+
+	storage, err := NewSQLiteStorage(ctx, path)
+	if err != nil {
+		t.Fatalf("Не удалось открыть БД: %v", err)
+	}
+
+	if err := storage.UpdateGauge(ctx, "test_gauge", 1.5); err != nil {
+		t.Fatalf("Не удалось записать gauge: %v", err)
+	}
+	if err := storage.UpdateGauge(ctx, "test_gauge", 42.5); err != nil {
+		t.Fatalf("Не удалось перезаписать gauge: %v", err)
+	}
+	for _, delta := range []int64{1, 2, 3} {
+		if err := storage.UpdateCounter(ctx, "test_counter", delta); err != nil {
+			t.Fatalf("Не удалось записать counter: %v", err)
+		}
+	}
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Не удалось закрыть БД: %v", err)
+	}
+
+	// Открываем заново: данные должны быть на месте без какого-либо восстановления
+	storage, err = NewSQLiteStorage(ctx, path)
+	if err != nil {
+		t.Fatalf("Не удалось переоткрыть БД: %v", err)
+	}
+	defer storage.Close()
+
+	gauge, exists, err := storage.GetGauge(ctx, "test_gauge")
+	if err != nil || !exists || gauge != 42.5 {
+		t.Errorf("gauge = %v (exists=%v, err=%v), ожидали 42.5", gauge, exists, err)
+	}
+
+	counter, exists, err := storage.GetCounter(ctx, "test_counter")
+	if err != nil || !exists || counter != 6 {
+		t.Errorf("counter = %v (exists=%v, err=%v), ожидали 6", counter, exists, err)
+	}
+
+	if _, exists, _ := storage.GetGauge(ctx, "nonexistent"); exists {
+		t.Error("Несуществующая метрика найдена")
+	}
+
+	gauges, err := storage.GetAllGauges(ctx)
+	if err != nil || len(gauges) != 1 {
+		t.Errorf("GetAllGauges() = %v, err=%v, ожидали одну метрику", gauges, err)
+	}
+}
+
+func TestSQLiteStorage_NonFiniteGauges(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewSQLiteStorage(ctx, filepath.Join(t.TempDir(), "metrics.db"))
+	if err != nil {
+		t.Fatalf("Не удалось открыть БД: %v", err)
+	}
+	defer storage.Close()
+
+	if err := storage.UpdateGauge(ctx, "nan", math.NaN()); err != nil {
+		t.Fatalf("UpdateGauge(NaN) error = %v", err)
+	}
+	inf, negInf := math.Inf(1), math.Inf(-1)
+	batch := []metrics.Metrics{
+		{ID: "inf", MType: metrics.TypeGauge, Value: &inf},
+		{ID: "neg_inf", MType: metrics.TypeGauge, Value: &negInf},
+	}
+	if err := storage.UpdateBatch(ctx, batch); err != nil {
+		t.Fatalf("UpdateBatch() error = %v", err)
+	}
+
+	if value, exists, err := storage.GetGauge(ctx, "nan"); err != nil || !exists || !math.IsNaN(value) {
+		t.Errorf("GetGauge(nan) = %v (exists=%v, err=%v), ожидали NaN", value, exists, err)
+	}
+
+	gauges, err := storage.GetAllGauges(ctx)
+	if err != nil {
+		t.Fatalf("GetAllGauges() error = %v", err)
+	}
+	if !math.IsNaN(gauges["nan"]) || !math.IsInf(gauges["inf"], 1) || !math.IsInf(gauges["neg_inf"], -1) {
+		t.Errorf("GetAllGauges() = %v, ожидали NaN, +Inf и -Inf", gauges)
+	}
+}
+
+func TestSQLiteStorage_MigratesExistingGauges(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.db")
+
+	// БД со схемой до миграции, которая разрешила NULL в значениях gauge
+	storage, err := NewSQLiteStorage(ctx, path)
+	if err != nil {
+		t.Fatalf("Не удалось открыть БД: %v", err)
+	}
+	if _, err := storage.db.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = 3`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.db.ExecContext(ctx, `DROP TABLE gauges; CREATE TABLE gauges (name TEXT PRIMARY KEY, value REAL NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.UpdateGauge(ctx, "old", 1.5); err != nil {
+		t.Fatal(err)
+	}
+	storage.Close()
+
+	storage, err = NewSQLiteStorage(ctx, path)
+	if err != nil {
+		t.Fatalf("Не удалось переоткрыть БД: %v", err)
+	}
+	defer storage.Close()
+
+	if value, exists, _ := storage.GetGauge(ctx, "old"); !exists || value != 1.5 {
+		t.Errorf("GetGauge(old) = %v (exists=%v), ожидали 1.5 после миграции", value, exists)
+	}
+	if err := storage.UpdateGauge(ctx, "nan", math.NaN()); err != nil {
+		t.Errorf("UpdateGauge(NaN) после миграции error = %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"yupi/internal/config"
+	"yupi/internal/domain/metrics"
+)
+
+const (
+	StorageTypeMemory   = "memory"
+	StorageTypeFile     = "file"
+	StorageTypePostgres = "postgres"
+	StorageTypeSQLite   = "sqlite"
+)
+
+// Storage - общий интерфейс хранилища метрик, его реализуют все бэкенды (память, файл, БД).
+// name - ключ временного ряда (metrics.SeriesKey): имя метрики вместе с метками.
+type Storage interface {
+	// UpdateGauge - записывает значение метрики типа gauge
+	UpdateGauge(ctx context.Context, name string, value float64) error
+	// UpdateCounter - прибавляет delta к метрике типа counter
+	UpdateCounter(ctx context.Context, name string, delta int64) error
+	// UpdateBatch - атомарно применяет пакет проверенных метрик: либо все, либо ни одной
+	UpdateBatch(ctx context.Context, batch []metrics.Metrics) error
+	// GetGauge - возвращает значение gauge и признак его наличия
+	GetGauge(ctx context.Context, name string) (float64, bool, error)
+	// GetCounter - возвращает значение counter и признак его наличия
+	GetCounter(ctx context.Context, name string) (int64, bool, error)
+	// GetAllGauges - возвращает копию всех gauge-метрик
+	GetAllGauges(ctx context.Context) (map[string]float64, error)
+	// GetAllCounters - возвращает копию всех counter-метрик
+	GetAllCounters(ctx context.Context) (map[string]int64, error)
+	// Close - освобождает ресурсы хранилища
+	Close() error
+}
+
+// NewStorage - создает хранилище в зависимости от настроек сервера
+func NewStorage(ctx context.Context, cfg config.ServerConfig) (Storage, error) {
+	switch cfg.StorageType {
+	case StorageTypeMemory:
+		return NewMemStorage(), nil
+	case StorageTypeFile, "":
+		fileStorage := NewFileStorage(NewMemStorage())
+		if cfg.WALPath != "" {
+			if err := fileStorage.OpenWAL(cfg.WALPath, cfg.WALSync); err != nil {
+				return nil, err
+			}
+		}
+		return fileStorage, nil
+	case StorageTypePostgres:
+		if cfg.DatabaseDSN == "" {
+			return nil, fmt.Errorf("для хранилища %s нужен DATABASE_DSN", cfg.StorageType)
+		}
+		return NewPostgresStorage(ctx, cfg.DatabaseDSN)
+	case StorageTypeSQLite:
+		return NewSQLiteStorage(ctx, cfg.SQLitePath)
+	default:
+		return nil, fmt.Errorf("неизвестный тип хранилища: %s", cfg.StorageType)
+	}
+}
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"yupi/internal/domain/metrics"
+)
+
+// walRecord - запись журнала: пакет метрик, применяемый целиком.
+// Запись без метрик - заголовок очищенного журнала, хранит номер последней записи до очистки
+type walRecord struct {
+	Seq     uint64      `json:"seq"`
+	Metrics []walMetric `json:"metrics"`
+}
+
+// walMetric - метрика в записи журнала. Поля те же, что у metrics.Metrics,
+// но значение gauge кодируется через metrics.Float, чтобы NaN и бесконечности пережили журнал
+type walMetric struct {
+	ID     string         `json:"id"`
+	MType  string         `json:"type"`
+	Delta  *int64         `json:"delta,omitempty"`
+	Value  *metrics.Float `json:"value,omitempty"`
+	Labels metrics.Labels `json:"labels,omitempty"`
+}
+
+func newWALMetrics(batch []metrics.Metrics) []walMetric {
+	records := make([]walMetric, len(batch))
+	for i, m := range batch {
+		records[i] = walMetric{ID: m.ID, MType: m.MType, Delta: m.Delta, Labels: m.Labels}
+		if m.Value != nil {
+			value := metrics.Float(*m.Value)
+			records[i].Value = &value
+		}
+	}
+	return records
+}
+
+func (r walRecord) batch() []metrics.Metrics {
+	batch := make([]metrics.Metrics, len(r.Metrics))
+	for i, m := range r.Metrics {
+		batch[i] = metrics.Metrics{ID: m.ID, MType: m.MType, Delta: m.Delta, Labels: m.Labels}
+		if m.Value != nil {
+			value := float64(*m.Value)
+			batch[i].Value = &value
+		}
+	}
+	return batch
+}
+
+// WAL - журнал упреждающей записи обновлений метрик между снимками.
+// Каждая запись - одна строка JSON, недописанный хвост после падения отбрасывается при открытии.
+type WAL struct {
+	mu       sync.Mutex
+	file     *os.File
+	seq      uint64
+	syncEach bool
+}
+
+// OpenWAL - открывает журнал, находит последний номер записи и обрезает поврежденный хвост
+func OpenWAL(path string, syncEach bool) (*WAL, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("не удалось создать директорию: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть журнал %s: %w", path, err)
+	}
+
+	w := &WAL{file: file, syncEach: syncEach}
+
+	var lastSeq uint64
+	validSize, err := w.scan(func(r walRecord) error {
+		lastSeq = r.Seq
+		return nil
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w.seq = lastSeq
+
+	if err := file.Truncate(validSize); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("не удалось обрезать журнал: %w", err)
+	}
+	if _, err := file.Seek(validSize, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Append - дописывает пакет метрик в журнал и возвращает его номер
+func (w *WAL) Append(batch []metrics.Metrics) (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	record := walRecord{Seq: w.seq + 1, Metrics: newWALMetrics(batch)}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return 0, err
+	}
+	line = append(line, '\n')
+
+	// Одна запись - один вызов write, так строка не перемешается с другими
+	if _, err := w.file.Write(line); err != nil {
+		return 0, fmt.Errorf("не удалось записать в журнал: %w", err)
+	}
+
+	if w.syncEach {
+		if err := w.file.Sync(); err != nil {
+			return 0, fmt.Errorf("не удалось сбросить журнал на диск: %w", err)
+		}
+	}
+
+	w.seq = record.Seq
+	return record.Seq, nil
+}
+
+// Seq - номер последней записи журнала
+func (w *WAL) Seq() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.seq
+}
+
+// Replay - вызывает fn для каждой записи с номером больше after
+func (w *WAL) Replay(after uint64, fn func(batch []metrics.Metrics) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err := w.scan(func(r walRecord) error {
+		if r.Seq <= after || len(r.Metrics) == 0 {
+			return nil
+		}
+		return fn(r.batch())
+	})
+	return err
+}
+
+// advance - продолжает нумерацию не ниже seq, нужен, если журнал потерян, а снимок новее него
+func (w *WAL) advance(seq uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq = max(w.seq, seq)
+}
+
+// Truncate - очищает журнал после успешного снимка, нумерация записей продолжается.
+// В начало пишется заголовок с текущим номером, иначе после перезапуска нумерация
+// начнется с нуля и новые записи будут пропущены как уже вошедшие в снимок
+func (w *WAL) Truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("не удалось очистить журнал: %w", err)
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	header, err := json.Marshal(walRecord{Seq: w.seq})
+	if err != nil {
+		return err
+	}
+	if _, err := w.file.Write(append(header, '\n')); err != nil {
+		return fmt.Errorf("не удалось записать заголовок журнала: %w", err)
+	}
+	return w.file.Sync()
+}
+
+// Close - сбрасывает журнал на диск и закрывает файл
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// scan - читает журнал с начала и возвращает размер корректной части файла.
+// Чтение останавливается на первой недописанной или поврежденной строке.
+func (w *WAL) scan(fn func(r walRecord) error) (int64, error) {
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	// Возвращаем позицию в конец журнала, чтобы следующие записи дописывались
+	defer w.file.Seek(0, io.SeekEnd) //nolint:errcheck
+
+	reader := bufio.NewReader(w.file)
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// Строка без перевода строки - запись оборвалась на середине
+			return offset, nil
+		}
+		if err != nil {
+			return offset, fmt.Errorf("ошибка чтения журнала: %w", err)
+		}
+
+		var record walRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &record); err != nil {
+			return offset, nil
+		}
+
+		if err := fn(record); err != nil {
+			return offset, err
+		}
+		offset += int64(len(line))
+	}
+}
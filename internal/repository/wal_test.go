@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"yupi/internal/domain/metrics"
+)
+
+func TestWAL_TornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.wal")
+
+	wal, err := OpenWAL(path, false)
+	if err != nil {
+		t.Fatalf("OpenWAL() ошибка %v", err)
+	}
+	delta := int64(1)
+	for i := 0; i < 3; i++ {
+		if _, err := wal.Append([]metrics.Metrics{{ID: "test_counter", MType: metrics.TypeCounter, Delta: &delta}}); err != nil {
+			t.Fatalf("Append() ошибка %v", err)
+		}
+	}
+	wal.Close()
+
+	// Имитируем падение посреди записи
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"seq":4,"metrics":[{"id":"test_counter"`)
+	f.Close()
+
+	wal, err = OpenWAL(path, false)
+	if err != nil {
+		t.Fatalf("OpenWAL() ошибка %v", err)
+	}
+	defer wal.Close()
+
+	if wal.Seq() != 3 {
+		t.Errorf("Seq() = %d, ожидали 3", wal.Seq())
+	}
+
+	var replayed int
+	wal.Replay(1, func(batch []metrics.Metrics) error {
+		replayed++
+		return nil
+	})
+	if replayed != 2 {
+		t.Errorf("Применено %d записей после первой, ожидали 2", replayed)
+	}
+
+	// После обрезки хвоста новые записи дописываются корректно
+	if seq, err := wal.Append([]metrics.Metrics{{ID: "test_counter", MType: metrics.TypeCounter, Delta: &delta}}); err != nil || seq != 4 {
+		t.Errorf("Append() = %d, %v, ожидали 4", seq, err)
+	}
+}
+
+func TestFileStorage_WALRecovery(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestFileConfig(t)
+	walPath := filepath.Join(filepath.Dir(cfg.FileStoragePath), "metrics.wal")
+
+	storage := NewFileStorage(NewMemStorage())
+	if err := storage.OpenWAL(walPath, false); err != nil {
+		t.Fatalf("OpenWAL() ошибка %v", err)
+	}
+
+	storage.UpdateCounter(ctx, "test_counter", 5)
+	if err := storage.SaveToFile(cfg); err != nil {
+		t.Fatalf("SaveToFile() ошибка %v", err)
+	}
+
+	// Обновления после снимка есть только в журнале
+	storage.UpdateCounter(ctx, "test_counter", 2)
+	storage.UpdateGauge(ctx, "test_gauge", 42.5)
+
+	// Имитируем падение после записи снимка, но до очистки журнала
+	walCopy, _ := os.ReadFile(walPath)
+	if err := storage.SaveToFile(cfg); err != nil {
+		t.Fatalf("SaveToFile() ошибка %v", err)
+	}
+	os.WriteFile(walPath, walCopy, 0644)
+	storage.UpdateCounter(ctx, "test_counter", 3)
+	storage.Close()
+
+	restored := NewFileStorage(NewMemStorage())
+	if err := restored.OpenWAL(walPath, false); err != nil {
+		t.Fatalf("OpenWAL() ошибка %v", err)
+	}
+	defer restored.Close()
+
+	if err := restored.LoadFromFile(cfg); err != nil {
+		t.Fatalf("LoadFromFile() ошибка %v", err)
+	}
+	if err := restored.ReplayWAL(); err != nil {
+		t.Fatalf("ReplayWAL() ошибка %v", err)
+	}
+
+	// 5 + 2 из снимка, 3 из журнала; записи, уже вошедшие в снимок, повторно не применяются
+	if got, _, _ := restored.GetCounter(ctx, "test_counter"); got != 10 {
+		t.Errorf("counter = %v, ожидали 10", got)
+	}
+	if got, _, _ := restored.GetGauge(ctx, "test_gauge"); got != 42.5 {
+		t.Errorf("gauge = %v, ожидали 42.5", got)
+	}
+}
+
+func TestFileStorage_WALRestartThenCrash(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestFileConfig(t)
+	walPath := filepath.Join(filepath.Dir(cfg.FileStoragePath), "metrics.wal")
+
+	open := func() *FileStorage {
+		storage := NewFileStorage(NewMemStorage())
+		if err := storage.OpenWAL(walPath, false); err != nil {
+			t.Fatalf("OpenWAL() ошибка %v", err)
+		}
+		if err := storage.LoadFromFile(cfg); err != nil {
+			t.Fatalf("LoadFromFile() ошибка %v", err)
+		}
+		if err := storage.ReplayWAL(); err != nil {
+			t.Fatalf("ReplayWAL() ошибка %v", err)
+		}
+		return storage
+	}
+
+	storage := open()
+	for range 3 {
+		storage.UpdateCounter(ctx, "test_counter", 1)
+	}
+	if err := storage.SaveToFile(cfg); err != nil {
+		t.Fatalf("SaveToFile() ошибка %v", err)
+	}
+	storage.Close()
+
+	// После перезапуска журнал пуст, новые записи должны получить номера после снимка
+	storage = open()
+	storage.UpdateCounter(ctx, "test_counter", 1)
+	storage.UpdateCounter(ctx, "test_counter", 1)
+	storage.Close()
+
+	// Падение без снимка: обновления есть только в журнале
+	restored := open()
+	if got, _, _ := restored.GetCounter(ctx, "test_counter"); got != 5 {
+		t.Errorf("counter = %v, ожидали 5", got)
+	}
+
+	// Без файла журнала нумерация продолжается с номера из снимка
+	restored.Close()
+	os.Remove(walPath)
+	storage = open()
+	storage.UpdateCounter(ctx, "test_counter", 1)
+	storage.Close()
+	restored = open()
+	defer restored.Close()
+	if got, _, _ := restored.GetCounter(ctx, "test_counter"); got != 4 {
+		t.Errorf("counter без журнала = %v, ожидали 4", got)
+	}
+}
+
+func TestFileStorage_WALNonFiniteGauges(t *testing.T) {
+	ctx := context.Background()
+	walPath := filepath.Join(t.TempDir(), "metrics.wal")
+
+	storage := NewFileStorage(NewMemStorage())
+	if err := storage.OpenWAL(walPath, false); err != nil {
+		t.Fatalf("OpenWAL() ошибка %v", err)
+	}
+	want := map[string]float64{"nan": math.NaN(), "inf": math.Inf(1), "neg_inf": math.Inf(-1), "finite": 1.5}
+	for name, value := range want {
+		if err := storage.UpdateGauge(ctx, name, value); err != nil {
+			t.Fatalf("UpdateGauge(%s) ошибка %v", name, err)
+		}
+	}
+	storage.Close()
+
+	restored := NewFileStorage(NewMemStorage())
+	if err := restored.OpenWAL(walPath, false); err != nil {
+		t.Fatalf("OpenWAL() ошибка %v", err)
+	}
+	defer restored.Close()
+	if err := restored.ReplayWAL(); err != nil {
+		t.Fatalf("ReplayWAL() ошибка %v", err)
+	}
+
+	for name, value := range want {
+		got, exists, _ := restored.GetGauge(ctx, name)
+		if !exists || (got != value && !(math.IsNaN(got) && math.IsNaN(value))) {
+			t.Errorf("gauge %s = %v (exists=%v), ожидали %v", name, got, exists, value)
+		}
+	}
+}
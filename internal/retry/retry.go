@@ -0,0 +1,100 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Backoff - параметры повторов с экспоненциальной задержкой и случайным разбросом
+type Backoff struct {
+	// Attempts - всего попыток, включая первую
+	Attempts int
+	// Initial - задержка перед вторым вызовом
+	Initial time.Duration
+	// Max - верхняя граница задержки
+	Max time.Duration
+	// Multiplier - во сколько раз растет задержка
+	Multiplier float64
+}
+
+// DefaultBackoff - три попытки с задержками около 1 и 2 секунд
+var DefaultBackoff = Backoff{Attempts: 3, Initial: time.Second, Max: 30 * time.Second, Multiplier: 2}
+
+// Delay - задержка перед попыткой attempt+1. Случайна в диапазоне [d/2, d), чтобы агенты,
+// потерявшие сервер одновременно, не приходили к нему снова все разом
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := float64(b.Initial)
+	for i := 0; i < attempt; i++ {
+		d *= b.Multiplier
+		if d >= float64(b.Max) {
+			d = float64(b.Max)
+			break
+		}
+	}
+	if d <= 0 {
+		return 0
+	}
+
+	half := d / 2
+	return time.Duration(half + rand.Float64()*half)
+}
+
+// Do - вызывает fn, пока она возвращает повторяемую ошибку и не исчерпаны попытки.
+// Возвращает последнюю ошибку fn или ошибку контекста, если он отменен во время ожидания
+func Do(ctx context.Context, b Backoff, fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = fn(); err == nil || !Retriable(err) || attempt+1 >= b.Attempts {
+			return err
+		}
+
+		timer := time.NewTimer(b.Delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// temporaryError - ошибка, которую транспорт явно пометил как повторяемую
+type temporaryError struct {
+	err error
+}
+
+func (e *temporaryError) Error() string { return e.err.Error() }
+
+func (e *temporaryError) Unwrap() error { return e.err }
+
+// Temporary - помечает ошибку как повторяемую, например ответ 5xx или gRPC Unavailable
+func Temporary(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &temporaryError{err: err}
+}
+
+// Retriable - имеет ли смысл повторить вызов: сервер недоступен, соединение сброшено,
+// истек таймаут или транспорт пометил ошибку как временную
+func Retriable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var temporary *temporaryError
+	if errors.As(err, &temporary) {
+		return true
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
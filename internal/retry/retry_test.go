@@ -0,0 +1,115 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetriable(t *testing.T) {
+	// Адрес закрытого сервера дает connection refused
+	server := httptest.NewServer(http.NotFoundHandler())
+	addr := server.URL
+	server.Close()
+	_, refused := http.Get(addr)
+
+	client := &http.Client{Timeout: time.Nanosecond}
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer slow.Close()
+	_, timeout := client.Get(slow.URL)
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Соединение_отклонено", refused, true},
+		{"Таймаут", timeout, true},
+		{"Временная_ошибка", fmt.Errorf("send: %w", Temporary(errors.New("status 503"))), true},
+		{"Постоянная_ошибка", errors.New("status 400"), false},
+		{"Нет_ошибки", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retriable(tt.err); got != tt.want {
+				t.Errorf("Retriable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{Attempts: 5, Initial: 100 * time.Millisecond, Max: 300 * time.Millisecond, Multiplier: 2}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{2, 300 * time.Millisecond},
+		{10, 300 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("Попытка_%d", tt.attempt), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if d := b.Delay(tt.attempt); d < tt.max/2 || d >= tt.max {
+					t.Fatalf("Delay(%d) = %v, want [%v, %v)", tt.attempt, d, tt.max/2, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	b := Backoff{Attempts: 3, Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 2}
+	temporary := Temporary(errors.New("unavailable"))
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"Успех_с_первой_попытки", []error{nil}, 1, false},
+		{"Успех_после_временных_ошибок", []error{temporary, temporary, nil}, 3, false},
+		{"Попытки_исчерпаны", []error{temporary, temporary, temporary, nil}, 3, true},
+		{"Постоянная_ошибка_не_повторяется", []error{errors.New("bad request"), nil}, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Do(context.Background(), b, func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("Отмена_контекста_прерывает_ожидание", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		long := Backoff{Attempts: 3, Initial: time.Hour, Max: time.Hour, Multiplier: 2}
+
+		err := Do(ctx, long, func() error { return temporary })
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Do() error = %v, want context.Canceled", err)
+		}
+	})
+}
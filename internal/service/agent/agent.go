@@ -3,24 +3,37 @@ package agent
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
 	"net/http"
-	"runtime"
+	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"yupi/internal/domain/metrics"
+	"yupi/internal/encryption"
+	"yupi/internal/netutil"
 	"yupi/internal/repository"
+	"yupi/internal/retry"
+	"yupi/internal/service/agent/collector"
+	"yupi/internal/signature"
 )
 
 const (
 	TypeGauge   = "gauge"
 	TypeCounter = "counter"
-	MetricCount = "PollCount"
-	UpdateURL   = "update"
+	MetricCount = collector.PollCount
+	UpdatesURL  = "updates"
+
+	// DefaultFlushTimeout - время на финальную отправку метрик при остановке агента
+	DefaultFlushTimeout = 5 * time.Second
 )
 
 type Agent struct {
@@ -28,168 +41,547 @@ type Agent struct {
 	serverURL      string
 	pollInterval   int64
 	reportInterval int64
-	storage        *repository.MemStorage
+	storage        repository.Storage
 	useGzip        bool
+	labels         metrics.Labels
+	key            string
+	publicKey      *rsa.PublicKey
+	client         *http.Client
+	transport      Transport
+	backoff        retry.Backoff
+	spool          *Spool
+	collectors     []*registeredCollector
+	rateLimit      int
+	flushTimeout   time.Duration
+	// realIP - адрес интерфейса, через который агент ходит к серверу, пустой, если его не удалось определить
+	realIP string
+	// reportedMu защищает reported - значения счетчиков, уже переданные на сервер.
+	// Сервер суммирует Delta, поэтому агент отправляет только приращение с прошлой отправки
+	reportedMu sync.Mutex
+	reported   map[string]int64
 }
 
-// Конструктор
-func NewAgent(serverURL string, pollInterval int64, reportInterval int64, useGzip bool) *Agent {
+// report - пакет для отправки и приращения счетчиков, которые он переносит
+type report struct {
+	batch []metrics.Metrics
+	// keys - ключи рядов в хранилище агента по порядку пакета
+	keys   []string
+	deltas map[string]int64
+}
+
+// split - делит пакет на n частей примерно поровну, каждая со своими приращениями счетчиков.
+// Ряд попадает только в одну часть, поэтому части можно отправлять одновременно
+func (r report) split(n int) []report {
+	if n <= 1 || len(r.batch) <= 1 {
+		return []report{r}
+	}
+
+	size := (len(r.batch) + n - 1) / n
+	parts := make([]report, 0, n)
+	for start := 0; start < len(r.batch); start += size {
+		end := min(start+size, len(r.batch))
+		part := report{batch: r.batch[start:end], keys: r.keys[start:end], deltas: make(map[string]int64)}
+		for i, m := range part.batch {
+			if delta, ok := r.deltas[part.keys[i]]; ok && m.MType == TypeCounter {
+				part.deltas[part.keys[i]] = delta
+			}
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// errSpooled - пакет не отправлен, но сохранен в очереди и будет отправлен позже
+var errSpooled = errors.New("batch spooled")
+
+var (
+	// ErrDuplicateCollector - сборщик с таким именем уже зарегистрирован
+	ErrDuplicateCollector = errors.New("collector already registered")
+	// ErrUnknownCollector - сборщик с таким именем не зарегистрирован
+	ErrUnknownCollector = errors.New("unknown collector")
+)
 
-	return &Agent{
+// registeredCollector - сборщик агента со своим интервалом опроса
+type registeredCollector struct {
+	collector collector.Collector
+	interval  time.Duration
+	enabled   atomic.Bool
+}
+
+// Transport - альтернативный способ доставки пакета метрик на сервер, например gRPC
+type Transport interface {
+	SendMetrics(ctx context.Context, batch []metrics.Metrics) error
+}
+
+// Option - необязательная настройка агента
+type Option func(a *Agent)
+
+// WithLabels - метки, которые агент добавляет ко всем отправляемым метрикам
+func WithLabels(labels metrics.Labels) Option {
+	return func(a *Agent) {
+		a.labels = labels
+	}
+}
+
+// WithKey - общий с сервером ключ, которым подписываются запросы
+func WithKey(key string) Option {
+	return func(a *Agent) {
+		a.key = key
+	}
+}
+
+// WithPublicKey - открытый ключ сервера, которым шифруется тело запросов
+func WithPublicKey(key *rsa.PublicKey) Option {
+	return func(a *Agent) {
+		a.publicKey = key
+	}
+}
+
+// WithTLS - отправка по https с указанными настройками TLS: доверенные центры
+// сертификации сервера и клиентский сертификат для mTLS
+func WithTLS(cfg *tls.Config) Option {
+	return func(a *Agent) {
+		a.protocol = "https"
+		a.client.Transport = &http.Transport{TLSClientConfig: cfg}
+	}
+}
+
+// WithTransport - отправка пакетов через transport вместо HTTP
+func WithTransport(transport Transport) Option {
+	return func(a *Agent) {
+		a.transport = transport
+	}
+}
+
+// WithBackoff - параметры повторов отправки
+func WithBackoff(backoff retry.Backoff) Option {
+	return func(a *Agent) {
+		a.backoff = backoff
+	}
+}
+
+// WithSpool - очередь на диске для пакетов, которые не удалось отправить
+func WithSpool(spool *Spool) Option {
+	return func(a *Agent) {
+		a.spool = spool
+	}
+}
+
+// WithRateLimit - максимум одновременных запросов к серверу
+func WithRateLimit(limit int) Option {
+	return func(a *Agent) {
+		if limit > 0 {
+			a.rateLimit = limit
+		}
+	}
+}
+
+// WithFlushTimeout - сколько при остановке ждать завершения отправок и финальной отправки метрик
+func WithFlushTimeout(timeout time.Duration) Option {
+	return func(a *Agent) {
+		a.flushTimeout = timeout
+	}
+}
+
+// WithCollector - регистрирует дополнительный сборщик, нулевой interval означает интервал опроса агента
+func WithCollector(c collector.Collector, interval time.Duration) Option {
+	return func(a *Agent) {
+		if err := a.Register(c, interval); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// Конструктор
+func NewAgent(serverURL string, pollInterval int64, reportInterval int64, useGzip bool, opts ...Option) *Agent {
+	a := &Agent{
 		protocol:       "http",
 		serverURL:      serverURL,
 		pollInterval:   pollInterval,
 		reportInterval: reportInterval,
 		storage:        repository.NewMemStorage(),
 		useGzip:        useGzip,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		backoff:      retry.DefaultBackoff,
+		rateLimit:    1,
+		flushTimeout: DefaultFlushTimeout,
+		reported:     make(map[string]int64),
+	}
+
+	// Метрики рантайма агент собирает всегда, их можно только выключить
+	a.Register(collector.NewRuntime(), 0) //nolint:errcheck
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	if a.transport == nil {
+		a.realIP = outboundIP(a.serverURL)
+	}
+
+	return a
+}
+
+// Register - добавляет сборщик. Имена сборщиков уникальны, нулевой interval означает
+// интервал опроса агента. Регистрировать сборщики нужно до запуска Run
+func (a *Agent) Register(c collector.Collector, interval time.Duration) error {
+	for _, rc := range a.collectors {
+		if rc.collector.Name() == c.Name() {
+			return fmt.Errorf("%w: %s", ErrDuplicateCollector, c.Name())
+		}
+	}
+
+	if interval <= 0 {
+		interval = time.Duration(a.pollInterval) * time.Second
+	}
+
+	rc := &registeredCollector{collector: c, interval: interval}
+	rc.enabled.Store(true)
+	a.collectors = append(a.collectors, rc)
+	return nil
+}
+
+// SetEnabled - включает или выключает сборщик по имени, можно вызывать во время работы агента
+func (a *Agent) SetEnabled(name string, enabled bool) error {
+	rc := a.findCollector(name)
+	if rc == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownCollector, name)
+	}
+	rc.enabled.Store(enabled)
+	return nil
+}
+
+// SetInterval - меняет интервал опроса сборщика, действует только до запуска Run
+func (a *Agent) SetInterval(name string, interval time.Duration) error {
+	rc := a.findCollector(name)
+	if rc == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownCollector, name)
 	}
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval %v for collector %s", interval, name)
+	}
+	rc.interval = interval
+	return nil
+}
+
+func (a *Agent) findCollector(name string) *registeredCollector {
+	for _, rc := range a.collectors {
+		if rc.collector.Name() == name {
+			return rc
+		}
+	}
+	return nil
 }
 
-func (a *Agent) Run() {
-	pollTicker := time.NewTicker(time.Duration(a.pollInterval) * time.Second)
+// Run - каждый сборщик опрашивается в своей горутине со своим интервалом.
+// По интервалу отправки снимок хранилища уходит в канал отправителю, поэтому медленный
+// сервер не тормозит сбор метрик. Снимки отправляются по одному, чтобы значение gauge
+// из старого снимка не пришло на сервер после нового, а снимок делится на rateLimit
+// частей, которые отправляются одновременно.
+// После отмены ctx агент останавливает сборщики, дожидается начатых отправок и
+// отправляет накопленные метрики. Ошибка означает, что последний пакет не доставлен
+func (a *Agent) Run(ctx context.Context) error {
+	var collectors sync.WaitGroup
+	for _, rc := range a.collectors {
+		collectors.Add(1)
+		go func() {
+			defer collectors.Done()
+			a.runCollector(ctx, rc)
+		}()
+	}
+
+	// Отправки не прерываются вместе с ctx: при остановке у них есть flushTimeout, чтобы завершиться
+	sendCtx, cancelSend := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelSend()
+
+	reports := make(chan report)
+	sender := a.startSender(sendCtx, reports)
+
 	reportTicker := time.NewTicker(time.Duration(a.reportInterval) * time.Second)
-	defer func() {
-		pollTicker.Stop()
-		reportTicker.Stop()
-	}()
+	defer reportTicker.Stop()
 
-	for {
+	for ctx.Err() == nil {
 		select {
-		case <-pollTicker.C:
-			a.aggregateMetrics()
+		case <-ctx.Done():
 		case <-reportTicker.C:
-			if err := a.reportMetrics(); err != nil {
+			r, err := a.snapshot()
+			if err != nil {
 				fmt.Printf("Error reporting metrics: %v\n", err)
+				continue
+			}
+			if len(r.batch) == 0 {
+				continue
+			}
+			// Если предыдущий снимок еще в пути, ждем его доставки: сборщики при этом продолжают работать.
+			// Неотправленный при остановке снимок не теряется, метрики уйдут в финальном пакете
+			select {
+			case reports <- r:
+			case <-ctx.Done():
+				a.restoreDeltas(r.deltas)
 			}
 		}
 	}
+
+	collectors.Wait()
+	close(reports)
+
+	flushCtx, cancel := context.WithTimeout(sendCtx, a.flushTimeout)
+	defer cancel()
+	stop := context.AfterFunc(flushCtx, cancelSend)
+	defer stop()
+
+	sender.Wait()
+	return a.flush(flushCtx)
 }
 
-// Агрегирование метрик
-func (a *Agent) aggregateMetrics() {
-	var stats runtime.MemStats
-
-	runtime.ReadMemStats(&stats)
-	metricList := map[string]interface{}{
-		"Alloc":         float64(stats.Alloc),
-		"BuckHashSys":   float64(stats.BuckHashSys),
-		"Frees":         float64(stats.Frees),
-		"GCCPUFraction": stats.GCCPUFraction,
-		"GCSys":         float64(stats.GCSys),
-		"HeapAlloc":     float64(stats.HeapAlloc),
-		"HeapIdle":      float64(stats.HeapIdle),
-		"HeapInuse":     float64(stats.HeapInuse),
-		"HeapObjects":   float64(stats.HeapObjects),
-		"HeapReleased":  float64(stats.HeapReleased),
-		"HeapSys":       float64(stats.HeapSys),
-		"LastGC":        float64(stats.LastGC),
-		"Lookups":       float64(stats.Lookups),
-		"MCacheInuse":   float64(stats.MCacheInuse),
-		"MCacheSys":     float64(stats.MCacheSys),
-		"MSpanInuse":    float64(stats.MSpanInuse),
-		"MSpanSys":      float64(stats.MSpanSys),
-		"Mallocs":       float64(stats.Mallocs),
-		"NextGC":        float64(stats.NextGC),
-		"NumForcedGC":   float64(stats.NumForcedGC),
-		"NumGC":         float64(stats.NumGC),
-		"OtherSys":      float64(stats.OtherSys),
-		"PauseTotalNs":  float64(stats.PauseTotalNs),
-		"StackInuse":    float64(stats.StackInuse),
-		"StackSys":      float64(stats.StackSys),
-		"Sys":           float64(stats.Sys),
-		"TotalAlloc":    float64(stats.TotalAlloc),
-		"RandomValue":   rand.Float64(),
-	}
-
-	for k, v := range metricList {
-		a.storage.UpdateGauge(k, v.(float64))
-	}
-
-	a.storage.UpdateCounter("PollCount", 1)
-}
-
-// Отправка всех метрик на сервер
-func (a *Agent) reportMetrics() error {
-
-	// Отправляем PollCount
-	count, exists := a.storage.GetCounter(MetricCount)
-	if exists {
-		if err := a.sendMetricJSON(TypeCounter, MetricCount, count); err != nil {
-			log.Println(err)
-			return err
+// flush - финальная отправка всего, что накопилось в хранилище агента
+func (a *Agent) flush(ctx context.Context) error {
+	r, err := a.snapshot()
+	if err != nil {
+		return err
+	}
+	if len(r.batch) == 0 {
+		return nil
+	}
+
+	if err := a.send(ctx, r); err != nil {
+		return fmt.Errorf("final flush failed: %w", err)
+	}
+	return nil
+}
+
+// startSender - запускает отправителя, который по порядку доставляет снимки из reports,
+// пока канал не закроют
+func (a *Agent) startSender(ctx context.Context, reports <-chan report) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for r := range reports {
+			if err := a.send(ctx, r); err != nil {
+				fmt.Printf("Error reporting metrics: %v\n", err)
+			}
+		}
+	}()
+	return &wg
+}
+
+func (a *Agent) runCollector(ctx context.Context, rc *registeredCollector) {
+	ticker := time.NewTicker(rc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.collect(ctx, rc)
 		}
 	}
+}
+
+// collect - опрашивает сборщик и складывает метрики в хранилище агента.
+// При частичной ошибке сохраняется то, что удалось собрать
+func (a *Agent) collect(ctx context.Context, rc *registeredCollector) {
+	if !rc.enabled.Load() {
+		return
+	}
+
+	sample, err := rc.collector.Collect(ctx)
+	if err != nil {
+		log.Printf("collector %s: %v", rc.collector.Name(), err)
+	}
 
-	// Отправляем все gauge метрики
-	for name, value := range a.storage.GetAllGauges() {
-		if err := a.sendMetricJSON(TypeGauge, name, value); err != nil {
+	for key, value := range sample.Gauges {
+		if err := a.storage.UpdateGauge(ctx, key, value); err != nil {
+			log.Println(err)
+		}
+	}
+	for key, delta := range sample.Counters {
+		if err := a.storage.UpdateCounter(ctx, key, delta); err != nil {
 			log.Println(err)
-			return err
 		}
 	}
-
-	return nil
 }
 
-// Отправка метрики на сервер
-func (a *Agent) sendMetric(metricType, metricName string, value interface{}) error {
-	url := fmt.Sprintf("%s/%s/%s/%s/%v", a.serverURL, UpdateURL, metricType, metricName, value)
+// snapshot - пакет из текущих значений gauge и приращений счетчиков с прошлой отправки.
+// Приращения сразу считаются отправленными, чтобы следующий снимок не повторил их,
+// пока этот пакет в пути. Если пакет не доставлен, их возвращает restoreDeltas
+func (a *Agent) snapshot() (report, error) {
+	ctx := context.Background()
 
-	// Добавляем http://, если URL не начинается с протокола, столкнулся с проблемой, что в тестах он добавляется, а в агенте нет из-за чего виснет запрос
-	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-		url = a.protocol + "://" + url
+	gauges, err := a.storage.GetAllGauges(ctx)
+	if err != nil {
+		return report{}, err
 	}
-	log.Println(url)
-	resp, err := http.Post(url, "text/plain", bytes.NewBufferString(""))
+
+	counters, err := a.storage.GetAllCounters(ctx)
 	if err != nil {
+		return report{}, err
+	}
+
+	batch := make([]metrics.Metrics, 0, len(gauges)+len(counters))
+	keys := make([]string, 0, len(gauges)+len(counters))
+	deltas := make(map[string]int64, len(counters))
+
+	// Добавляем PollCount и остальные счетчики, которые выросли с прошлой отправки
+	a.reportedMu.Lock()
+	for key, total := range counters {
+		delta := total - a.reported[key]
+		if delta == 0 {
+			continue
+		}
+		a.reported[key] = total
+		deltas[key] = delta
+
+		m := a.seriesMetric(key, TypeCounter)
+		m.Delta = &delta
+		batch = append(batch, m)
+		keys = append(keys, key)
+	}
+	a.reportedMu.Unlock()
+
+	// Добавляем все gauge метрики
+	for key, value := range gauges {
+		m := a.seriesMetric(key, TypeGauge)
+		m.Value = &value
+		batch = append(batch, m)
+		keys = append(keys, key)
+	}
+
+	return report{batch: batch, keys: keys, deltas: deltas}, nil
+}
+
+// send - доставляет снимок. Сначала досылаются пакеты из очереди на диске, чтобы сервер
+// получил данные в исходном порядке, затем части снимка уходят одновременно, не больше
+// rateLimit запросов. Если сервер не получил часть и она не сохранена в очереди,
+// приращения ее счетчиков возвращаются и уйдут со следующей отправкой
+func (a *Agent) send(ctx context.Context, r report) error {
+	if err := a.replay(ctx); err != nil {
+		err = a.enqueue(r.batch, err)
+		if !errors.Is(err, errSpooled) {
+			a.restoreDeltas(r.deltas)
+		}
 		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned status: %d", resp.StatusCode)
+	parts := r.split(a.rateLimit)
+	errs := make([]error, len(parts))
+	var wg sync.WaitGroup
+	for i, part := range parts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = a.deliver(ctx, part.batch)
+			if errs[i] != nil && !errors.Is(errs[i], errSpooled) {
+				a.restoreDeltas(part.deltas)
+			}
+		}()
 	}
-	return nil
+	wg.Wait()
+	return errors.Join(errs...)
 }
 
-// Отправка метрики на сервер в формате JSON
-func (a *Agent) sendMetricJSON(metricType, metricName string, value interface{}) error {
-	url := fmt.Sprintf("%s/%s/", a.serverURL, UpdateURL)
+// restoreDeltas - отменяет учет приращений недоставленного пакета
+func (a *Agent) restoreDeltas(deltas map[string]int64) {
+	a.reportedMu.Lock()
+	defer a.reportedMu.Unlock()
 
-	// Добавляем http://, если URL не начинается с протокола
-	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-		url = a.protocol + "://" + url
+	for key, delta := range deltas {
+		a.reported[key] -= delta
+	}
+}
+
+// seriesMetric - метрика по ключу ряда в хранилище агента. Метки ряда, например cpu
+// у метрик хоста, дополняют общие метки агента и имеют над ними приоритет
+func (a *Agent) seriesMetric(key, mType string) metrics.Metrics {
+	name, labels, err := metrics.ParseSeriesKey(key)
+	if err != nil {
+		return metrics.Metrics{ID: key, MType: mType, Labels: a.labels}
+	}
+	if len(labels) == 0 {
+		return metrics.Metrics{ID: name, MType: mType, Labels: a.labels}
 	}
 
-	// Создаем структуру метрики
-	metric := metrics.Metrics{
-		ID:    metricName,
-		MType: metricType,
+	merged := make(metrics.Labels, len(a.labels)+len(labels))
+	for k, v := range a.labels {
+		merged[k] = v
 	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return metrics.Metrics{ID: name, MType: mType, Labels: merged}
+}
 
-	// Заполняем значение в зависимости от типа метрики
-	switch metricType {
-	case TypeGauge:
-		if val, ok := value.(float64); ok {
-			metric.Value = &val
-		} else {
-			return fmt.Errorf("invalid gauge value type: %T", value)
-		}
-	case TypeCounter:
-		if val, ok := value.(int64); ok {
-			metric.Delta = &val
-		} else {
-			return fmt.Errorf("invalid counter value type: %T", value)
-		}
-	default:
-		return fmt.Errorf("invalid metric type: %s", metricType)
+// replay - досылает пакеты из очереди на диске
+func (a *Agent) replay(ctx context.Context) error {
+	if a.spool == nil {
+		return nil
+	}
+	return a.spool.Replay(func(spooled []metrics.Metrics) error {
+		return a.sendSpooled(ctx, spooled)
+	})
+}
+
+// deliver - отправляет пакет с повторами. Если сервер недоступен, пакет
+// ставится в очередь и будет отправлен, когда сервер вернется
+func (a *Agent) deliver(ctx context.Context, batch []metrics.Metrics) error {
+	err := retry.Do(ctx, a.backoff, func() error {
+		return a.sendMetricsBatch(ctx, batch)
+	})
+	// Отправка, прерванная остановкой агента, тоже не отклонена сервером: пакет уйдет после перезапуска
+	if err != nil && (retry.Retriable(err) || ctx.Err() != nil) {
+		return a.enqueue(batch, err)
+	}
+	return err
+}
+
+// sendSpooled - одна попытка отправки пакета из очереди. Пакет, который сервер
+// отклонил окончательно, повторять бесполезно, поэтому он удаляется из очереди
+func (a *Agent) sendSpooled(ctx context.Context, batch []metrics.Metrics) error {
+	err := a.sendMetricsBatch(ctx, batch)
+	if err != nil && !retry.Retriable(err) && ctx.Err() == nil {
+		log.Printf("dropping spooled batch rejected by server: %v", err)
+		return nil
+	}
+	return err
+}
+
+// enqueue - ставит пакет в очередь на диске, если она есть, и возвращает причину
+func (a *Agent) enqueue(batch []metrics.Metrics, cause error) error {
+	if a.spool == nil {
+		return cause
+	}
+
+	if err := a.spool.Push(batch); err != nil {
+		return errors.Join(cause, fmt.Errorf("failed to spool batch: %w", err))
 	}
+	return fmt.Errorf("server unavailable, %w: %w", errSpooled, cause)
+}
 
-	// Сериализуем метрику в JSON
-	jsonData, err := json.Marshal(metric)
+// Отправка пакета метрик на сервер в формате JSON
+func (a *Agent) sendMetricsBatch(ctx context.Context, batch []metrics.Metrics) error {
+	if a.transport != nil {
+		return a.transport.SendMetrics(ctx, batch)
+	}
 
+	jsonData, err := json.Marshal(batch)
 	if err != nil {
-		return fmt.Errorf("failed to marshal metric: %w", err)
+		return fmt.Errorf("failed to marshal metrics: %w", err)
+	}
+
+	return a.postJSON(ctx, UpdatesURL, jsonData)
+}
+
+// Отправка JSON на указанный путь сервера, с учетом сжатия
+func (a *Agent) postJSON(ctx context.Context, path string, jsonData []byte) error {
+	url := fmt.Sprintf("%s/%s/", a.serverURL, path)
+
+	// Добавляем http://, если URL не начинается с протокола
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = a.protocol + "://" + url
 	}
 
 	// Подготавливаем тело запроса (сжатое или обычное)
@@ -206,33 +598,47 @@ func (a *Agent) sendMetricJSON(metricType, metricName string, value interface{})
 		body.Write(jsonData)
 	}
 
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	// Шифруем уже сжатое тело: зашифрованные данные не сжимаются
+	if a.publicKey != nil {
+		encrypted, err := encryption.Encrypt(a.publicKey, body.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to encrypt data: %w", err)
+		}
+		body.Reset()
+		body.Write(encrypted)
 	}
 
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"POST",
 		url,
 		&body,
 	)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Устанавливаем заголовки
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Accept-Encoding", "gzip")
+	a.setRealIP(req)
 
 	if a.useGzip {
 		req.Header.Set("Content-Encoding", "gzip")
 	}
 
-	resp, err := client.Do(req)
+	if a.publicKey != nil {
+		req.Header.Set(encryption.Header, encryption.Scheme)
+	}
 
-	// Отправляем запрос
-	//resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	// Подписываем несжатое тело, сервер проверяет подпись после распаковки
+	if a.key != "" {
+		req.Header.Set(signature.Header, signature.Sign(a.key, jsonData))
+	}
 
+	// Отправляем запрос
+	resp, err := a.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -259,9 +665,44 @@ func (a *Agent) sendMetricJSON(metricType, metricName string, value interface{})
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned status: %d, body: %s",
+		err := fmt.Errorf("server returned status: %d, body: %s",
 			resp.StatusCode, string(responseBody))
+		// Ошибки сервера и перегрузка временные, остальные коды означают, что запрос неверный
+		if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+			return retry.Temporary(err)
+		}
+		return err
+	}
+
+	// Сервер уже применил пакет, поэтому неверная подпись ответа не делает отправку неудачной:
+	// иначе приращения счетчиков вернулись бы и были посчитаны дважды
+	if sign := resp.Header.Get(signature.Header); a.key != "" && sign != "" && !signature.Valid(a.key, responseBody, sign) {
+		log.Printf("invalid response signature from %s", url)
 	}
 
 	return nil
 }
+
+// setRealIP - выставляет X-Real-IP адресом интерфейса, через который агент ходит к серверу.
+// Сервер сверяет его с доверенными подсетями
+func (a *Agent) setRealIP(req *http.Request) {
+	if a.realIP != "" {
+		req.Header.Set("X-Real-IP", a.realIP)
+	}
+}
+
+// outboundIP - адрес интерфейса для сервера serverURL, с протоколом или без.
+// Определяется один раз при создании агента, при ошибке X-Real-IP не передается
+func outboundIP(serverURL string) string {
+	host := serverURL
+	if u, err := url.Parse(serverURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	ip, err := netutil.OutboundIP(host)
+	if err != nil {
+		log.Printf("failed to detect outbound address: %v", err)
+		return ""
+	}
+	return ip.String()
+}
@@ -2,14 +2,77 @@ package agent
 
 import (
 	"compress/gzip"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 	"yupi/internal/config"
+	"yupi/internal/domain/metrics"
+	"yupi/internal/encryption"
+	"yupi/internal/httptransport/handlers"
 	"yupi/internal/httptransport/middlewares"
+	"yupi/internal/repository"
+	"yupi/internal/retry"
+	"yupi/internal/service/agent/collector"
+	"yupi/internal/signature"
+	"yupi/internal/tlsconfig"
 )
 
+// runAgent - запускает агента с частым опросом сборщиков и останавливает, когда выполнится done.
+// Накопленные метрики уходят на сервер финальной отправкой Run, ее ошибку и возвращает
+func runAgent(t *testing.T, a *Agent, done func() bool) error {
+	t.Helper()
+
+	for _, rc := range a.collectors {
+		rc.interval = 10 * time.Millisecond
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- a.Run(ctx)
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for !done() {
+		select {
+		case <-deadline:
+			t.Fatal("Сборщики агента не отработали")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	cancel()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run() не завершился после отмены контекста")
+		return nil
+	}
+}
+
+// polled - условие для runAgent: сборщик рантайма сделал не меньше n опросов с запуска агента
+func polled(a *Agent, n int64) func() bool {
+	return func() bool {
+		count, _, _ := a.storage.GetCounter(context.Background(), MetricCount)
+		return count >= n
+	}
+}
+
 func TestNewAgent(t *testing.T) {
 	serverURL := config.DefaultServerAddr
 	pollInterval := config.DefaultPollInterval
@@ -39,155 +102,89 @@ func TestNewAgent(t *testing.T) {
 	}
 }
 
-func TestAgent_SendMetric(t *testing.T) {
-	// Создаем тестовый HTTP сервер
+func TestAgent_ReportMetricsBatch(t *testing.T) {
+	var requests int
+	var received []metrics.Metrics
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			t.Errorf("Ожидали тип запроса POST, получили %s", r.Method)
+		requests++
+		if r.URL.Path != "/updates/" {
+			t.Errorf("Ожидали запрос на /updates/, получили %s", r.URL.Path)
 		}
-		w.WriteHeader(http.StatusOK)
-	}))
-	defer server.Close()
-
-	agent := NewAgent(server.URL, config.DefaultPollInterval, config.DefaultReportInterval, config.DefaultUseGzip)
-
-	tests := []struct {
-		name       string
-		metricType string
-		metricName string
-		value      interface{}
-		wantErr    bool
-	}{
-		{
-			name:       "Успешное_обновление_метрики_с_типом_gauge",
-			metricType: TypeGauge,
-			metricName: "test_gauge",
-			value:      42.0,
-			wantErr:    false,
-		},
-		{
-			name:       "Успешное_обновление_метрики_с_типом_counters",
-			metricType: TypeCounter,
-			metricName: "test_counter",
-			value:      int64(10),
-			wantErr:    false,
-		},
-	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := agent.sendMetric(tt.metricType, tt.metricName, tt.value)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("sendMetric() ошибка %v, ожидали %v", err, tt.wantErr)
-			}
-		})
-	}
-}
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error("Ошибка при чтении сжатых данных:", err)
+			return
+		}
+		defer reader.Close()
 
-func TestAgent_ReportMetrics(t *testing.T) {
-	// Создаем тестовый HTTP сервер для подсчета отправленных метрик
-	var receivedMetrics int
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		receivedMetrics++
+		if err := json.NewDecoder(reader).Decode(&received); err != nil {
+			t.Error("Ошибка при разборе пакета:", err)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	}))
 	defer server.Close()
 
 	agent := NewAgent(server.URL, config.DefaultPollInterval, config.DefaultReportInterval, config.DefaultUseGzip)
+	if err := runAgent(t, agent, polled(agent, 1)); err != nil {
+		t.Fatalf("Run() ошибка %v", err)
+	}
 
-	// Добавляем тестовые метрики
-	agent.storage.UpdateGauge("test_gauge1", 1.0)
-	agent.storage.UpdateGauge("test_gauge2", 2.0)
-	agent.storage.UpdateCounter(MetricCount, 1)
-
-	// Отправляем PollCount
-	count, exists := agent.storage.GetCounter(MetricCount)
-	if exists {
-		if err := agent.sendMetric(TypeCounter, MetricCount, count); err != nil {
-			t.Error("Не удалось отправить метрику с типом counts")
-		}
+	if requests != 1 {
+		t.Errorf("Ожидали один запрос, получили %d", requests)
 	}
 
-	// Отправляем все gauge метрики
-	for name, value := range agent.storage.GetAllGauges() {
-		if err := agent.sendMetric(TypeGauge, name, value); err != nil {
-			t.Error("Не удалось отправить метрику с типом gauge")
-		}
+	gauges, _ := agent.storage.GetAllGauges(context.Background())
+	if len(received) != len(gauges)+1 {
+		t.Errorf("Получили пакет из %d метрик, ожидали %d", len(received), len(gauges)+1)
 	}
 }
 
-func TestAgent_SendMetricJSON_WithGzip(t *testing.T) {
-	// Создаем тестовый сервер
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Проверяем наличие заголовка Accept-Encoding
-		if r.Header.Get("Accept-Encoding") != "gzip" {
-			t.Error("Заголовок Accept-Encoding: gzip не установлен")
-		}
-		// Проверяем наличие заголовка Content-Encoding для запросов с включенным сжатием
-		if r.Header.Get("Content-Encoding") == "gzip" {
-			// Проверяем, что данные действительно сжаты
-			reader, err := gzip.NewReader(r.Body)
-			if err != nil {
-				t.Error("Ошибка при чтении сжатых данных:", err)
-				return
-			}
-			defer reader.Close()
-
-			// Читаем и проверяем данные
-			_, err = io.ReadAll(reader)
-			if err != nil {
-				t.Error("Ошибка при чтении разжатых данных:", err)
-				return
-			}
-		}
-		w.WriteHeader(http.StatusOK)
-	}))
-	defer server.Close()
-
+func TestAgent_ReportWithGzip(t *testing.T) {
 	tests := []struct {
-		name       string
-		useGzip    bool
-		metricType string
-		metricName string
-		value      interface{}
-		wantErr    bool
+		name    string
+		useGzip bool
 	}{
-		{
-			name:       "Отправка_метрики_с_gzip_сжатием",
-			useGzip:    true,
-			metricType: TypeGauge,
-			metricName: "test_gauge",
-			value:      42.0,
-			wantErr:    false,
-		},
-		{
-			name:       "Отправка_метрики_без_gzip_сжатия",
-			useGzip:    false,
-			metricType: TypeGauge,
-			metricName: "test_gauge",
-			value:      42.0,
-			wantErr:    false,
-		},
-		{
-			name:       "Отправка_counter_метрики_с_gzip_сжатием",
-			useGzip:    true,
-			metricType: TypeCounter,
-			metricName: "test_counter",
-			value:      int64(10),
-			wantErr:    false,
-		},
+		{name: "Отправка_пакета_с_gzip_сжатием", useGzip: true},
+		{name: "Отправка_пакета_без_gzip_сжатия", useGzip: false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			agent := NewAgent(server.URL,
-				config.DefaultPollInterval,
-				config.DefaultReportInterval,
-				tt.useGzip)
+			var received []metrics.Metrics
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Проверяем наличие заголовка Accept-Encoding
+				if r.Header.Get("Accept-Encoding") != "gzip" {
+					t.Error("Заголовок Accept-Encoding: gzip не установлен")
+				}
+				if compressed := r.Header.Get("Content-Encoding") == "gzip"; compressed != tt.useGzip {
+					t.Errorf("Content-Encoding: gzip = %v, want %v", compressed, tt.useGzip)
+				}
 
-			err := agent.sendMetricJSON(tt.metricType, tt.metricName, tt.value)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("sendMetricJSON() ошибка = %v, ожидали ошибку = %v", err, tt.wantErr)
+				var body io.Reader = r.Body
+				if tt.useGzip {
+					reader, err := gzip.NewReader(r.Body)
+					if err != nil {
+						t.Error("Ошибка при чтении сжатых данных:", err)
+						return
+					}
+					defer reader.Close()
+					body = reader
+				}
+				if err := json.NewDecoder(body).Decode(&received); err != nil {
+					t.Error("Ошибка при разборе пакета:", err)
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			agent := NewAgent(server.URL, config.DefaultPollInterval, config.DefaultReportInterval, tt.useGzip)
+			if err := runAgent(t, agent, polled(agent, 1)); err != nil {
+				t.Fatalf("Run() ошибка %v", err)
+			}
+			if len(received) == 0 {
+				t.Error("Сервер не получил метрики")
 			}
 		})
 	}
@@ -246,3 +243,680 @@ func TestGzipMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestAgent_SignedRequests(t *testing.T) {
+	const key = "secret"
+	var received []metrics.Metrics
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error("Ошибка при разборе пакета:", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(middlewares.GzipMiddleware(middlewares.HashMiddleware(key)(handler)))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{"Успешная_отправка_с_ключом", key, false},
+		{"Неверный_ключ", "other", true},
+		{"Без_ключа", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := NewAgent(server.URL, config.DefaultPollInterval, config.DefaultReportInterval, config.DefaultUseGzip, WithKey(tt.key))
+
+			err := runAgent(t, agent, polled(agent, 1))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Run() ошибка = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAgent_InvalidResponseSignature(t *testing.T) {
+	const key = "secret"
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set(signature.Header, "bad")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	agent := NewAgent(server.URL, config.DefaultPollInterval, config.DefaultReportInterval, false, WithKey(key))
+	agent.storage.UpdateCounter(context.Background(), MetricCount, 3) //nolint:errcheck
+
+	// Сервер принял пакет, поэтому приращения не возвращаются и не уходят повторно
+	if err := agent.flush(context.Background()); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+	if err := agent.flush(context.Background()); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Запросов к серверу %d, want 1", got)
+	}
+}
+
+func TestAgent_EncryptedRequests(t *testing.T) {
+	privatePEM, publicPEM, err := encryption.GenerateKeys(2048)
+	if err != nil {
+		t.Fatalf("GenerateKeys() error = %v", err)
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "private.pem"), privatePEM, 0600)
+	os.WriteFile(filepath.Join(dir, "public.pem"), publicPEM, 0644)
+	privateKey, _ := encryption.LoadPrivateKey(filepath.Join(dir, "private.pem"))
+	publicKey, _ := encryption.LoadPublicKey(filepath.Join(dir, "public.pem"))
+
+	const key = "secret"
+	var received []metrics.Metrics
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error("Ошибка при разборе пакета:", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	chain := middlewares.DecryptMiddleware(privateKey)(middlewares.GzipMiddleware(middlewares.HashMiddleware(key)(handler)))
+	server := httptest.NewServer(chain)
+	defer server.Close()
+
+	t.Run("Успешная_отправка_зашифрованного_пакета", func(t *testing.T) {
+		agent := NewAgent(server.URL, config.DefaultPollInterval, config.DefaultReportInterval, config.DefaultUseGzip,
+			WithKey(key), WithPublicKey(publicKey))
+
+		if err := runAgent(t, agent, polled(agent, 1)); err != nil {
+			t.Fatalf("Run() ошибка %v", err)
+		}
+		if len(received) == 0 {
+			t.Error("Сервер не получил метрики")
+		}
+	})
+
+	t.Run("Незашифрованный_пакет_отклоняется", func(t *testing.T) {
+		agent := NewAgent(server.URL, config.DefaultPollInterval, config.DefaultReportInterval, config.DefaultUseGzip, WithKey(key))
+
+		if err := runAgent(t, agent, polled(agent, 1)); err == nil {
+			t.Error("Run() без шифрования должен вернуть ошибку")
+		}
+	})
+}
+
+func TestAgent_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// Сертификат тестового сервера самоподписанный, его и закрепляем как доверенный
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+	addr := strings.TrimPrefix(server.URL, "https://")
+
+	t.Run("Успешная_отправка_с_закрепленным_сертификатом", func(t *testing.T) {
+		tlsConfig, err := tlsconfig.Client(caPath, "", "")
+		if err != nil {
+			t.Fatalf("tlsconfig.Client() error = %v", err)
+		}
+
+		agent := NewAgent(addr, config.DefaultPollInterval, config.DefaultReportInterval, config.DefaultUseGzip, WithTLS(tlsConfig))
+		if agent.protocol != "https" {
+			t.Errorf("protocol = %s, want https", agent.protocol)
+		}
+		if err := runAgent(t, agent, polled(agent, 1)); err != nil {
+			t.Errorf("Run() ошибка %v", err)
+		}
+	})
+
+	t.Run("Сервер_без_доверенного_сертификата", func(t *testing.T) {
+		tlsConfig, _ := tlsconfig.Client("", "", "")
+		agent := NewAgent(addr, config.DefaultPollInterval, config.DefaultReportInterval, config.DefaultUseGzip, WithTLS(tlsConfig))
+		if err := runAgent(t, agent, polled(agent, 1)); err == nil {
+			t.Error("Run() должен вернуть ошибку проверки сертификата")
+		}
+	})
+}
+
+func TestAgent_RealIP(t *testing.T) {
+	subnets, _ := middlewares.ParseSubnets("127.0.0.0/8")
+	var realIP string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realIP = r.Header.Get("X-Real-IP")
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(middlewares.TrustedSubnetMiddleware(subnets)(handler))
+	defer server.Close()
+
+	agent := NewAgent(server.URL, config.DefaultPollInterval, config.DefaultReportInterval, config.DefaultUseGzip)
+	if err := runAgent(t, agent, polled(agent, 1)); err != nil {
+		t.Fatalf("Run() ошибка %v", err)
+	}
+	if realIP != "127.0.0.1" {
+		t.Errorf("X-Real-IP = %q, want 127.0.0.1", realIP)
+	}
+}
+
+func TestAgent_RealIPResolvedOnce(t *testing.T) {
+	tests := []struct {
+		name      string
+		serverURL string
+	}{
+		{name: "Адрес_с_протоколом", serverURL: "http://127.0.0.1:8080"},
+		{name: "Адрес_без_протокола", serverURL: "127.0.0.1:8080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := NewAgent(tt.serverURL, config.DefaultPollInterval, config.DefaultReportInterval, false)
+			if agent.realIP != "127.0.0.1" {
+				t.Errorf("realIP = %q, want 127.0.0.1", agent.realIP)
+			}
+		})
+	}
+}
+
+// fakeTransport - транспорт, запоминающий отправленные пакеты
+type fakeTransport struct {
+	batches [][]metrics.Metrics
+}
+
+func (f *fakeTransport) SendMetrics(_ context.Context, batch []metrics.Metrics) error {
+	f.batches = append(f.batches, batch)
+	return nil
+}
+
+func TestAgent_WithTransport(t *testing.T) {
+	transport := &fakeTransport{}
+	agent := NewAgent("localhost:0", config.DefaultPollInterval, config.DefaultReportInterval, config.DefaultUseGzip, WithTransport(transport))
+	if err := runAgent(t, agent, polled(agent, 1)); err != nil {
+		t.Fatalf("Run() ошибка %v", err)
+	}
+	if len(transport.batches) != 1 || len(transport.batches[0]) == 0 {
+		t.Errorf("Ожидали один непустой пакет через транспорт, получили %d", len(transport.batches))
+	}
+}
+
+func TestAgent_RetryAndSpool(t *testing.T) {
+	var mu sync.Mutex
+	var down bool
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var batch []metrics.Metrics
+		json.NewDecoder(r.Body).Decode(&batch) //nolint:errcheck
+		if batch[0].ID == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, batch[0].ID)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	setDown := func(d bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		down = d
+	}
+
+	spool, err := NewSpool(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backoff := retry.Backoff{Attempts: 2, Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 2}
+	agent := NewAgent(server.URL, config.DefaultPollInterval, config.DefaultReportInterval, false,
+		WithBackoff(backoff), WithSpool(spool))
+
+	gauge := func(id string) []metrics.Metrics {
+		value := 1.0
+		return []metrics.Metrics{{ID: id, MType: TypeGauge, Value: &value}}
+	}
+
+	t.Run("Пакет_в_очередь_при_ошибке_сервера", func(t *testing.T) {
+		setDown(true)
+		if err := agent.send(context.Background(), report{batch: gauge("first")}); err == nil {
+			t.Error("send() должен вернуть ошибку")
+		}
+		if spool.Len() != 1 {
+			t.Errorf("spool.Len() = %d, want 1", spool.Len())
+		}
+	})
+
+	t.Run("Отклоненный_пакет_не_ставится_в_очередь", func(t *testing.T) {
+		setDown(false)
+		if err := agent.send(context.Background(), report{batch: gauge("bad")}); err == nil {
+			t.Error("send() должен вернуть ошибку")
+		}
+		if spool.Len() != 0 {
+			t.Errorf("spool.Len() = %d, want 0", spool.Len())
+		}
+	})
+
+	t.Run("Очередь_досылается_по_порядку", func(t *testing.T) {
+		if err := agent.send(context.Background(), report{batch: gauge("second")}); err != nil {
+			t.Fatalf("send() error = %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(received) != 2 || received[0] != "first" || received[1] != "second" {
+			t.Errorf("Сервер получил %v, ожидали [first second]", received)
+		}
+	})
+}
+
+func TestAgent_ServerDown(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	addr := server.URL
+	server.Close()
+
+	spool, _ := NewSpool(t.TempDir(), 10)
+	backoff := retry.Backoff{Attempts: 3, Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 2}
+	agent := NewAgent(addr, config.DefaultPollInterval, config.DefaultReportInterval, false, WithBackoff(backoff), WithSpool(spool))
+
+	if err := runAgent(t, agent, polled(agent, 1)); err == nil {
+		t.Error("Run() должен вернуть ошибку")
+	}
+	if spool.Len() != 1 {
+		t.Errorf("Пакет при недоступном сервере не попал в очередь, spool.Len() = %d", spool.Len())
+	}
+}
+
+func TestAgent_Collectors(t *testing.T) {
+	var calls atomic.Int32
+	custom := collector.Func("app", func(context.Context) (collector.Sample, error) {
+		calls.Add(1)
+		sample := collector.NewSample()
+		sample.Gauges[`QueueLength{queue="mail"}`] = 7
+		sample.Counters["JobsDone"] = 3
+		return sample, errors.New("частичный сбор")
+	})
+
+	transport := &fakeTransport{}
+	agent := NewAgent("localhost:0", 2, 10, false,
+		WithLabels(metrics.Labels{"host": "h1", "queue": "agent"}),
+		WithCollector(custom, 5*time.Second),
+		WithTransport(transport),
+	)
+
+	t.Run("Интервалы_сборщиков", func(t *testing.T) {
+		want := map[string]time.Duration{"runtime": 2 * time.Second, "app": 5 * time.Second}
+		if len(agent.collectors) != len(want) {
+			t.Fatalf("Зарегистрировано %d сборщиков, want %d", len(agent.collectors), len(want))
+		}
+		for _, rc := range agent.collectors {
+			if rc.interval != want[rc.collector.Name()] {
+				t.Errorf("Интервал %s = %v, want %v", rc.collector.Name(), rc.interval, want[rc.collector.Name()])
+			}
+		}
+	})
+
+	t.Run("Повторная_регистрация", func(t *testing.T) {
+		if err := agent.Register(collector.NewRuntime(), 0); !errors.Is(err, ErrDuplicateCollector) {
+			t.Errorf("Register() error = %v, want ErrDuplicateCollector", err)
+		}
+	})
+
+	t.Run("Неизвестный_сборщик", func(t *testing.T) {
+		if err := agent.SetEnabled("process", false); !errors.Is(err, ErrUnknownCollector) {
+			t.Errorf("SetEnabled() error = %v, want ErrUnknownCollector", err)
+		}
+		if err := agent.SetInterval("process", time.Second); !errors.Is(err, ErrUnknownCollector) {
+			t.Errorf("SetInterval() error = %v, want ErrUnknownCollector", err)
+		}
+	})
+
+	t.Run("Выключенный_сборщик_не_опрашивается", func(t *testing.T) {
+		if err := agent.SetEnabled("runtime", false); err != nil {
+			t.Fatal(err)
+		}
+		err := runAgent(t, agent, func() bool {
+			return calls.Load() > 0
+		})
+		if err != nil {
+			t.Fatalf("Run() ошибка %v", err)
+		}
+
+		if _, exist, _ := agent.storage.GetGauge(context.Background(), "Alloc"); exist {
+			t.Error("Метрики выключенного сборщика попали в хранилище")
+		}
+	})
+
+	t.Run("Метки_ряда_и_общие_метки", func(t *testing.T) {
+		if len(transport.batches) != 1 {
+			t.Fatalf("Отправлено %d пакетов, want 1", len(transport.batches))
+		}
+
+		found := map[string]metrics.Metrics{}
+		for _, m := range transport.batches[0] {
+			found[m.ID] = m
+		}
+
+		queue, ok := found["QueueLength"]
+		if !ok || *queue.Value != 7 {
+			t.Fatalf("QueueLength не отправлен или неверен: %+v", queue)
+		}
+		// Метка ряда важнее общей метки агента, остальные общие метки сохраняются
+		if queue.Labels["queue"] != "mail" || queue.Labels["host"] != "h1" {
+			t.Errorf("QueueLength labels = %v, want queue=mail host=h1", queue.Labels)
+		}
+		if jobs, ok := found["JobsDone"]; !ok || jobs.MType != TypeCounter || *jobs.Delta != 3*int64(calls.Load()) {
+			t.Errorf("JobsDone = %+v, want counter %d", jobs, 3*calls.Load())
+		}
+	})
+}
+
+// slowTransport - транспорт, который держит отправки, пока одновременно не начнутся want
+// из них, и считает одновременные отправки. Если want не набирается, отправки отпускаются по таймауту
+type slowTransport struct {
+	want     int
+	full     chan struct{}
+	fullOnce sync.Once
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	sent     int
+}
+
+func newSlowTransport(want int) *slowTransport {
+	return &slowTransport{want: want, full: make(chan struct{})}
+}
+
+func (s *slowTransport) SendMetrics(_ context.Context, batch []metrics.Metrics) error {
+	s.mu.Lock()
+	s.inFlight++
+	s.peak = max(s.peak, s.inFlight)
+	if s.inFlight == s.want {
+		s.fullOnce.Do(func() { close(s.full) })
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.full:
+	case <-time.After(time.Second):
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	s.mu.Lock()
+	s.inFlight--
+	s.sent += len(batch)
+	s.mu.Unlock()
+	return nil
+}
+
+func TestAgent_RateLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		rateLimit int
+		wantPeak  int
+	}{
+		{name: "Один_отправитель_по_умолчанию", rateLimit: 0, wantPeak: 1},
+		{name: "Ограничение_одновременных_запросов", rateLimit: 3, wantPeak: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newSlowTransport(tt.wantPeak)
+			agent := NewAgent("localhost:0", 1, 1, false, WithTransport(transport), WithRateLimit(tt.rateLimit))
+			for _, rc := range agent.collectors {
+				agent.collect(context.Background(), rc)
+			}
+
+			reports := make(chan report)
+			sender := agent.startSender(context.Background(), reports)
+			want := 0
+			for i := 0; i < 8; i++ {
+				r, err := agent.snapshot()
+				if err != nil {
+					t.Fatal(err)
+				}
+				want += len(r.batch)
+				reports <- r
+			}
+			close(reports)
+			sender.Wait()
+
+			if transport.sent != want {
+				t.Errorf("Отправлено %d метрик, want %d", transport.sent, want)
+			}
+			if transport.peak != tt.wantPeak {
+				t.Errorf("Одновременных отправок %d, want %d", transport.peak, tt.wantPeak)
+			}
+		})
+	}
+}
+
+// orderTransport - транспорт, запоминающий значения gauge Seq в порядке прихода.
+// Первый снимок отвечает дольше следующих
+type orderTransport struct {
+	mu   sync.Mutex
+	seen []float64
+}
+
+func (o *orderTransport) SendMetrics(_ context.Context, batch []metrics.Metrics) error {
+	for _, m := range batch {
+		if m.ID != "Seq" {
+			continue
+		}
+		if *m.Value == 1 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		o.mu.Lock()
+		o.seen = append(o.seen, *m.Value)
+		o.mu.Unlock()
+	}
+	return nil
+}
+
+func TestAgent_GaugeOrder(t *testing.T) {
+	var seq float64
+	app := collector.Func("app", func(context.Context) (collector.Sample, error) {
+		seq++
+		sample := collector.NewSample()
+		sample.Gauges["Seq"] = seq
+		for i := 0; i < 10; i++ {
+			sample.Gauges[fmt.Sprintf("Other%d", i)] = seq
+		}
+		return sample, nil
+	})
+
+	transport := &orderTransport{}
+	agent := NewAgent("localhost:0", 1, 1, false, WithTransport(transport), WithRateLimit(4), WithCollector(app, 0))
+	agent.SetEnabled("runtime", false) //nolint:errcheck
+	rc := agent.findCollector("app")
+
+	reports := make(chan report)
+	sender := agent.startSender(context.Background(), reports)
+	for i := 0; i < 3; i++ {
+		agent.collect(context.Background(), rc)
+		r, err := agent.snapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		reports <- r
+	}
+	close(reports)
+	sender.Wait()
+
+	// Снимки с несколькими отправителями уходят по одному, новое значение не затирается старым
+	want := []float64{1, 2, 3}
+	if !slices.Equal(transport.seen, want) {
+		t.Errorf("Сервер получил Seq %v, want %v", transport.seen, want)
+	}
+}
+
+func TestAgent_GracefulShutdown(t *testing.T) {
+	// Сборщик сообщает о каждом проходе, чтобы остановить агент после сбора метрик
+	newAgent := func(serverURL string, opts ...Option) (*Agent, chan struct{}) {
+		collected := make(chan struct{}, 1)
+		app := collector.Func("app", func(context.Context) (collector.Sample, error) {
+			sample := collector.NewSample()
+			sample.Gauges["Queue"] = 1
+			select {
+			case collected <- struct{}{}:
+			default:
+			}
+			return sample, nil
+		})
+
+		// Интервал отправки больше времени теста: метрики уходят только при остановке
+		opts = append(opts, WithCollector(app, 10*time.Millisecond), WithBackoff(retry.Backoff{Attempts: 1}))
+		agent := NewAgent(serverURL, 1, 3600, false, opts...)
+		agent.SetEnabled("runtime", false) //nolint:errcheck
+		return agent, collected
+	}
+
+	run := func(t *testing.T, agent *Agent, collected chan struct{}) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- agent.Run(ctx)
+		}()
+
+		<-collected
+		cancel()
+
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("Run() не завершился после отмены контекста")
+			return nil
+		}
+	}
+
+	t.Run("Финальная_отправка_при_остановке", func(t *testing.T) {
+		var mu sync.Mutex
+		var received []metrics.Metrics
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var batch []metrics.Metrics
+			json.NewDecoder(r.Body).Decode(&batch) //nolint:errcheck
+			mu.Lock()
+			received = append(received, batch...)
+			mu.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		agent, collected := newAgent(server.URL)
+		if err := run(t, agent, collected); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(received) != 1 || received[0].ID != "Queue" {
+			t.Errorf("Сервер получил %+v, want одну метрику Queue", received)
+		}
+	})
+
+	t.Run("Сервер_не_отвечает_до_дедлайна", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		defer server.Close()
+		defer close(release)
+
+		spool, err := NewSpool(t.TempDir(), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		agent, collected := newAgent(server.URL, WithFlushTimeout(100*time.Millisecond), WithSpool(spool))
+		start := time.Now()
+		if err := run(t, agent, collected); err == nil {
+			t.Error("Run() должен вернуть ошибку, если метрики не доставлены")
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Остановка заняла %v, дедлайн не соблюден", elapsed)
+		}
+		// Недоставленный пакет сохраняется до следующего запуска
+		if spool.Len() != 1 {
+			t.Errorf("В очереди %d пакетов, want 1", spool.Len())
+		}
+	})
+}
+
+func TestAgent_CounterDeltas(t *testing.T) {
+	tests := []struct {
+		name      string
+		withSpool bool
+		// up - доступен ли сервер при очередном запуске агента, за каждый агент делает не меньше 3 опросов
+		up []bool
+	}{
+		{name: "Сервер_доступен", up: []bool{true, true, true}},
+		{name: "Сбои_без_очереди", up: []bool{true, false, false, true, false, true}},
+		{name: "Сбои_с_очередью", withSpool: true, up: []bool{false, true, false, false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := repository.NewMemStorage()
+			server := handlers.NewMetricServer(storage)
+
+			var up atomic.Bool
+			httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !up.Load() {
+					http.Error(w, `{"error":"unavailable"}`, http.StatusServiceUnavailable)
+					return
+				}
+				server.JSONUpdatesHandler(w, r)
+			}))
+			defer httpServer.Close()
+
+			opts := []Option{WithBackoff(retry.Backoff{Attempts: 1})}
+			if tt.withSpool {
+				spool, err := NewSpool(t.TempDir(), 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				opts = append(opts, WithSpool(spool))
+			}
+			agent := NewAgent(httpServer.URL, 1, 1, false, opts...)
+
+			polls := func() int64 {
+				count, _, _ := agent.storage.GetCounter(context.Background(), MetricCount)
+				return count
+			}
+			for _, serverUp := range tt.up {
+				up.Store(serverUp)
+				runAgent(t, agent, polled(agent, polls()+3)) //nolint:errcheck
+			}
+
+			// Последний запуск при доступном сервере доставляет все, что накопилось
+			up.Store(true)
+			if err := runAgent(t, agent, polled(agent, polls()+1)); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			got, _, _ := storage.GetCounter(context.Background(), MetricCount)
+			if want := polls(); got != want {
+				t.Errorf("PollCount на сервере = %d, want %d", got, want)
+			}
+
+			// Без новых опросов счетчики не отправляются повторно
+			if err := agent.flush(context.Background()); err != nil {
+				t.Fatalf("flush() error = %v", err)
+			}
+			if got, _, _ := storage.GetCounter(context.Background(), MetricCount); got != polls() {
+				t.Errorf("PollCount после повторной отправки = %d, want %d", got, polls())
+			}
+		})
+	}
+}
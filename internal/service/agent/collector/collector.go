@@ -0,0 +1,44 @@
+// Package collector - сборщики метрик агента. Агент вызывает каждый сборщик со своим
+// интервалом и складывает результат в свое хранилище перед отправкой на сервер.
+package collector
+
+import "context"
+
+// Collector - источник метрик агента
+type Collector interface {
+	// Name - уникальное имя, по нему сборщик включают, выключают и настраивают
+	Name() string
+	// Collect - снимает метрики. Вместе с ошибкой можно вернуть то, что удалось собрать
+	Collect(ctx context.Context) (Sample, error)
+}
+
+// Sample - метрики одного прохода сборщика по ключам временных рядов (metrics.SeriesKey).
+// Gauge заменяют прежнее значение, counter прибавляются к накопленному
+type Sample struct {
+	Gauges   map[string]float64
+	Counters map[string]int64
+}
+
+// NewSample - пустой набор метрик
+func NewSample() Sample {
+	return Sample{Gauges: make(map[string]float64), Counters: make(map[string]int64)}
+}
+
+// funcCollector - сборщик из функции
+type funcCollector struct {
+	name    string
+	collect func(ctx context.Context) (Sample, error)
+}
+
+// Func - сборщик из функции, удобен для метрик приложения, которым не нужно состояние
+func Func(name string, collect func(ctx context.Context) (Sample, error)) Collector {
+	return &funcCollector{name: name, collect: collect}
+}
+
+func (f *funcCollector) Name() string {
+	return f.name
+}
+
+func (f *funcCollector) Collect(ctx context.Context) (Sample, error) {
+	return f.collect(ctx)
+}
@@ -0,0 +1,289 @@
+package collector
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"yupi/internal/domain/metrics"
+)
+
+// pseudoFilesystems - виртуальные файловые системы, их заполненность не интересна
+var pseudoFilesystems = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "tmpfs": true,
+	"cgroup": true, "cgroup2": true, "securityfs": true, "pstore": true, "debugfs": true,
+	"tracefs": true, "mqueue": true, "hugetlbfs": true, "configfs": true, "fusectl": true,
+	"bpf": true, "autofs": true, "binfmt_misc": true, "rpc_pipefs": true, "nsfs": true,
+	"efivarfs": true, "squashfs": true, "ramfs": true,
+}
+
+// netCounters - счетчики интерфейса из /sys/class/net/<iface>/statistics и имена метрик для них
+var netCounters = []struct {
+	file   string
+	metric string
+}{
+	{"rx_bytes", "NetRxBytes"},
+	{"tx_bytes", "NetTxBytes"},
+	{"rx_packets", "NetRxPackets"},
+	{"tx_packets", "NetTxPackets"},
+	{"rx_errors", "NetRxErrors"},
+	{"tx_errors", "NetTxErrors"},
+}
+
+// cpuTimes - счетчики времени процессора из /proc/stat
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+// diskStat - размер файловой системы в байтах: free - все свободные блоки,
+// avail - свободные без зарезервированных для root
+type diskStat struct {
+	total uint64
+	free  uint64
+	avail uint64
+}
+
+// Host - сборщик метрик хоста из procfs и sysfs Linux: загрузка каждого процессора,
+// память, load average, заполненность дисков и счетчики сетевых интерфейсов.
+// Загрузка процессора и приращения сетевых счетчиков считаются между вызовами Collect,
+// поэтому при первом вызове их нет.
+type Host struct {
+	procPath string
+	sysPath  string
+	// statfs - размер и свободное место файловой системы, подменяется в тестах
+	statfs func(path string) (diskStat, error)
+
+	prevCPU map[string]cpuTimes
+	prevNet map[string]uint64
+}
+
+// NewHost - сборщик метрик хоста из каталогов procPath и sysPath
+func NewHost(procPath, sysPath string) *Host {
+	return &Host{
+		procPath: procPath,
+		sysPath:  sysPath,
+		statfs:   statfs,
+		prevCPU:  make(map[string]cpuTimes),
+		prevNet:  make(map[string]uint64),
+	}
+}
+
+// Name - имя сборщика
+func (c *Host) Name() string {
+	return "host"
+}
+
+// Collect - снимает метрики хоста. Ошибка одного источника не мешает остальным,
+// собранное возвращается вместе с объединенной ошибкой
+func (c *Host) Collect(_ context.Context) (Sample, error) {
+	sample := NewSample()
+
+	errs := []error{
+		c.collectCPU(sample),
+		c.collectMemory(sample),
+		c.collectLoad(sample),
+		c.collectDisks(sample),
+		c.collectNetwork(sample),
+	}
+	return sample, errors.Join(errs...)
+}
+
+// collectCPU - загрузка в процентах по строкам cpu, cpu0, cpu1... из /proc/stat
+func (c *Host) collectCPU(sample Sample) error {
+	f, err := os.Open(filepath.Join(c.procPath, "stat"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+
+		// user nice system idle iowait irq softirq steal; guest уже учтен в user
+		var times cpuTimes
+		for i, field := range fields[1:min(len(fields), 9)] {
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid /proc/stat line %q: %w", scanner.Text(), err)
+			}
+			times.total += v
+			if i == 3 || i == 4 {
+				times.idle += v
+			}
+		}
+
+		cpu := strings.TrimPrefix(fields[0], "cpu")
+		if cpu == "" {
+			cpu = "all"
+		}
+
+		prev, ok := c.prevCPU[cpu]
+		c.prevCPU[cpu] = times
+		if !ok {
+			continue
+		}
+
+		// Счетчик iowait ядро может уменьшить, поэтому приращения считаем со знаком,
+		// а загрузку ограничиваем диапазоном [0, 100]
+		total := int64(times.total - prev.total)
+		idle := int64(times.idle - prev.idle)
+		if total <= 0 {
+			continue
+		}
+
+		busy := float64(total-idle) / float64(total) * 100
+		sample.Gauges[metrics.SeriesKey("CPUutilization", metrics.Labels{"cpu": cpu})] = min(max(busy, 0), 100)
+	}
+	return scanner.Err()
+}
+
+// collectMemory - память из /proc/meminfo в байтах
+func (c *Host) collectMemory(sample Sample) error {
+	f, err := os.Open(filepath.Join(c.procPath, "meminfo"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	names := map[string]string{
+		"MemTotal":     "TotalMemory",
+		"MemFree":      "FreeMemory",
+		"MemAvailable": "AvailableMemory",
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// MemTotal:       16318172 kB
+		key, rest, ok := strings.Cut(scanner.Text(), ":")
+		name, known := names[key]
+		if !ok || !known {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return fmt.Errorf("invalid /proc/meminfo line %q: %w", scanner.Text(), err)
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			v *= 1024
+		}
+		sample.Gauges[name] = v
+	}
+	return scanner.Err()
+}
+
+// collectLoad - средняя нагрузка за 1, 5 и 15 минут из /proc/loadavg
+func (c *Host) collectLoad(sample Sample) error {
+	data, err := os.ReadFile(filepath.Join(c.procPath, "loadavg"))
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return fmt.Errorf("invalid /proc/loadavg: %q", data)
+	}
+
+	for i, name := range []string{"LoadAverage1", "LoadAverage5", "LoadAverage15"} {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return fmt.Errorf("invalid /proc/loadavg: %w", err)
+		}
+		sample.Gauges[name] = v
+	}
+	return nil
+}
+
+// collectDisks - размер, свободное место и заполненность каждой точки монтирования из /proc/mounts
+func (c *Host) collectDisks(sample Sample) error {
+	f, err := os.Open(filepath.Join(c.procPath, "mounts"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var errs []error
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// /dev/sda1 / ext4 rw,relatime 0 0
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || pseudoFilesystems[fields[2]] {
+			continue
+		}
+		// Пробелы в пути экранируются как \040
+		mount := strings.ReplaceAll(fields[1], `\040`, " ")
+
+		disk, err := c.statfs(mount)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("statfs %s: %w", mount, err))
+			continue
+		}
+		if disk.total == 0 {
+			continue
+		}
+
+		// Свободное место - доступное непривилегированному пользователю, а занятое
+		// считаем без блоков, зарезервированных для root
+		labels := metrics.Labels{"mount": mount}
+		sample.Gauges[metrics.SeriesKey("DiskTotal", labels)] = float64(disk.total)
+		sample.Gauges[metrics.SeriesKey("DiskFree", labels)] = float64(disk.avail)
+		sample.Gauges[metrics.SeriesKey("DiskUsedPercent", labels)] = float64(disk.total-disk.free) / float64(disk.total) * 100
+	}
+
+	return errors.Join(append(errs, scanner.Err())...)
+}
+
+// collectNetwork - приращения счетчиков сетевых интерфейсов из /sys/class/net, кроме loopback
+func (c *Host) collectNetwork(sample Sample) error {
+	dir := filepath.Join(c.sysPath, "class", "net")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		iface := e.Name()
+		if iface == "lo" {
+			continue
+		}
+
+		for _, counter := range netCounters {
+			data, err := os.ReadFile(filepath.Join(dir, iface, "statistics", counter.file))
+			if err != nil {
+				continue
+			}
+			v, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+			if err != nil {
+				continue
+			}
+
+			key := metrics.SeriesKey(counter.metric, metrics.Labels{"interface": iface})
+			prev, ok := c.prevNet[key]
+			c.prevNet[key] = v
+			if !ok {
+				continue
+			}
+
+			// Счетчик уменьшился - интерфейс пересоздан, считаем с нуля
+			delta := v
+			if v >= prev {
+				delta = v - prev
+			}
+			sample.Counters[key] = int64(delta)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package collector
+
+import "syscall"
+
+// HostSupported - сборщик метрик хоста работает на этой платформе
+const HostSupported = true
+
+func statfs(path string) (diskStat, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return diskStat{}, err
+	}
+	size := uint64(st.Bsize)
+	return diskStat{total: st.Blocks * size, free: st.Bfree * size, avail: st.Bavail * size}, nil
+}
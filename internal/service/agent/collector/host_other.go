@@ -0,0 +1,12 @@
+//go:build !linux
+
+package collector
+
+import "errors"
+
+// HostSupported - сборщик метрик хоста работает на этой платформе
+const HostSupported = false
+
+func statfs(path string) (diskStat, error) {
+	return diskStat{}, errors.New("statfs is only supported on linux")
+}
@@ -0,0 +1,176 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeHost - каталоги procfs и sysfs с файлами из тестов
+type fakeHost struct {
+	t    *testing.T
+	proc string
+	sys  string
+}
+
+func newFakeHost(t *testing.T) *fakeHost {
+	root := t.TempDir()
+	return &fakeHost{t: t, proc: filepath.Join(root, "proc"), sys: filepath.Join(root, "sys")}
+}
+
+func (h *fakeHost) write(path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		h.t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+func (h *fakeHost) setCPU(content string) {
+	h.write(filepath.Join(h.proc, "stat"), content)
+}
+
+func (h *fakeHost) setNet(iface, file, value string) {
+	h.write(filepath.Join(h.sys, "class", "net", iface, "statistics", file), value)
+}
+
+func TestHostCollector(t *testing.T) {
+	host := newFakeHost(t)
+	host.setCPU("cpu  100 0 100 800 0 0 0 0 0 0\ncpu0 50 0 50 400 0 0 0 0 0 0\ncpu1 50 0 50 400 0 0 0 0 0 0\nintr 12345\n")
+	host.write(filepath.Join(host.proc, "meminfo"), "MemTotal:       2048 kB\nMemFree:        1024 kB\nMemAvailable:   1536 kB\nBuffers:        10 kB\n")
+	host.write(filepath.Join(host.proc, "loadavg"), "0.50 1.25 2.00 1/123 4567\n")
+	host.write(filepath.Join(host.proc, "mounts"), "/dev/sda1 / ext4 rw 0 0\nproc /proc proc rw 0 0\n/dev/sdb1 /mnt/my\\040disk xfs rw 0 0\n")
+	host.setNet("eth0", "rx_bytes", "1000\n")
+	host.setNet("eth0", "tx_bytes", "500\n")
+	host.setNet("lo", "rx_bytes", "999\n")
+
+	collector := NewHost(host.proc, host.sys)
+	var statfsCalls []string
+	collector.statfs = func(path string) (diskStat, error) {
+		statfsCalls = append(statfsCalls, path)
+		return diskStat{total: 1000, free: 300, avail: 250}, nil
+	}
+
+	first, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	t.Run("Память_и_нагрузка", func(t *testing.T) {
+		want := map[string]float64{
+			"TotalMemory":     2048 * 1024,
+			"FreeMemory":      1024 * 1024,
+			"AvailableMemory": 1536 * 1024,
+			"LoadAverage1":    0.5,
+			"LoadAverage5":    1.25,
+			"LoadAverage15":   2,
+		}
+		for key, value := range want {
+			if got, ok := first.Gauges[key]; !ok || got != value {
+				t.Errorf("%s = %v, want %v", key, got, value)
+			}
+		}
+	})
+
+	t.Run("Диски_без_виртуальных_файловых_систем", func(t *testing.T) {
+		if len(statfsCalls) != 2 || statfsCalls[0] != "/" || statfsCalls[1] != "/mnt/my disk" {
+			t.Errorf("statfs вызван для %v, want [/ /mnt/my disk]", statfsCalls)
+		}
+		// Зарезервированные для root блоки занятыми не считаются
+		if got := first.Gauges[`DiskUsedPercent{mount="/"}`]; got != 70 {
+			t.Errorf("DiskUsedPercent = %v, want 70", got)
+		}
+		if got := first.Gauges[`DiskFree{mount="/mnt/my disk"}`]; got != 250 {
+			t.Errorf("DiskFree = %v, want 250", got)
+		}
+	})
+
+	t.Run("Первый_проход_без_загрузки_CPU_и_приращений", func(t *testing.T) {
+		if _, ok := first.Gauges[`CPUutilization{cpu="0"}`]; ok {
+			t.Error("CPUutilization при первом проходе")
+		}
+		if len(first.Counters) != 0 {
+			t.Errorf("Counters = %v, want пусто", first.Counters)
+		}
+	})
+
+	// За интервал cpu0 занят на 75%, cpu1 на 50%
+	host.setCPU("cpu  175 0 150 875 0 0 0 0 0 0\ncpu0 100 0 75 425 0 0 0 0 0 0\ncpu1 75 0 75 450 0 0 0 0 0 0\n")
+	host.setNet("eth0", "rx_bytes", "1600\n")
+	host.setNet("eth0", "tx_bytes", "100\n")
+
+	second, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	t.Run("Загрузка_каждого_CPU", func(t *testing.T) {
+		want := map[string]float64{
+			`CPUutilization{cpu="0"}`:   75,
+			`CPUutilization{cpu="1"}`:   50,
+			`CPUutilization{cpu="all"}`: 62.5,
+		}
+		for key, value := range want {
+			if got := second.Gauges[key]; math.Abs(got-value) > 1e-9 {
+				t.Errorf("%s = %v, want %v", key, got, value)
+			}
+		}
+	})
+
+	t.Run("Приращения_сетевых_счетчиков", func(t *testing.T) {
+		if got := second.Counters[`NetRxBytes{interface="eth0"}`]; got != 600 {
+			t.Errorf("NetRxBytes = %d, want 600", got)
+		}
+		// Счетчик уменьшился после пересоздания интерфейса
+		if got := second.Counters[`NetTxBytes{interface="eth0"}`]; got != 100 {
+			t.Errorf("NetTxBytes = %d, want 100", got)
+		}
+		if _, ok := second.Counters[`NetRxBytes{interface="lo"}`]; ok {
+			t.Error("loopback не должен попадать в метрики")
+		}
+	})
+
+	t.Run("Частичный_сбор_при_ошибке_источника", func(t *testing.T) {
+		os.Remove(filepath.Join(host.proc, "loadavg"))
+		collector.statfs = func(string) (diskStat, error) { return diskStat{}, errors.New("permission denied") }
+
+		sample, err := collector.Collect(context.Background())
+		if err == nil {
+			t.Error("Collect() должен вернуть ошибку")
+		}
+		if _, ok := sample.Gauges["TotalMemory"]; !ok {
+			t.Error("Память не собрана из-за ошибки другого источника")
+		}
+	})
+}
+
+func TestHostCollector_IowaitDecrease(t *testing.T) {
+	host := newFakeHost(t)
+	collector := NewHost(host.proc, host.sys)
+
+	host.setCPU("cpu0 100 0 100 700 100 0 0 0 0 0\ncpu1 100 0 100 700 100 0 0 0 0 0\n")
+	if err := collector.collectCPU(NewSample()); err != nil {
+		t.Fatalf("collectCPU() error = %v", err)
+	}
+
+	// iowait уменьшился: у cpu0 простой за интервал отрицательный, у cpu1 меньше реального
+	host.setCPU("cpu0 110 0 110 710 80 0 0 0 0 0\ncpu1 150 0 150 750 90 0 0 0 0 0\n")
+	sample := NewSample()
+	if err := collector.collectCPU(sample); err != nil {
+		t.Fatalf("collectCPU() error = %v", err)
+	}
+
+	want := map[string]float64{
+		`CPUutilization{cpu="0"}`: 100,
+		`CPUutilization{cpu="1"}`: 100.0 / 140 * 100,
+	}
+	for key, value := range want {
+		if got := sample.Gauges[key]; math.Abs(got-value) > 1e-9 {
+			t.Errorf("%s = %v, want %v", key, got, value)
+		}
+	}
+}
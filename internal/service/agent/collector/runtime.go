@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+)
+
+// PollCount - счетчик проходов сборщика рантайма
+const PollCount = "PollCount"
+
+// Runtime - сборщик метрик рантайма Go самого агента
+type Runtime struct{}
+
+// NewRuntime - конструктор сборщика рантайма
+func NewRuntime() *Runtime {
+	return &Runtime{}
+}
+
+// Name - имя сборщика
+func (r *Runtime) Name() string {
+	return "runtime"
+}
+
+// Collect - метрики runtime.MemStats, RandomValue и PollCount
+func (r *Runtime) Collect(_ context.Context) (Sample, error) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	sample := NewSample()
+	sample.Gauges = map[string]float64{
+		"Alloc":         float64(stats.Alloc),
+		"BuckHashSys":   float64(stats.BuckHashSys),
+		"Frees":         float64(stats.Frees),
+		"GCCPUFraction": stats.GCCPUFraction,
+		"GCSys":         float64(stats.GCSys),
+		"HeapAlloc":     float64(stats.HeapAlloc),
+		"HeapIdle":      float64(stats.HeapIdle),
+		"HeapInuse":     float64(stats.HeapInuse),
+		"HeapObjects":   float64(stats.HeapObjects),
+		"HeapReleased":  float64(stats.HeapReleased),
+		"HeapSys":       float64(stats.HeapSys),
+		"LastGC":        float64(stats.LastGC),
+		"Lookups":       float64(stats.Lookups),
+		"MCacheInuse":   float64(stats.MCacheInuse),
+		"MCacheSys":     float64(stats.MCacheSys),
+		"MSpanInuse":    float64(stats.MSpanInuse),
+		"MSpanSys":      float64(stats.MSpanSys),
+		"Mallocs":       float64(stats.Mallocs),
+		"NextGC":        float64(stats.NextGC),
+		"NumForcedGC":   float64(stats.NumForcedGC),
+		"NumGC":         float64(stats.NumGC),
+		"OtherSys":      float64(stats.OtherSys),
+		"PauseTotalNs":  float64(stats.PauseTotalNs),
+		"StackInuse":    float64(stats.StackInuse),
+		"StackSys":      float64(stats.StackSys),
+		"Sys":           float64(stats.Sys),
+		"TotalAlloc":    float64(stats.TotalAlloc),
+		"RandomValue":   rand.Float64(),
+	}
+	sample.Counters[PollCount] = 1
+
+	return sample, nil
+}
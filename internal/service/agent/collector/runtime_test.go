@@ -0,0 +1,22 @@
+package collector
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRuntime_Collect(t *testing.T) {
+	sample, err := NewRuntime().Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	for _, name := range []string{"Alloc", "HeapAlloc", "Sys", "RandomValue"} {
+		if _, ok := sample.Gauges[name]; !ok {
+			t.Errorf("Нет метрики %s", name)
+		}
+	}
+	if sample.Counters[PollCount] != 1 {
+		t.Errorf("PollCount = %d, want 1", sample.Counters[PollCount])
+	}
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"yupi/internal/domain/metrics"
+)
+
+const spoolExt = ".json"
+
+// Spool - очередь неотправленных пакетов на диске, по файлу на пакет.
+// Имена файлов - возрастающие номера, поэтому порядок отправки сохраняется и после перезапуска агента.
+// Очередь ограничена: при переполнении удаляются самые старые пакеты.
+type Spool struct {
+	// mu защищает файлы очереди, replayMu - порядок досылки: пакеты досылаются по одному
+	// проходу за раз, а сетевая отправка идет без mu, чтобы Push не ждал сервер
+	mu         sync.Mutex
+	replayMu   sync.Mutex
+	dir        string
+	maxBatches int
+	nextSeq    uint64
+}
+
+// NewSpool - открывает очередь в каталоге dir, maxBatches <= 0 снимает ограничение
+func NewSpool(dir string, maxBatches int) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+
+	s := &Spool{dir: dir, maxBatches: maxBatches}
+
+	// Продолжаем нумерацию после пакетов, оставшихся с прошлого запуска
+	names, err := s.pending()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) > 0 {
+		last, _ := strconv.ParseUint(strings.TrimSuffix(names[len(names)-1], spoolExt), 10, 64)
+		s.nextSeq = last + 1
+	}
+
+	return s, nil
+}
+
+// Push - добавляет пакет в конец очереди
+func (s *Spool) Push(batch []metrics.Metrics) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Пишем во временный файл и переименовываем, чтобы после сбоя не остался обрезанный пакет
+	name := fmt.Sprintf("%020d%s", s.nextSeq, spoolExt)
+	tmp := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	s.nextSeq++
+
+	return s.trim()
+}
+
+// trim - удаляет самые старые пакеты сверх ограничения
+func (s *Spool) trim() error {
+	if s.maxBatches <= 0 {
+		return nil
+	}
+
+	names, err := s.pending()
+	if err != nil {
+		return err
+	}
+
+	for len(names) > s.maxBatches {
+		log.Printf("spool is full, dropping oldest batch %s", names[0])
+		if err := os.Remove(filepath.Join(s.dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// Replay - передает пакеты send от старых к новым и удаляет отправленные.
+// Останавливается на первой ошибке send и возвращает ее, пакет остается в очереди.
+// Поврежденные файлы пропускаются и удаляются.
+func (s *Spool) Replay(send func(batch []metrics.Metrics) error) error {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	s.mu.Lock()
+	names, err := s.pending()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		path := filepath.Join(s.dir, name)
+
+		var batch []metrics.Metrics
+		data, err := os.ReadFile(path)
+		// Пока шла отправка, пакет мог быть вытеснен из переполненной очереди
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			err = json.Unmarshal(data, &batch)
+		}
+		if err != nil {
+			log.Printf("dropping unreadable spooled batch %s: %v", name, err)
+			s.remove(path) //nolint:errcheck
+			continue
+		}
+
+		if err := send(batch); err != nil {
+			return err
+		}
+
+		if err := s.remove(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remove - удаляет файл пакета, уже вытесненный пакет ошибкой не считается
+func (s *Spool) remove(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Len - число пакетов в очереди
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names, _ := s.pending()
+	return len(names)
+}
+
+// pending - имена файлов пакетов по порядку
+func (s *Spool) pending() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Чужие файлы в каталоге не трогаем, пакеты узнаем по номеру в имени
+	var names []string
+	for _, e := range entries {
+		seq, ok := strings.CutSuffix(e.Name(), spoolExt)
+		if e.IsDir() || !ok {
+			continue
+		}
+		if _, err := strconv.ParseUint(seq, 10, 64); err == nil {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"yupi/internal/domain/metrics"
+)
+
+func spoolBatch(id string) []metrics.Metrics {
+	value := 1.0
+	return []metrics.Metrics{{ID: id, MType: metrics.TypeGauge, Value: &value}}
+}
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := NewSpool(dir, 3)
+	if err != nil {
+		t.Fatalf("NewSpool() error = %v", err)
+	}
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := spool.Push(spoolBatch(id)); err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+	}
+
+	t.Run("Переполнение_вытесняет_старые_пакеты", func(t *testing.T) {
+		if spool.Len() != 3 {
+			t.Errorf("Len() = %d, want 3", spool.Len())
+		}
+	})
+
+	t.Run("Ошибка_отправки_оставляет_пакет_в_очереди", func(t *testing.T) {
+		var sent []string
+		err := spool.Replay(func(batch []metrics.Metrics) error {
+			if batch[0].ID == "c" {
+				return errors.New("server unavailable")
+			}
+			sent = append(sent, batch[0].ID)
+			return nil
+		})
+
+		if err == nil || len(sent) != 1 || sent[0] != "b" {
+			t.Errorf("Replay() = %v, sent %v, want ошибку после [b]", err, sent)
+		}
+		if spool.Len() != 2 {
+			t.Errorf("Len() = %d, want 2", spool.Len())
+		}
+	})
+
+	t.Run("Очередь_переживает_перезапуск", func(t *testing.T) {
+		// Поврежденный пакет на месте уже вытесненного, он первый по порядку
+		os.WriteFile(filepath.Join(dir, "00000000000000000000.json"), []byte("{"), 0644)
+		os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a batch"), 0644)
+
+		reopened, err := NewSpool(dir, 3)
+		if err != nil {
+			t.Fatalf("NewSpool() error = %v", err)
+		}
+		if err := reopened.Push(spoolBatch("e")); err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+
+		var sent []string
+		err = reopened.Replay(func(batch []metrics.Metrics) error {
+			sent = append(sent, batch[0].ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Replay() error = %v", err)
+		}
+
+		// Поврежденный пакет пропущен, порядок сохранен, новый пакет после старых
+		want := []string{"c", "d", "e"}
+		if len(sent) != len(want) {
+			t.Fatalf("sent = %v, want %v", sent, want)
+		}
+		for i := range want {
+			if sent[i] != want[i] {
+				t.Errorf("sent[%d] = %s, want %s", i, sent[i], want[i])
+			}
+		}
+		if reopened.Len() != 0 {
+			t.Errorf("Len() = %d, want 0", reopened.Len())
+		}
+	})
+}
+
+func TestSpool_PushDuringReplay(t *testing.T) {
+	spool, err := NewSpool(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("NewSpool() error = %v", err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := spool.Push(spoolBatch(id)); err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+	}
+
+	// Пока пакет отправляется, очередь доступна: новый пакет вытесняет уже отправляемый a,
+	// а сам остается до следующего прохода
+	var sent []string
+	err = spool.Replay(func(batch []metrics.Metrics) error {
+		sent = append(sent, batch[0].ID)
+		if batch[0].ID == "a" {
+			return spool.Push(spoolBatch("c"))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+
+	if !slices.Equal(sent, []string{"a", "b"}) {
+		t.Errorf("sent = %v, want [a b]", sent)
+	}
+	if spool.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", spool.Len())
+	}
+}
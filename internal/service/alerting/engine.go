@@ -0,0 +1,375 @@
+package alerting
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"yupi/internal/domain/metrics"
+	"yupi/internal/httptransport/middlewares"
+	"yupi/internal/repository"
+)
+
+// State - состояние оповещения
+type State string
+
+const (
+	// StatePending - условие выполняется, но меньше, чем For правила
+	StatePending State = "pending"
+	// StateFiring - условие держится дольше For правила
+	StateFiring State = "firing"
+	// StateResolved - сработавшее оповещение, условие которого перестало выполняться
+	StateResolved State = "resolved"
+
+	// DefaultResolvedRetention - сколько показывать разрешенные оповещения
+	DefaultResolvedRetention = 15 * time.Minute
+)
+
+// AlertNameLabel - метка с именем правила в метках оповещения
+const AlertNameLabel = "alertname"
+
+var (
+	ErrAlertNotFound  = errors.New("alert not found")
+	ErrAlertNotFiring = errors.New("alert is not firing")
+)
+
+// Alert - оповещение правила по одному временному ряду
+type Alert struct {
+	// ID - постоянный идентификатор оповещения по правилу и ряду
+	ID          string            `json:"id"`
+	Rule        string            `json:"rule"`
+	Series      string            `json:"series"`
+	Labels      metrics.Labels    `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	State       State             `json:"state"`
+	Value       metrics.Float     `json:"value"`
+	ActiveAt    time.Time         `json:"active_at"`
+	FiredAt     time.Time         `json:"fired_at,omitzero"`
+	ResolvedAt  time.Time         `json:"resolved_at,omitzero"`
+	// SilencedBy - активные тишины, под которые попадает оповещение
+	SilencedBy []string `json:"silenced_by,omitempty"`
+	// Ack - подтверждение сработавшего оповещения
+	Ack *Acknowledgement `json:"ack,omitempty"`
+}
+
+// Engine - вычисляет правила по хранилищу и хранит состояние оповещений
+type Engine struct {
+	storage           repository.Storage
+	history           *repository.History
+	rules             []Rule
+	resolvedRetention time.Duration
+	notifier          *Notifier
+	silences          *Silences
+	now               func() time.Time
+
+	mu sync.RWMutex
+	// startedAt - время первого вычисления правил, до него движок не видел истории рядов
+	startedAt time.Time
+	// alerts - оповещения по правилу и ключу ряда
+	alerts map[string]*Alert
+}
+
+// NewEngine - конструктор движка правил. История нужна правилам со скоростью роста rate(...)
+func NewEngine(storage repository.Storage, history *repository.History, rules []Rule) (*Engine, error) {
+	for _, rule := range rules {
+		if rule.expr.rate && history == nil {
+			return nil, fmt.Errorf("rule %s: rate requires metric history to be enabled", rule.Name)
+		}
+	}
+
+	return &Engine{
+		storage:           storage,
+		history:           history,
+		rules:             rules,
+		resolvedRetention: DefaultResolvedRetention,
+		silences:          NewSilences(),
+		now:               time.Now,
+		alerts:            make(map[string]*Alert),
+	}, nil
+}
+
+// SetNotifier - рассылка уведомлений после каждого вычисления правил в Run
+func (e *Engine) SetNotifier(notifier *Notifier) {
+	e.notifier = notifier
+}
+
+// Silences - тишины и подтверждения оповещений движка
+func (e *Engine) Silences() *Silences {
+	return e.silences
+}
+
+// Acknowledge - подтверждает сработавшее оповещение по ID
+func (e *Engine) Acknowledge(id, by, comment string) (Alert, error) {
+	e.mu.RLock()
+	var found *Alert
+	for _, alert := range e.alerts {
+		if alert.ID == id {
+			found = alert
+			break
+		}
+	}
+	if found == nil {
+		e.mu.RUnlock()
+		return Alert{}, ErrAlertNotFound
+	}
+	alert := *found
+	e.mu.RUnlock()
+
+	if alert.State != StateFiring {
+		return Alert{}, ErrAlertNotFiring
+	}
+
+	ack := Acknowledgement{By: by, Comment: comment, At: e.now()}
+	err := e.silences.acknowledge(id, ack)
+	alert.Ack = &ack
+	alert.SilencedBy = e.silences.silencedBy(alert, e.now())
+	return alert, err
+}
+
+// Run - вычисляет правила с интервалом interval, пока не отменен ctx
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Уведомления отправляются в фоне, чтобы недоступный получатель не задерживал вычисление правил
+	var notifying sync.WaitGroup
+	defer notifying.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Evaluate(ctx); err != nil {
+				middlewares.Log.Error("Ошибка вычисления правил оповещений: " + err.Error())
+				continue
+			}
+			if e.notifier != nil {
+				alerts := e.Alerts()
+				notifying.Add(1)
+				go func() {
+					defer notifying.Done()
+					if err := e.notifier.Notify(ctx, alerts); err != nil {
+						middlewares.Log.Error("Ошибка отправки уведомлений: " + err.Error())
+					}
+				}()
+			}
+		}
+	}
+}
+
+// Evaluate - один проход всех правил по текущему состоянию хранилища
+func (e *Engine) Evaluate(ctx context.Context) error {
+	gauges, err := e.storage.GetAllGauges(ctx)
+	if err != nil {
+		return err
+	}
+	counters, err := e.storage.GetAllCounters(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := e.now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.startedAt.IsZero() {
+		e.startedAt = now
+	}
+
+	for _, rule := range e.rules {
+		e.update(rule, e.evalRule(rule, gauges, counters, now), now)
+	}
+
+	for id, alert := range e.alerts {
+		if alert.State == StateResolved && now.Sub(alert.ResolvedAt) >= e.resolvedRetention {
+			delete(e.alerts, id)
+		}
+	}
+
+	// Подтверждение действует до разрешения оповещения. Оповещения, восстановленные после
+	// перезапуска, снова проходят через pending, поэтому их подтверждения сохраняются
+	active := make(map[string]bool, len(e.alerts))
+	for _, alert := range e.alerts {
+		if alert.State != StateResolved {
+			active[alert.ID] = true
+		}
+	}
+	e.silences.retainAcks(active)
+
+	return nil
+}
+
+// Alerts - текущие оповещения, упорядоченные по правилу и ряду, с тишинами и подтверждениями
+func (e *Engine) Alerts() []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	now := e.now()
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, alert := range e.alerts {
+		a := *alert
+		a.SilencedBy = e.silences.silencedBy(a, now)
+		if ack, ok := e.silences.ack(a.ID); ok && a.State == StateFiring {
+			a.Ack = &ack
+		}
+		alerts = append(alerts, a)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+		return alerts[i].Series < alerts[j].Series
+	})
+	return alerts
+}
+
+// sample - значение ряда, для которого выполняется условие правила
+type sample struct {
+	key    string
+	labels metrics.Labels
+	value  float64
+}
+
+// evalRule - ряды, подходящие под выражение правила и удовлетворяющие условию
+func (e *Engine) evalRule(rule Rule, gauges map[string]float64, counters map[string]int64, now time.Time) []sample {
+	var active []sample
+	match := func(key string) (metrics.Labels, bool) {
+		name, labels, err := metrics.ParseSeriesKey(key)
+		if err != nil || name != rule.expr.name || !metrics.MatchAll(rule.expr.matchers, labels) {
+			return nil, false
+		}
+		return labels, true
+	}
+
+	if rule.expr.rate {
+		for key := range counters {
+			labels, ok := match(key)
+			if !ok {
+				continue
+			}
+			value, ok := e.rate(key, rule.expr.window, now)
+			if ok && rule.expr.compare(value) {
+				active = append(active, sample{key: key, labels: labels, value: value})
+			}
+		}
+		return active
+	}
+
+	for key, value := range gauges {
+		if labels, ok := match(key); ok && rule.expr.compare(value) {
+			active = append(active, sample{key: key, labels: labels, value: value})
+		}
+	}
+	for key, total := range counters {
+		if labels, ok := match(key); ok && rule.expr.compare(float64(total)) {
+			active = append(active, sample{key: key, labels: labels, value: float64(total)})
+		}
+	}
+	return active
+}
+
+// rate - средняя скорость роста счетчика в секунду за окно. Отсчет ведется от последней
+// точки не позже начала окна, поэтому счетчик без обновлений в окне имеет скорость 0.
+// Если ряд моложе окна, отсчет от его первой точки, а без прошедшего времени скорость неизвестна
+func (e *Engine) rate(key string, window time.Duration, now time.Time) (float64, bool) {
+	samples := e.history.Range(metrics.TypeCounter, key, time.Time{}, now)
+	if len(samples) == 0 {
+		// Счетчик есть в хранилище, но его точки вытеснены по сроку хранения - агент перестал
+		// присылать обновления. Сразу после запуска истории еще нет, поэтому нулевой скорость
+		// считаем, только когда движок наблюдает ряды дольше окна
+		return 0, now.Sub(e.startedAt) >= window
+	}
+
+	start := now.Add(-window)
+	base := samples[0]
+	for _, s := range samples {
+		if s.Timestamp.After(start) {
+			break
+		}
+		base = s
+	}
+	last := samples[len(samples)-1]
+
+	elapsed := now.Sub(base.Timestamp).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+
+	increase := last.Value - base.Value
+	// Счетчик уменьшился после сброса, считаем рост от нуля
+	if increase < 0 {
+		increase = last.Value
+	}
+	return increase / elapsed, true
+}
+
+// update - переводит оповещения правила по рядам, для которых выполняется условие
+func (e *Engine) update(rule Rule, active []sample, now time.Time) {
+	seen := make(map[string]bool, len(active))
+	for _, s := range active {
+		id := alertID(rule.Name, s.key)
+		seen[id] = true
+
+		alert, ok := e.alerts[id]
+		if !ok || alert.State == StateResolved {
+			alert = &Alert{
+				ID:          fingerprint(id),
+				Rule:        rule.Name,
+				Series:      s.key,
+				Labels:      alertLabels(rule, s.labels),
+				Annotations: rule.Annotations,
+				State:       StatePending,
+				ActiveAt:    now,
+			}
+			e.alerts[id] = alert
+		}
+		alert.Value = metrics.Float(s.value)
+
+		if alert.State == StatePending && now.Sub(alert.ActiveAt) >= rule.For {
+			alert.State = StateFiring
+			alert.FiredAt = now
+		}
+	}
+
+	for id, alert := range e.alerts {
+		if alert.Rule != rule.Name || seen[id] {
+			continue
+		}
+		switch alert.State {
+		case StatePending:
+			delete(e.alerts, id)
+		case StateFiring:
+			alert.State = StateResolved
+			alert.ResolvedAt = now
+		}
+	}
+}
+
+func alertID(rule, key string) string {
+	return rule + "\x00" + key
+}
+
+// fingerprint - ID оповещения для API, не зависит от перезапуска сервера
+func fingerprint(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// alertLabels - метки ряда, поверх них метки правила и имя правила
+func alertLabels(rule Rule, series metrics.Labels) metrics.Labels {
+	labels := make(metrics.Labels, len(series)+len(rule.Labels)+1)
+	for k, v := range series {
+		labels[k] = v
+	}
+	for k, v := range rule.Labels {
+		labels[k] = v
+	}
+	labels[AlertNameLabel] = rule.Name
+	return labels
+}
@@ -0,0 +1,180 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+	"yupi/internal/repository"
+)
+
+func newTestEngine(t *testing.T, storage repository.Storage, history *repository.History, rules string) (*Engine, *time.Time) {
+	t.Helper()
+
+	parsed, err := ParseRules([]byte(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := NewEngine(storage, history, parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	engine.now = func() time.Time { return now }
+	return engine, &now
+}
+
+func TestEngine_States(t *testing.T) {
+	ctx := context.Background()
+	storage := repository.NewMemStorage()
+	engine, now := newTestEngine(t, storage, nil,
+		`{"rules":[{"name":"HighHeap","expr":"HeapAlloc > 1KB","for":"2m","labels":{"severity":"warning"}}]}`)
+
+	state := func() []Alert {
+		t.Helper()
+		if err := engine.Evaluate(ctx); err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+		return engine.Alerts()
+	}
+
+	storage.UpdateGauge(ctx, `HeapAlloc{host="web-1"}`, 2048) //nolint:errcheck
+	storage.UpdateGauge(ctx, `HeapAlloc{host="web-2"}`, 10)   //nolint:errcheck
+
+	t.Run("Условие_выполнено_меньше_for", func(t *testing.T) {
+		alerts := state()
+		if len(alerts) != 1 || alerts[0].State != StatePending || alerts[0].Value != 2048 {
+			t.Fatalf("Alerts() = %+v, want один pending", alerts)
+		}
+		want := map[string]string{"host": "web-1", "severity": "warning", AlertNameLabel: "HighHeap"}
+		for k, v := range want {
+			if alerts[0].Labels[k] != v {
+				t.Errorf("Labels[%s] = %q, want %q", k, alerts[0].Labels[k], v)
+			}
+		}
+	})
+
+	t.Run("Условие_держится_дольше_for", func(t *testing.T) {
+		*now = now.Add(2 * time.Minute)
+		alerts := state()
+		if len(alerts) != 1 || alerts[0].State != StateFiring || !alerts[0].FiredAt.Equal(*now) {
+			t.Errorf("Alerts() = %+v, want firing", alerts)
+		}
+	})
+
+	t.Run("Условие_перестало_выполняться", func(t *testing.T) {
+		*now = now.Add(time.Minute)
+		storage.UpdateGauge(ctx, `HeapAlloc{host="web-1"}`, 100) //nolint:errcheck
+		alerts := state()
+		if len(alerts) != 1 || alerts[0].State != StateResolved || !alerts[0].ResolvedAt.Equal(*now) {
+			t.Errorf("Alerts() = %+v, want resolved", alerts)
+		}
+	})
+
+	t.Run("Повторное_срабатывание_начинается_с_pending", func(t *testing.T) {
+		*now = now.Add(time.Minute)
+		storage.UpdateGauge(ctx, `HeapAlloc{host="web-1"}`, 4096) //nolint:errcheck
+		alerts := state()
+		if len(alerts) != 1 || alerts[0].State != StatePending || !alerts[0].FiredAt.IsZero() {
+			t.Errorf("Alerts() = %+v, want новый pending", alerts)
+		}
+	})
+
+	t.Run("Pending_без_срабатывания_удаляется", func(t *testing.T) {
+		*now = now.Add(time.Minute)
+		storage.UpdateGauge(ctx, `HeapAlloc{host="web-1"}`, 0) //nolint:errcheck
+		if alerts := state(); len(alerts) != 0 {
+			t.Errorf("Alerts() = %+v, want пусто", alerts)
+		}
+	})
+}
+
+func TestEngine_ResolvedRetention(t *testing.T) {
+	ctx := context.Background()
+	storage := repository.NewMemStorage()
+	engine, now := newTestEngine(t, storage, nil, `{"rules":[{"name":"Polls","expr":"PollCount >= 5"}]}`)
+
+	// Без for оповещение срабатывает сразу, условие проверяется и для counter
+	storage.UpdateCounter(ctx, "PollCount", 5) //nolint:errcheck
+	engine.Evaluate(ctx)                       //nolint:errcheck
+	if alerts := engine.Alerts(); len(alerts) != 1 || alerts[0].State != StateFiring {
+		t.Fatalf("Alerts() = %+v, want firing", alerts)
+	}
+
+	storage.UpdateCounter(ctx, "PollCount", -5) //nolint:errcheck
+	engine.Evaluate(ctx)                        //nolint:errcheck
+	*now = now.Add(DefaultResolvedRetention)
+	engine.Evaluate(ctx) //nolint:errcheck
+	if alerts := engine.Alerts(); len(alerts) != 0 {
+		t.Errorf("Alerts() = %+v, разрешенное оповещение должно удалиться", alerts)
+	}
+}
+
+func TestEngine_Rate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Нужна_история", func(t *testing.T) {
+		rules, err := ParseRules([]byte(`{"rules":[{"name":"Slow","expr":"rate(PollCount[1m]) < 1"}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewEngine(repository.NewMemStorage(), nil, rules); err == nil {
+			t.Error("NewEngine() должен вернуть ошибку без истории")
+		}
+	})
+
+	// История пишет точки по реальному времени, поэтому и движок считает по нему
+	history := repository.NewHistory(time.Hour, 0)
+	storage := repository.WithHistory(repository.NewMemStorage(), history)
+	engine, _ := newTestEngine(t, storage, history, `{"rules":[
+		{"name":"Fast","expr":"rate(Requests[1m]) > 100"},
+		{"name":"Stalled","expr":"rate(Requests[50ms]) < 1"}
+	]}`)
+	engine.now = time.Now
+
+	storage.UpdateCounter(ctx, "Requests", 1) //nolint:errcheck
+	time.Sleep(20 * time.Millisecond)
+	storage.UpdateCounter(ctx, "Requests", 1000) //nolint:errcheck
+
+	engine.Evaluate(ctx) //nolint:errcheck
+	alerts := engine.Alerts()
+	if len(alerts) != 1 || alerts[0].Rule != "Fast" || alerts[0].Value <= 100 {
+		t.Fatalf("Alerts() = %+v, want только Fast", alerts)
+	}
+
+	// Обновлений в окне нет, скорость роста нулевая
+	time.Sleep(60 * time.Millisecond)
+	engine.Evaluate(ctx) //nolint:errcheck
+	alerts = engine.Alerts()
+	if len(alerts) != 2 || alerts[1].Rule != "Stalled" || alerts[1].Value != 0 {
+		t.Errorf("Alerts() = %+v, want Stalled со скоростью 0", alerts)
+	}
+}
+
+func TestEngine_RateWithoutSamples(t *testing.T) {
+	ctx := context.Background()
+	history := repository.NewHistory(20*time.Millisecond, 0)
+	storage := repository.WithHistory(repository.NewMemStorage(), history)
+	rules := `{"rules":[{"name":"Stalled","expr":"rate(Requests[50ms]) < 1"}]}`
+
+	// Счетчик восстановлен из снимка, истории после перезапуска нет
+	storage.UpdateCounter(ctx, "Requests", 10) //nolint:errcheck
+	time.Sleep(30 * time.Millisecond)
+	history.Prune()
+
+	engine, _ := newTestEngine(t, storage, history, rules)
+	engine.now = time.Now
+	engine.Evaluate(ctx) //nolint:errcheck
+	if alerts := engine.Alerts(); len(alerts) != 0 {
+		t.Fatalf("Alerts() = %+v, want пусто сразу после запуска", alerts)
+	}
+
+	// Агент перестал присылать обновления, точки вытеснены по сроку хранения
+	time.Sleep(60 * time.Millisecond)
+	history.Prune()
+	engine.Evaluate(ctx) //nolint:errcheck
+	alerts := engine.Alerts()
+	if len(alerts) != 1 || alerts[0].Rule != "Stalled" || alerts[0].Value != 0 {
+		t.Errorf("Alerts() = %+v, want Stalled со скоростью 0", alerts)
+	}
+}
@@ -0,0 +1,419 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"yupi/internal/domain/metrics"
+	"yupi/internal/retry"
+)
+
+const (
+	// DefaultRepeatInterval - как часто напоминать о сработавших оповещениях
+	DefaultRepeatInterval = 4 * time.Hour
+
+	// Статусы уведомления: есть сработавшие оповещения или все оповещения группы разрешены
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Webhook - получатель уведомлений. Без шаблона получает Notification в JSON,
+// с шаблоном text/template - тело, собранное по Notification, например для чата
+type Webhook struct {
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	Template    string            `json:"template,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+// NotifyConfig - настройки уведомлений: группировка, повторы и получатели
+type NotifyConfig struct {
+	// GroupBy - метки, по которым оповещения собираются в одно уведомление
+	GroupBy []string
+	// RepeatInterval - через сколько повторить уведомление, если группа все еще горит
+	RepeatInterval time.Duration
+	Webhooks       []Webhook
+}
+
+// notifyFile - раздел notify файла правил
+type notifyFile struct {
+	Notify struct {
+		GroupBy        []string  `json:"group_by"`
+		RepeatInterval string    `json:"repeat_interval"`
+		Webhooks       []Webhook `json:"webhooks"`
+	} `json:"notify"`
+}
+
+// LoadNotifyConfig - читает раздел notify из файла правил
+func LoadNotifyConfig(path string) (NotifyConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return NotifyConfig{}, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	return ParseNotifyConfig(data)
+}
+
+// ParseNotifyConfig - разбирает раздел вида
+// {"notify":{"group_by":["alertname"],"repeat_interval":"4h","webhooks":[{"name":"ops","url":"http://..."}]}}
+func ParseNotifyConfig(data []byte) (NotifyConfig, error) {
+	var file notifyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return NotifyConfig{}, fmt.Errorf("invalid notify config: %w", err)
+	}
+
+	cfg := NotifyConfig{
+		GroupBy:        file.Notify.GroupBy,
+		RepeatInterval: DefaultRepeatInterval,
+		Webhooks:       file.Notify.Webhooks,
+	}
+	if len(cfg.GroupBy) == 0 {
+		cfg.GroupBy = []string{AlertNameLabel}
+	}
+	if file.Notify.RepeatInterval != "" {
+		d, err := time.ParseDuration(file.Notify.RepeatInterval)
+		if err != nil || d <= 0 {
+			return NotifyConfig{}, fmt.Errorf("invalid notify repeat_interval %q", file.Notify.RepeatInterval)
+		}
+		cfg.RepeatInterval = d
+	}
+
+	return cfg, nil
+}
+
+// Notification - уведомление о группе оповещений
+type Notification struct {
+	Receiver    string         `json:"receiver"`
+	Status      string         `json:"status"`
+	GroupLabels metrics.Labels `json:"group_labels"`
+	Alerts      []Alert        `json:"alerts"`
+}
+
+// receiver - получатель с разобранным шаблоном
+type receiver struct {
+	Webhook
+	tmpl *template.Template
+}
+
+// groupState - что и когда последний раз отправлено получателю по группе
+type groupState struct {
+	// sent - последнее отправленное состояние оповещений группы по ключу alertID
+	sent     map[string]State
+	lastSent time.Time
+}
+
+// Notifier - рассылает уведомления о сработавших и разрешенных оповещениях.
+// Оповещения группируются по меткам GroupBy, уведомление уходит, когда в группе
+// появилось новое сработавшее или разрешенное оповещение, и повторяется раз в
+// RepeatInterval, пока группа горит. Получатель, не принявший уведомление,
+// получит его при следующем вызове Notify
+type Notifier struct {
+	groupBy        []string
+	repeatInterval time.Duration
+	receivers      []receiver
+	client         *http.Client
+	backoff        retry.Backoff
+	now            func() time.Time
+
+	mu sync.Mutex
+	// groups - состояние по получателю и ключу группы
+	groups map[string]*groupState
+	// busy - получатели, которым сейчас идет отправка
+	busy map[string]bool
+}
+
+// templateFuncs - функции шаблонов, json экранирует значение для вставки в JSON тело
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join": strings.Join,
+}
+
+// NewNotifier - конструктор рассылки, разбирает шаблоны получателей
+func NewNotifier(cfg NotifyConfig) (*Notifier, error) {
+	n := &Notifier{
+		groupBy:        cfg.GroupBy,
+		repeatInterval: cfg.RepeatInterval,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		backoff:        retry.DefaultBackoff,
+		now:            time.Now,
+		groups:         make(map[string]*groupState),
+		busy:           make(map[string]bool),
+	}
+	if n.repeatInterval <= 0 {
+		n.repeatInterval = DefaultRepeatInterval
+	}
+
+	names := make(map[string]bool, len(cfg.Webhooks))
+	for _, webhook := range cfg.Webhooks {
+		if webhook.Name == "" || webhook.URL == "" {
+			return nil, errors.New("webhook name and url are required")
+		}
+		if names[webhook.Name] {
+			return nil, fmt.Errorf("duplicate webhook %s", webhook.Name)
+		}
+		names[webhook.Name] = true
+
+		r := receiver{Webhook: webhook}
+		if webhook.Template != "" {
+			tmpl, err := template.New(webhook.Name).Funcs(templateFuncs).Parse(webhook.Template)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %s: invalid template: %w", webhook.Name, err)
+			}
+			r.tmpl = tmpl
+		}
+		n.receivers = append(n.receivers, r)
+	}
+
+	return n, nil
+}
+
+// delivery - уведомления одному получателю за вызов Notify
+type delivery struct {
+	receiver receiver
+	items    []deliveryItem
+}
+
+type deliveryItem struct {
+	state        *groupState
+	notification Notification
+}
+
+// Notify - рассылает уведомления по текущему списку оповещений движка.
+// Получатели обслуживаются параллельно и без общей блокировки, получатель, которому еще
+// идет отправка с прошлого вызова, пропускается и получит актуальное уведомление позже,
+// поэтому медленный получатель не задерживает остальных
+func (n *Notifier) Notify(ctx context.Context, alerts []Alert) error {
+	now := n.now()
+	deliveries := n.prepare(alerts, now)
+
+	errs := make([]error, len(deliveries))
+	var wg sync.WaitGroup
+	for i, d := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = n.deliver(ctx, d, now)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// prepare - уведомления, которые пора отправить, по свободным получателям, получатели помечаются занятыми
+func (n *Notifier) prepare(alerts []Alert, now time.Time) []delivery {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	groups := n.group(alerts)
+
+	var deliveries []delivery
+	for _, r := range n.receivers {
+		// Группы, оповещения которых ушли из движка, больше не отслеживаем
+		for stateKey := range n.groups {
+			name, key, _ := strings.Cut(stateKey, "\x00")
+			if _, ok := groups[key]; name == r.Name && !ok {
+				delete(n.groups, stateKey)
+			}
+		}
+
+		if n.busy[r.Name] {
+			continue
+		}
+
+		d := delivery{receiver: r}
+		for key, group := range groups {
+			stateKey := r.Name + "\x00" + key
+			state, ok := n.groups[stateKey]
+			if !ok {
+				state = &groupState{sent: make(map[string]State)}
+				n.groups[stateKey] = state
+			}
+
+			notification, ok := n.pending(state, group, now)
+			if !ok {
+				continue
+			}
+			notification.Receiver = r.Name
+			d.items = append(d.items, deliveryItem{state: state, notification: notification})
+		}
+
+		if len(d.items) > 0 {
+			n.busy[r.Name] = true
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries
+}
+
+// deliver - отправляет уведомления получателю и запоминает доставленные
+func (n *Notifier) deliver(ctx context.Context, d delivery, now time.Time) error {
+	var errs []error
+	delivered := make([]deliveryItem, 0, len(d.items))
+	for _, item := range d.items {
+		if err := n.send(ctx, d.receiver, item.notification); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s: %w", d.receiver.Name, err))
+			continue
+		}
+		delivered = append(delivered, item)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, item := range delivered {
+		item.state.lastSent = now
+		for _, alert := range item.notification.Alerts {
+			item.state.sent[alertID(alert.Rule, alert.Series)] = alert.State
+		}
+	}
+	delete(n.busy, d.receiver.Name)
+
+	return errors.Join(errs...)
+}
+
+// alertGroup - оповещения одной группы
+type alertGroup struct {
+	labels metrics.Labels
+	alerts []Alert
+}
+
+// group - сработавшие и разрешенные оповещения по группам, ожидающие в уведомления не попадают
+func (n *Notifier) group(alerts []Alert) map[string]*alertGroup {
+	groups := make(map[string]*alertGroup)
+	for _, alert := range alerts {
+		if alert.State != StateFiring && alert.State != StateResolved {
+			continue
+		}
+
+		labels := make(metrics.Labels, len(n.groupBy))
+		for _, name := range n.groupBy {
+			if value, ok := alert.Labels[name]; ok {
+				labels[name] = value
+			}
+		}
+
+		key := labels.String()
+		if _, ok := groups[key]; !ok {
+			groups[key] = &alertGroup{labels: labels}
+		}
+		groups[key].alerts = append(groups[key].alerts, alert)
+	}
+	return groups
+}
+
+// pending - уведомление по группе, если его пора отправить: в группе новое сработавшее
+// или разрешенное оповещение либо неподтвержденные оповещения горят дольше интервала повтора
+func (n *Notifier) pending(state *groupState, group *alertGroup, now time.Time) (Notification, bool) {
+	notification := Notification{Status: StatusResolved, GroupLabels: group.labels}
+	changed, unacked := false, false
+	current := make(map[string]bool, len(group.alerts))
+
+	for _, alert := range group.alerts {
+		id := alertID(alert.Rule, alert.Series)
+		current[id] = true
+		sent := state.sent[id]
+
+		// Заглушенные оповещения не рассылаются, но то, что о них уже сообщили, помним
+		if len(alert.SilencedBy) > 0 {
+			continue
+		}
+
+		switch alert.State {
+		case StateFiring:
+			notification.Status = StatusFiring
+			notification.Alerts = append(notification.Alerts, alert)
+			changed = changed || sent != StateFiring
+			unacked = unacked || alert.Ack == nil
+		case StateResolved:
+			// О разрешении сообщаем один раз и только если сообщали о срабатывании
+			if sent == StateFiring {
+				notification.Alerts = append(notification.Alerts, alert)
+				changed = true
+			}
+		}
+	}
+
+	for id := range state.sent {
+		if !current[id] {
+			delete(state.sent, id)
+		}
+	}
+
+	if len(notification.Alerts) == 0 {
+		return notification, false
+	}
+	// Напоминаем, только пока в группе есть неподтвержденные оповещения
+	repeat := unacked && now.Sub(state.lastSent) >= n.repeatInterval
+	return notification, changed || repeat
+}
+
+// send - отправляет уведомление получателю с повторами при временных ошибках
+func (n *Notifier) send(ctx context.Context, r receiver, notification Notification) error {
+	body, err := render(r, notification)
+	if err != nil {
+		return err
+	}
+
+	contentType := r.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	return retry.Do(ctx, n.backoff, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
+		for k, v := range r.Headers {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := n.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body) //nolint:errcheck
+
+		if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+			return nil
+		}
+		err = fmt.Errorf("receiver returned status: %d", resp.StatusCode)
+		if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+			return retry.Temporary(err)
+		}
+		return err
+	})
+}
+
+// render - тело уведомления: JSON или результат шаблона получателя
+func render(r receiver, notification Notification) ([]byte, error) {
+	sort.Slice(notification.Alerts, func(i, j int) bool {
+		return notification.Alerts[i].Series < notification.Alerts[j].Series
+	})
+
+	if r.tmpl == nil {
+		return json.Marshal(notification)
+	}
+
+	var buf bytes.Buffer
+	if err := r.tmpl.Execute(&buf, notification); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
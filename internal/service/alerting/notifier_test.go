@@ -0,0 +1,411 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"yupi/internal/domain/metrics"
+	"yupi/internal/retry"
+)
+
+// receiverServer - получатель уведомлений, отвечающий кодами из очереди, по умолчанию 200
+type receiverServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	bodies   []string
+	statuses []int
+}
+
+func newReceiver(t *testing.T) *receiverServer {
+	r := &receiverServer{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		if status == http.StatusOK {
+			r.bodies = append(r.bodies, string(body))
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiverServer) notifications(t *testing.T) []Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]Notification, len(r.bodies))
+	for i, body := range r.bodies {
+		if err := json.Unmarshal([]byte(body), &result[i]); err != nil {
+			t.Fatalf("Не удалось разобрать уведомление %q: %v", body, err)
+		}
+	}
+	return result
+}
+
+func testAlert(rule, host string, state State) Alert {
+	labels := metrics.Labels{AlertNameLabel: rule, "host": host}
+	return Alert{Rule: rule, Series: "HeapAlloc" + metrics.Labels{"host": host}.String(), Labels: labels, State: state}
+}
+
+func newTestNotifier(t *testing.T, cfg NotifyConfig) (*Notifier, *time.Time) {
+	t.Helper()
+
+	notifier, err := NewNotifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier.backoff = retry.Backoff{Attempts: 3, Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1}
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	notifier.now = func() time.Time { return now }
+	return notifier, &now
+}
+
+func TestNotifier_Deduplication(t *testing.T) {
+	ctx := context.Background()
+	receiver := newReceiver(t)
+	notifier, now := newTestNotifier(t, NotifyConfig{
+		GroupBy:        []string{AlertNameLabel},
+		RepeatInterval: time.Hour,
+		Webhooks:       []Webhook{{Name: "ops", URL: receiver.URL}},
+	})
+
+	steps := []struct {
+		name       string
+		advance    time.Duration
+		alerts     []Alert
+		wantSent   int
+		wantStatus string
+		wantAlerts int
+	}{
+		{
+			name:     "Ожидающие_не_отправляются",
+			alerts:   []Alert{testAlert("HighHeap", "web-1", StatePending)},
+			wantSent: 0,
+		},
+		{
+			name:       "Первое_срабатывание",
+			alerts:     []Alert{testAlert("HighHeap", "web-1", StateFiring)},
+			wantSent:   1,
+			wantStatus: StatusFiring,
+			wantAlerts: 1,
+		},
+		{
+			name:     "Повтор_без_изменений_не_отправляется",
+			advance:  time.Minute,
+			alerts:   []Alert{testAlert("HighHeap", "web-1", StateFiring)},
+			wantSent: 1,
+		},
+		{
+			name:       "Новое_оповещение_в_группе",
+			advance:    time.Minute,
+			alerts:     []Alert{testAlert("HighHeap", "web-1", StateFiring), testAlert("HighHeap", "web-2", StateFiring)},
+			wantSent:   2,
+			wantStatus: StatusFiring,
+			wantAlerts: 2,
+		},
+		{
+			name:       "Напоминание_после_интервала_повтора",
+			advance:    time.Hour,
+			alerts:     []Alert{testAlert("HighHeap", "web-1", StateFiring), testAlert("HighHeap", "web-2", StateFiring)},
+			wantSent:   3,
+			wantStatus: StatusFiring,
+			wantAlerts: 2,
+		},
+		{
+			name:       "Разрешение_части_группы",
+			advance:    time.Minute,
+			alerts:     []Alert{testAlert("HighHeap", "web-1", StateResolved), testAlert("HighHeap", "web-2", StateFiring)},
+			wantSent:   4,
+			wantStatus: StatusFiring,
+			wantAlerts: 2,
+		},
+		{
+			name:       "Разрешение_всей_группы",
+			advance:    time.Minute,
+			alerts:     []Alert{testAlert("HighHeap", "web-1", StateResolved), testAlert("HighHeap", "web-2", StateResolved)},
+			wantSent:   5,
+			wantStatus: StatusResolved,
+			wantAlerts: 1,
+		},
+		{
+			name:     "Разрешенные_не_повторяются",
+			advance:  2 * time.Hour,
+			alerts:   []Alert{testAlert("HighHeap", "web-1", StateResolved), testAlert("HighHeap", "web-2", StateResolved)},
+			wantSent: 5,
+		},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			*now = now.Add(step.advance)
+			if err := notifier.Notify(ctx, step.alerts); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+
+			sent := receiver.notifications(t)
+			if len(sent) != step.wantSent {
+				t.Fatalf("Отправлено %d уведомлений, want %d", len(sent), step.wantSent)
+			}
+			if step.wantStatus == "" {
+				return
+			}
+			last := sent[len(sent)-1]
+			if last.Status != step.wantStatus || len(last.Alerts) != step.wantAlerts || last.Receiver != "ops" {
+				t.Errorf("Уведомление = %+v, want status %s и %d оповещений", last, step.wantStatus, step.wantAlerts)
+			}
+			if last.GroupLabels[AlertNameLabel] != "HighHeap" {
+				t.Errorf("GroupLabels = %v, want alertname=HighHeap", last.GroupLabels)
+			}
+		})
+	}
+}
+
+func TestNotifier_Grouping(t *testing.T) {
+	receiver := newReceiver(t)
+	notifier, _ := newTestNotifier(t, NotifyConfig{
+		GroupBy:  []string{"host"},
+		Webhooks: []Webhook{{Name: "ops", URL: receiver.URL}},
+	})
+
+	alerts := []Alert{
+		testAlert("HighHeap", "web-1", StateFiring),
+		testAlert("HighCPU", "web-1", StateFiring),
+		testAlert("HighHeap", "web-2", StateFiring),
+	}
+	if err := notifier.Notify(context.Background(), alerts); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	count := map[string]int{}
+	for _, n := range receiver.notifications(t) {
+		count[n.GroupLabels["host"]] = len(n.Alerts)
+	}
+	if len(count) != 2 || count["web-1"] != 2 || count["web-2"] != 1 {
+		t.Errorf("Оповещений по группам %v, want web-1: 2, web-2: 1", count)
+	}
+}
+
+func TestNotifier_Retry(t *testing.T) {
+	ctx := context.Background()
+	alerts := []Alert{testAlert("HighHeap", "web-1", StateFiring)}
+
+	t.Run("Временная_ошибка_получателя", func(t *testing.T) {
+		receiver := newReceiver(t)
+		receiver.statuses = []int{http.StatusServiceUnavailable, http.StatusBadGateway}
+		notifier, _ := newTestNotifier(t, NotifyConfig{Webhooks: []Webhook{{Name: "ops", URL: receiver.URL}}})
+
+		if err := notifier.Notify(ctx, alerts); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+		if sent := receiver.notifications(t); len(sent) != 1 {
+			t.Errorf("Доставлено %d уведомлений, want 1", len(sent))
+		}
+	})
+
+	t.Run("Недоставленное_уведомление_отправляется_позже", func(t *testing.T) {
+		receiver := newReceiver(t)
+		receiver.statuses = []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable}
+		healthy := newReceiver(t)
+		notifier, _ := newTestNotifier(t, NotifyConfig{Webhooks: []Webhook{
+			{Name: "ops", URL: receiver.URL},
+			{Name: "chat", URL: healthy.URL},
+		}})
+
+		if err := notifier.Notify(ctx, alerts); err == nil {
+			t.Fatal("Notify() должен вернуть ошибку")
+		}
+		if err := notifier.Notify(ctx, alerts); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+
+		// Каждый получатель получил уведомление ровно один раз
+		if sent := receiver.notifications(t); len(sent) != 1 {
+			t.Errorf("ops получил %d уведомлений, want 1", len(sent))
+		}
+		if sent := healthy.notifications(t); len(sent) != 1 {
+			t.Errorf("chat получил %d уведомлений, want 1", len(sent))
+		}
+	})
+
+	t.Run("Отказ_получателя_не_повторяется", func(t *testing.T) {
+		receiver := newReceiver(t)
+		receiver.statuses = []int{http.StatusBadRequest}
+		notifier, _ := newTestNotifier(t, NotifyConfig{Webhooks: []Webhook{{Name: "ops", URL: receiver.URL}}})
+
+		if err := notifier.Notify(ctx, alerts); err == nil {
+			t.Fatal("Notify() должен вернуть ошибку")
+		}
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		if len(receiver.statuses) != 0 || len(receiver.bodies) != 0 {
+			t.Errorf("Получатель вызван повторно после 400")
+		}
+	})
+}
+
+func TestNotifier_SlowReceiver(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	var slowCalls sync.WaitGroup
+	slowCalls.Add(1)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slowCalls.Done()
+		<-release
+	}))
+	t.Cleanup(slow.Close)
+	healthy := newReceiver(t)
+
+	notifier, _ := newTestNotifier(t, NotifyConfig{Webhooks: []Webhook{
+		{Name: "slow", URL: slow.URL},
+		{Name: "chat", URL: healthy.URL},
+	}})
+
+	first := make(chan error, 1)
+	go func() { first <- notifier.Notify(ctx, []Alert{testAlert("HighHeap", "web-1", StateFiring)}) }()
+	slowCalls.Wait()
+	busy := func(name string) bool {
+		notifier.mu.Lock()
+		defer notifier.mu.Unlock()
+		return notifier.busy[name]
+	}
+	for deadline := time.Now().Add(5 * time.Second); busy("chat"); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("chat не получил первое уведомление")
+		}
+	}
+
+	// Пока отправка медленному получателю не завершилась, он пропускается, остальные получают уведомления
+	done := make(chan error, 1)
+	go func() {
+		done <- notifier.Notify(ctx, []Alert{
+			testAlert("HighHeap", "web-1", StateFiring),
+			testAlert("HighCPU", "web-1", StateFiring),
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify() ждет медленного получателя")
+	}
+
+	if sent := healthy.notifications(t); len(sent) != 2 {
+		t.Errorf("chat получил %d уведомлений, want 2", len(sent))
+	}
+
+	close(release)
+	if err := <-first; err != nil {
+		t.Errorf("Notify() error = %v", err)
+	}
+}
+
+func TestNotifier_Template(t *testing.T) {
+	receiver := newReceiver(t)
+	template := `{"text":{{json (printf "[%s] %s: %d" .Status (index .GroupLabels "alertname") (len .Alerts))}}}`
+	notifier, _ := newTestNotifier(t, NotifyConfig{
+		GroupBy:  []string{AlertNameLabel},
+		Webhooks: []Webhook{{Name: "chat", URL: receiver.URL, Template: template}},
+	})
+
+	alert := testAlert(`Heap "high"`, "web-1", StateFiring)
+	if err := notifier.Notify(context.Background(), []Alert{alert}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	want := `{"text":"[firing] Heap \"high\": 1"}`
+	if len(receiver.bodies) != 1 || receiver.bodies[0] != want {
+		t.Errorf("Тело уведомления = %v, want %s", receiver.bodies, want)
+	}
+}
+
+func TestNotifier_NonFiniteValues(t *testing.T) {
+	ctx := context.Background()
+	receiver := newReceiver(t)
+	notifier, _ := newTestNotifier(t, NotifyConfig{
+		GroupBy:  []string{AlertNameLabel},
+		Webhooks: []Webhook{{Name: "ops", URL: receiver.URL}},
+	})
+
+	inf := testAlert("HighHeap", "web-1", StateFiring)
+	inf.Value = metrics.Float(math.Inf(1))
+	nan := testAlert("HighHeap", "web-2", StateFiring)
+	nan.Value = metrics.Float(math.NaN())
+	alerts := []Alert{inf, nan}
+
+	if err := notifier.Notify(ctx, alerts); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	// Доставленная группа не отправляется повторно на следующем вычислении правил
+	if err := notifier.Notify(ctx, alerts); err != nil {
+		t.Fatalf("Повторный Notify() error = %v", err)
+	}
+
+	sent := receiver.notifications(t)
+	if len(sent) != 1 || len(sent[0].Alerts) != 2 {
+		t.Fatalf("Получено уведомлений %+v, want одно с двумя оповещениями", sent)
+	}
+	if got := float64(sent[0].Alerts[0].Value); !math.IsInf(got, 1) {
+		t.Errorf("Значение web-1 = %v, want +Inf", got)
+	}
+	if got := float64(sent[0].Alerts[1].Value); !math.IsNaN(got) {
+		t.Errorf("Значение web-2 = %v, want NaN", got)
+	}
+}
+
+func TestParseNotifyConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    NotifyConfig
+		wantErr bool
+	}{
+		{
+			name: "Значения_по_умолчанию",
+			data: `{"rules":[],"notify":{"webhooks":[{"name":"ops","url":"http://localhost"}]}}`,
+			want: NotifyConfig{GroupBy: []string{AlertNameLabel}, RepeatInterval: DefaultRepeatInterval},
+		},
+		{
+			name: "Явные_настройки",
+			data: `{"notify":{"group_by":["host"],"repeat_interval":"30m"}}`,
+			want: NotifyConfig{GroupBy: []string{"host"}, RepeatInterval: 30 * time.Minute},
+		},
+		{name: "Неверный_интервал", data: `{"notify":{"repeat_interval":"often"}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNotifyConfig([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNotifyConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got.GroupBy) != 1 || got.GroupBy[0] != tt.want.GroupBy[0] || got.RepeatInterval != tt.want.RepeatInterval {
+				t.Errorf("ParseNotifyConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewNotifier(NotifyConfig{Webhooks: []Webhook{{Name: "bad", URL: "http://x", Template: "{{"}}}); err == nil {
+		t.Error("NewNotifier() должен вернуть ошибку для неверного шаблона")
+	}
+}
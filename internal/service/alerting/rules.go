@@ -0,0 +1,241 @@
+// Package alerting - правила оповещений по метрикам сервера: правила периодически
+// вычисляются по хранилищу, оповещения проходят состояния pending, firing и resolved
+package alerting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"yupi/internal/domain/metrics"
+)
+
+var (
+	ErrInvalidRule = errors.New("invalid alerting rule")
+	ErrInvalidExpr = errors.New("invalid rule expression")
+)
+
+// Rule - правило оповещения: выражение и время, которое условие должно держаться до срабатывания
+type Rule struct {
+	Name        string            `json:"name"`
+	Expr        string            `json:"expr"`
+	For         time.Duration     `json:"-"`
+	Labels      metrics.Labels    `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	expr expression
+}
+
+// rulesFile - формат файла правил
+type rulesFile struct {
+	Rules []struct {
+		Name        string            `json:"name"`
+		Expr        string            `json:"expr"`
+		For         string            `json:"for"`
+		Labels      metrics.Labels    `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"rules"`
+}
+
+// LoadRules - читает правила из JSON файла
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	return ParseRules(data)
+}
+
+// ParseRules - разбирает правила вида
+// {"rules":[{"name":"HighHeap","expr":"HeapAlloc > 500MB","for":"2m","labels":{"severity":"warning"}}]}
+func ParseRules(data []byte) ([]Rule, error) {
+	var file rulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+
+	rules := make([]Rule, 0, len(file.Rules))
+	names := make(map[string]bool, len(file.Rules))
+	for _, raw := range file.Rules {
+		if strings.TrimSpace(raw.Name) == "" {
+			return nil, fmt.Errorf("%w: name is required", ErrInvalidRule)
+		}
+		if names[raw.Name] {
+			return nil, fmt.Errorf("%w: duplicate rule %s", ErrInvalidRule, raw.Name)
+		}
+		names[raw.Name] = true
+
+		if err := raw.Labels.Validate(); err != nil {
+			return nil, fmt.Errorf("%w %s: %v", ErrInvalidRule, raw.Name, err)
+		}
+
+		rule := Rule{Name: raw.Name, Expr: raw.Expr, Labels: raw.Labels, Annotations: raw.Annotations}
+		if raw.For != "" {
+			d, err := time.ParseDuration(raw.For)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("%w %s: invalid for %q", ErrInvalidRule, raw.Name, raw.For)
+			}
+			rule.For = d
+		}
+
+		expr, err := parseExpr(raw.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", raw.Name, err)
+		}
+		rule.expr = expr
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// expression - условие правила: значение ряда или скорость роста счетчика, сравниваемая с порогом
+type expression struct {
+	name      string
+	matchers  []metrics.Matcher
+	rate      bool
+	window    time.Duration
+	op        string
+	threshold float64
+}
+
+var (
+	metricNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.:]*`)
+	// Длинные операторы раньше коротких, чтобы >= не разобрался как >
+	operators = []string{">=", "<=", "==", "!=", ">", "<"}
+	// Множители единиц порога, двоичные, как и размеры памяти в метриках рантайма
+	units = map[string]float64{
+		"":   1,
+		"KB": 1 << 10,
+		"MB": 1 << 20,
+		"GB": 1 << 30,
+		"TB": 1 << 40,
+	}
+)
+
+// parseExpr - разбирает выражение вида
+//
+//	HeapAlloc > 500MB
+//	CPUutilization{cpu="all"} >= 90
+//	rate(PollCount{host=~"web-.*"}[1m]) < 0.1
+func parseExpr(s string) (expression, error) {
+	var e expression
+	rest := strings.TrimSpace(s)
+
+	if inner, ok := strings.CutPrefix(rest, "rate("); ok {
+		e.rate = true
+		rest = strings.TrimSpace(inner)
+	}
+
+	name := metricNameRe.FindString(rest)
+	if name == "" {
+		return e, fmt.Errorf("%w: metric name expected in %q", ErrInvalidExpr, s)
+	}
+	e.name = name
+	rest = strings.TrimSpace(rest[len(name):])
+
+	if strings.HasPrefix(rest, "{") {
+		end := selectorEnd(rest)
+		if end < 0 {
+			return e, fmt.Errorf("%w: unterminated selector in %q", ErrInvalidExpr, s)
+		}
+		matchers, err := metrics.ParseMatchers(rest[:end+1])
+		if err != nil {
+			return e, fmt.Errorf("%w: %v", ErrInvalidExpr, err)
+		}
+		e.matchers = matchers
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+
+	if e.rate {
+		window, after, ok := strings.Cut(strings.TrimPrefix(rest, "["), "]")
+		if !strings.HasPrefix(rest, "[") || !ok {
+			return e, fmt.Errorf("%w: rate window expected in %q", ErrInvalidExpr, s)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(window))
+		if err != nil || d <= 0 {
+			return e, fmt.Errorf("%w: invalid rate window %q", ErrInvalidExpr, window)
+		}
+		e.window = d
+
+		rest, ok = strings.CutPrefix(strings.TrimSpace(after), ")")
+		if !ok {
+			return e, fmt.Errorf("%w: missing ) in %q", ErrInvalidExpr, s)
+		}
+		rest = strings.TrimSpace(rest)
+	}
+
+	for _, op := range operators {
+		if after, ok := strings.CutPrefix(rest, op); ok {
+			e.op = op
+			rest = strings.TrimSpace(after)
+			break
+		}
+	}
+	if e.op == "" {
+		return e, fmt.Errorf("%w: comparison operator expected in %q", ErrInvalidExpr, s)
+	}
+
+	threshold, err := parseThreshold(rest)
+	if err != nil {
+		return e, fmt.Errorf("%w: %v", ErrInvalidExpr, err)
+	}
+	e.threshold = threshold
+
+	return e, nil
+}
+
+// selectorEnd - позиция закрывающей скобки селектора с учетом строк в кавычках
+func selectorEnd(s string) int {
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inQuotes && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && s[i] == '}':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseThreshold - число с необязательной единицей KB, MB, GB или TB
+func parseThreshold(s string) (float64, error) {
+	number := strings.TrimRightFunc(s, func(r rune) bool { return r >= 'A' && r <= 'Z' })
+	multiplier, ok := units[s[len(number):]]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in threshold %q", s)
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid threshold %q", s)
+	}
+	return value * multiplier, nil
+}
+
+// compare - выполняется ли условие для значения
+func (e expression) compare(value float64) bool {
+	switch e.op {
+	case ">":
+		return value > e.threshold
+	case ">=":
+		return value >= e.threshold
+	case "<":
+		return value < e.threshold
+	case "<=":
+		return value <= e.threshold
+	case "==":
+		return value == e.threshold
+	case "!=":
+		return value != e.threshold
+	}
+	return false
+}
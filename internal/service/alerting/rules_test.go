@@ -0,0 +1,89 @@
+package alerting
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		want    expression
+		wantErr bool
+	}{
+		{
+			name: "Порог_с_единицей",
+			expr: "HeapAlloc > 500MB",
+			want: expression{name: "HeapAlloc", op: ">", threshold: 500 << 20},
+		},
+		{
+			name: "Селектор_по_меткам",
+			expr: `CPUutilization{cpu="all", host=~"web-}.*"} >= 90.5`,
+			want: expression{name: "CPUutilization", op: ">=", threshold: 90.5},
+		},
+		{
+			name: "Скорость_роста_счетчика",
+			expr: "rate(PollCount[1m]) < 0.1",
+			want: expression{name: "PollCount", rate: true, window: time.Minute, op: "<", threshold: 0.1},
+		},
+		{name: "Нет_оператора", expr: "HeapAlloc 500", wantErr: true},
+		{name: "Неизвестная_единица", expr: "HeapAlloc > 5PB", wantErr: true},
+		{name: "Нет_окна_у_rate", expr: "rate(PollCount) > 1", wantErr: true},
+		{name: "Незакрытый_селектор", expr: `HeapAlloc{host="a" > 1`, wantErr: true},
+		{name: "Пустое_выражение", expr: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExpr(tt.expr)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidExpr) {
+					t.Errorf("parseExpr() error = %v, want ErrInvalidExpr", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseExpr() error = %v", err)
+			}
+			if got.name != tt.want.name || got.rate != tt.want.rate || got.window != tt.want.window ||
+				got.op != tt.want.op || got.threshold != tt.want.threshold {
+				t.Errorf("parseExpr() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{
+			name: "Успешный_разбор",
+			data: `{"rules":[{"name":"HighHeap","expr":"HeapAlloc > 500MB","for":"2m","labels":{"severity":"warning"}}]}`,
+		},
+		{name: "Повтор_имени", data: `{"rules":[{"name":"A","expr":"X > 1"},{"name":"A","expr":"Y > 1"}]}`, wantErr: true},
+		{name: "Без_имени", data: `{"rules":[{"expr":"X > 1"}]}`, wantErr: true},
+		{name: "Неверная_длительность", data: `{"rules":[{"name":"A","expr":"X > 1","for":"soon"}]}`, wantErr: true},
+		{name: "Неверное_выражение", data: `{"rules":[{"name":"A","expr":"X >"}]}`, wantErr: true},
+		{name: "Неверный_JSON", data: `{"rules":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRules([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(rules) != 1 || rules[0].For != 2*time.Minute || rules[0].Labels["severity"] != "warning" {
+				t.Errorf("ParseRules() = %+v", rules)
+			}
+		})
+	}
+}
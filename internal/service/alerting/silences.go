@@ -0,0 +1,295 @@
+package alerting
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"yupi/internal/domain/metrics"
+)
+
+const (
+	// SilencesSection - раздел снимка FileStorage с тишинами и подтверждениями
+	SilencesSection = "alerting"
+
+	// ExpiredSilenceRetention - сколько показывать истекшие тишины
+	ExpiredSilenceRetention = 24 * time.Hour
+
+	// Состояния тишины
+	SilencePending = "pending"
+	SilenceActive  = "active"
+	SilenceExpired = "expired"
+)
+
+var (
+	ErrSilenceNotFound = errors.New("silence not found")
+	ErrInvalidSilence  = errors.New("invalid silence")
+)
+
+// Silence - тишина: пока она активна, оповещения метрики Metric с метками,
+// подходящими под Matchers, не рассылаются. Метки оповещения включают alertname,
+// поэтому тишину можно задать и по правилу
+type Silence struct {
+	ID        string    `json:"id"`
+	Metric    string    `json:"metric,omitempty"`
+	Matchers  string    `json:"matchers,omitempty"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	// Status - состояние на момент запроса, не хранится
+	Status string `json:"status,omitempty"`
+
+	matchers []metrics.Matcher
+}
+
+// Acknowledgement - подтверждение, что сработавшее оповещение взято в работу.
+// Подтвержденное оповещение не повторяется в уведомлениях, пока не разрешится
+type Acknowledgement struct {
+	By      string    `json:"by,omitempty"`
+	Comment string    `json:"comment,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Silences - тишины и подтверждения оповещений
+type Silences struct {
+	mu       sync.RWMutex
+	silences map[string]*Silence
+	// acks - подтверждения по ID оповещения
+	acks     map[string]Acknowledgement
+	onChange func() error
+	now      func() time.Time
+}
+
+// NewSilences - пустое хранилище тишин
+func NewSilences() *Silences {
+	return &Silences{
+		silences: make(map[string]*Silence),
+		acks:     make(map[string]Acknowledgement),
+		now:      time.Now,
+	}
+}
+
+// OnChange - вызывается после создания и отмены тишины и подтверждения оповещения,
+// например чтобы сразу записать снимок на диск
+func (s *Silences) OnChange(fn func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = fn
+}
+
+// Add - создает тишину. Нужна метрика или селектор меток, StartsAt по умолчанию - сейчас
+func (s *Silences) Add(silence Silence) (Silence, error) {
+	if silence.Metric == "" && silence.Matchers == "" {
+		return Silence{}, fmt.Errorf("%w: metric or matchers is required", ErrInvalidSilence)
+	}
+
+	matchers, err := metrics.ParseMatchers(silence.Matchers)
+	if err != nil {
+		return Silence{}, fmt.Errorf("%w: %v", ErrInvalidSilence, err)
+	}
+	silence.matchers = matchers
+
+	now := s.now()
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = now
+	}
+	if !silence.EndsAt.After(silence.StartsAt) || !silence.EndsAt.After(now) {
+		return Silence{}, fmt.Errorf("%w: ends_at must be in the future and after starts_at", ErrInvalidSilence)
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Silence{}, err
+	}
+	silence.ID = id
+	silence.Status = ""
+
+	s.mu.Lock()
+	s.silences[id] = &silence
+	s.mu.Unlock()
+
+	return s.withStatus(silence, now), s.changed()
+}
+
+// List - тишины по времени начала, истекшие давнее ExpiredSilenceRetention удаляются
+func (s *Silences) List() []Silence {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]Silence, 0, len(s.silences))
+	for id, silence := range s.silences {
+		if now.Sub(silence.EndsAt) >= ExpiredSilenceRetention {
+			delete(s.silences, id)
+			continue
+		}
+		result = append(result, s.withStatus(*silence, now))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].StartsAt.Equal(result[j].StartsAt) {
+			return result[i].StartsAt.Before(result[j].StartsAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Expire - досрочно завершает тишину
+func (s *Silences) Expire(id string) (Silence, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	silence, ok := s.silences[id]
+	if !ok {
+		s.mu.Unlock()
+		return Silence{}, ErrSilenceNotFound
+	}
+	if silence.EndsAt.After(now) {
+		silence.EndsAt = now
+		// Тишина, которая еще не началась, заканчивается раньше начала
+		if silence.StartsAt.After(now) {
+			silence.StartsAt = now
+		}
+	}
+	result := s.withStatus(*silence, now)
+	s.mu.Unlock()
+
+	return result, s.changed()
+}
+
+// silencedBy - ID активных тишин, под которые попадает оповещение
+func (s *Silences) silencedBy(alert Alert, now time.Time) []string {
+	name, _, _ := metrics.ParseSeriesKey(alert.Series)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []string
+	for id, silence := range s.silences {
+		if now.Before(silence.StartsAt) || !now.Before(silence.EndsAt) {
+			continue
+		}
+		if silence.Metric != "" && silence.Metric != name {
+			continue
+		}
+		if metrics.MatchAll(silence.matchers, alert.Labels) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// acknowledge - сохраняет подтверждение оповещения
+func (s *Silences) acknowledge(alertID string, ack Acknowledgement) error {
+	s.mu.Lock()
+	s.acks[alertID] = ack
+	s.mu.Unlock()
+
+	return s.changed()
+}
+
+// ack - подтверждение оповещения, если оно есть
+func (s *Silences) ack(alertID string) (Acknowledgement, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ack, ok := s.acks[alertID]
+	return ack, ok
+}
+
+// retainAcks - удаляет подтверждения оповещений, которых нет среди active
+func (s *Silences) retainAcks(active map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range s.acks {
+		if !active[id] {
+			delete(s.acks, id)
+		}
+	}
+}
+
+func (s *Silences) changed() error {
+	s.mu.RLock()
+	onChange := s.onChange
+	s.mu.RUnlock()
+
+	if onChange == nil {
+		return nil
+	}
+	return onChange()
+}
+
+func (s *Silences) withStatus(silence Silence, now time.Time) Silence {
+	switch {
+	case now.Before(silence.StartsAt):
+		silence.Status = SilencePending
+	case now.Before(silence.EndsAt):
+		silence.Status = SilenceActive
+	default:
+		silence.Status = SilenceExpired
+	}
+	return silence
+}
+
+// silencesState - формат раздела снимка
+type silencesState struct {
+	Silences []Silence                  `json:"silences"`
+	Acks     map[string]Acknowledgement `json:"acks,omitempty"`
+}
+
+// SnapshotState - состояние для снимка FileStorage
+func (s *Silences) SnapshotState() (json.RawMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state := silencesState{Silences: make([]Silence, 0, len(s.silences)), Acks: s.acks}
+	for _, silence := range s.silences {
+		state.Silences = append(state.Silences, *silence)
+	}
+	return json.Marshal(state)
+}
+
+// RestoreState - восстанавливает состояние из снимка FileStorage
+func (s *Silences) RestoreState(data json.RawMessage) error {
+	var state silencesState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	silences := make(map[string]*Silence, len(state.Silences))
+	for _, silence := range state.Silences {
+		matchers, err := metrics.ParseMatchers(silence.Matchers)
+		if err != nil {
+			return fmt.Errorf("silence %s: %w", silence.ID, err)
+		}
+		silence.matchers = matchers
+		silence.Status = ""
+		silences[silence.ID] = &silence
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.silences = silences
+	s.acks = make(map[string]Acknowledgement, len(state.Acks))
+	for id, ack := range state.Acks {
+		s.acks[id] = ack
+	}
+	return nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,285 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"yupi/internal/domain/metrics"
+	"yupi/internal/repository"
+)
+
+func newTestSilences() (*Silences, *time.Time) {
+	silences := NewSilences()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	silences.now = func() time.Time { return now }
+	return silences, &now
+}
+
+func TestSilences_Add(t *testing.T) {
+	silences, now := newTestSilences()
+
+	tests := []struct {
+		name    string
+		silence Silence
+		wantErr bool
+	}{
+		{name: "По_метрике", silence: Silence{Metric: "HeapAlloc", EndsAt: now.Add(time.Hour)}},
+		{name: "По_меткам", silence: Silence{Matchers: `host=~"web-.*"`, EndsAt: now.Add(time.Hour)}},
+		{name: "Без_условий", silence: Silence{EndsAt: now.Add(time.Hour)}, wantErr: true},
+		{name: "Неверный_селектор", silence: Silence{Matchers: "host=web", EndsAt: now.Add(time.Hour)}, wantErr: true},
+		{name: "Окончание_в_прошлом", silence: Silence{Metric: "HeapAlloc", EndsAt: now.Add(-time.Minute)}, wantErr: true},
+		{
+			name:    "Окончание_раньше_начала",
+			silence: Silence{Metric: "HeapAlloc", StartsAt: now.Add(2 * time.Hour), EndsAt: now.Add(time.Hour)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := silences.Add(tt.silence)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSilence) {
+					t.Errorf("Add() error = %v, want ErrInvalidSilence", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+			if got.ID == "" || got.Status != SilenceActive || !got.StartsAt.Equal(*now) {
+				t.Errorf("Add() = %+v, want активную тишину с началом сейчас", got)
+			}
+		})
+	}
+}
+
+func TestSilences_Match(t *testing.T) {
+	silences, now := newTestSilences()
+	byMetric, _ := silences.Add(Silence{Metric: "HeapAlloc", EndsAt: now.Add(time.Hour)})
+	byRule, _ := silences.Add(Silence{Matchers: `alertname="HighCPU",host="web-1"`, EndsAt: now.Add(time.Hour)})
+	future, _ := silences.Add(Silence{Metric: "Sys", StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour)})
+
+	alert := func(rule, series string) Alert {
+		name, labels, _ := metrics.ParseSeriesKey(series)
+		if labels == nil {
+			labels = metrics.Labels{}
+		}
+		labels[AlertNameLabel] = rule
+		return Alert{Rule: rule, Series: metrics.SeriesKey(name, labels), Labels: labels}
+	}
+
+	tests := []struct {
+		name  string
+		alert Alert
+		want  []string
+	}{
+		{name: "Совпала_метрика", alert: alert("HighHeap", `HeapAlloc{host="db-1"}`), want: []string{byMetric.ID}},
+		{name: "Совпали_метки", alert: alert("HighCPU", `CPUutilization{host="web-1"}`), want: []string{byRule.ID}},
+		{name: "Не_совпали_метки", alert: alert("HighCPU", `CPUutilization{host="web-2"}`)},
+		{name: "Тишина_еще_не_началась", alert: alert("HighSys", "Sys")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := silences.silencedBy(tt.alert, *now)
+			if len(got) != len(tt.want) || (len(got) == 1 && got[0] != tt.want[0]) {
+				t.Errorf("silencedBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Досрочное_завершение", func(t *testing.T) {
+		expired, err := silences.Expire(byMetric.ID)
+		if err != nil || expired.Status != SilenceExpired {
+			t.Fatalf("Expire() = %+v, %v, want expired", expired, err)
+		}
+		if got := silences.silencedBy(alert("HighHeap", "HeapAlloc"), *now); len(got) != 0 {
+			t.Errorf("silencedBy() = %v после завершения тишины", got)
+		}
+		if _, err := silences.Expire("unknown"); !errors.Is(err, ErrSilenceNotFound) {
+			t.Errorf("Expire() error = %v, want ErrSilenceNotFound", err)
+		}
+	})
+
+	t.Run("Истекшие_удаляются_из_списка", func(t *testing.T) {
+		if got := len(silences.List()); got != 3 {
+			t.Fatalf("List() вернул %d тишин, want 3", got)
+		}
+		// Через сутки после окончания остается только тишина, закончившаяся позже всех
+		*now = now.Add(ExpiredSilenceRetention + 90*time.Minute)
+		list := silences.List()
+		if len(list) != 1 || list[0].ID != future.ID {
+			t.Errorf("List() = %+v, want только тишину %s", list, future.ID)
+		}
+	})
+}
+
+func TestSilences_State(t *testing.T) {
+	silences, now := newTestSilences()
+	var changes int
+	silences.OnChange(func() error {
+		changes++
+		return nil
+	})
+
+	silence, _ := silences.Add(Silence{Metric: "HeapAlloc", Matchers: `host="web-1"`, EndsAt: now.Add(time.Hour)})
+	silences.acknowledge("abc", Acknowledgement{By: "oncall", At: *now}) //nolint:errcheck
+	if changes != 2 {
+		t.Errorf("OnChange вызван %d раз, want 2", changes)
+	}
+
+	data, err := silences.SnapshotState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, _ := newTestSilences()
+	if err := restored.RestoreState(data); err != nil {
+		t.Fatalf("RestoreState() error = %v", err)
+	}
+
+	alert := Alert{Series: `HeapAlloc{host="web-1"}`, Labels: metrics.Labels{"host": "web-1"}}
+	if got := restored.silencedBy(alert, *now); len(got) != 1 || got[0] != silence.ID {
+		t.Errorf("После восстановления silencedBy() = %v, want [%s]", got, silence.ID)
+	}
+	if ack, ok := restored.ack("abc"); !ok || ack.By != "oncall" {
+		t.Errorf("После восстановления ack = %+v, %v", ack, ok)
+	}
+}
+
+func TestEngine_Acknowledge(t *testing.T) {
+	ctx := context.Background()
+	storage := repository.NewMemStorage()
+	engine, now := newTestEngine(t, storage, nil, `{"rules":[
+		{"name":"HighHeap","expr":"HeapAlloc > 1KB"},
+		{"name":"SlowHeap","expr":"HeapAlloc > 1KB","for":"1h"}
+	]}`)
+	engine.silences.now = engine.now
+
+	storage.UpdateGauge(ctx, "HeapAlloc", 2048) //nolint:errcheck
+	engine.Evaluate(ctx)                        //nolint:errcheck
+
+	alerts := engine.Alerts()
+	firing, pending := alerts[0], alerts[1]
+
+	if _, err := engine.Acknowledge("unknown", "oncall", ""); !errors.Is(err, ErrAlertNotFound) {
+		t.Errorf("Acknowledge() error = %v, want ErrAlertNotFound", err)
+	}
+	if _, err := engine.Acknowledge(pending.ID, "oncall", ""); !errors.Is(err, ErrAlertNotFiring) {
+		t.Errorf("Acknowledge() error = %v, want ErrAlertNotFiring", err)
+	}
+
+	acked, err := engine.Acknowledge(firing.ID, "oncall", "смотрю")
+	if err != nil || acked.Ack == nil || acked.Ack.By != "oncall" {
+		t.Fatalf("Acknowledge() = %+v, %v", acked, err)
+	}
+	if got := engine.Alerts()[0]; got.Ack == nil {
+		t.Error("Подтверждение не видно в Alerts()")
+	}
+
+	// После разрешения и нового срабатывания подтверждения нет
+	storage.UpdateGauge(ctx, "HeapAlloc", 0) //nolint:errcheck
+	*now = now.Add(time.Minute)
+	engine.Evaluate(ctx)                        //nolint:errcheck
+	storage.UpdateGauge(ctx, "HeapAlloc", 4096) //nolint:errcheck
+	*now = now.Add(time.Minute)
+	engine.Evaluate(ctx) //nolint:errcheck
+	if got := engine.Alerts()[0]; got.State != StateFiring || got.ID != firing.ID || got.Ack != nil {
+		t.Errorf("Alerts()[0] = %+v, want firing без подтверждения", got)
+	}
+}
+
+func TestNotifier_SilencesAndAcks(t *testing.T) {
+	ctx := context.Background()
+	receiver := newReceiver(t)
+	notifier, now := newTestNotifier(t, NotifyConfig{
+		GroupBy:        []string{AlertNameLabel},
+		RepeatInterval: time.Hour,
+		Webhooks:       []Webhook{{Name: "ops", URL: receiver.URL}},
+	})
+
+	silenced := testAlert("HighHeap", "web-1", StateFiring)
+	silenced.SilencedBy = []string{"s1"}
+	if err := notifier.Notify(ctx, []Alert{silenced}); err != nil {
+		t.Fatal(err)
+	}
+	if sent := receiver.notifications(t); len(sent) != 0 {
+		t.Fatalf("Заглушенное оповещение отправлено: %+v", sent)
+	}
+
+	// Тишина закончилась - оповещение уходит
+	firing := testAlert("HighHeap", "web-1", StateFiring)
+	notifier.Notify(ctx, []Alert{firing}) //nolint:errcheck
+
+	// Подтвержденное оповещение не повторяется
+	firing.Ack = &Acknowledgement{By: "oncall"}
+	*now = now.Add(2 * time.Hour)
+	notifier.Notify(ctx, []Alert{firing}) //nolint:errcheck
+
+	// О разрешении подтвержденного оповещения сообщаем
+	*now = now.Add(time.Minute)
+	notifier.Notify(ctx, []Alert{testAlert("HighHeap", "web-1", StateResolved)}) //nolint:errcheck
+
+	sent := receiver.notifications(t)
+	if len(sent) != 2 || sent[0].Status != StatusFiring || sent[1].Status != StatusResolved {
+		t.Errorf("Уведомления = %+v, want firing и resolved", sent)
+	}
+}
+
+func TestEngine_AckSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	storage := repository.NewMemStorage()
+	storage.UpdateGauge(ctx, "HeapAlloc", 2048) //nolint:errcheck
+	rules := `{"rules":[{"name":"HighHeap","expr":"HeapAlloc > 1KB","for":"1m"}]}`
+
+	engine, now := newTestEngine(t, storage, nil, rules)
+	engine.Evaluate(ctx) //nolint:errcheck
+	*now = now.Add(time.Minute)
+	engine.Evaluate(ctx) //nolint:errcheck
+	firing := engine.Alerts()[0]
+	if _, err := engine.Acknowledge(firing.ID, "oncall", ""); err != nil {
+		t.Fatalf("Acknowledge() error = %v", err)
+	}
+	data, err := engine.Silences().SnapshotState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Перезапуск: оповещений в памяти нет, подтверждение восстановлено из снимка
+	restarted, now := newTestEngine(t, storage, nil, rules)
+	if err := restarted.Silences().RestoreState(data); err != nil {
+		t.Fatal(err)
+	}
+	restarted.Evaluate(ctx) //nolint:errcheck
+	*now = now.Add(time.Minute)
+	restarted.Evaluate(ctx) //nolint:errcheck
+
+	got := restarted.Alerts()[0]
+	if got.ID != firing.ID || got.State != StateFiring || got.Ack == nil || got.Ack.By != "oncall" {
+		t.Fatalf("После перезапуска Alerts()[0] = %+v, want firing с подтверждением", got)
+	}
+
+	// Разрешение снимает подтверждение, новый случай начинается без него
+	storage.UpdateGauge(ctx, "HeapAlloc", 0) //nolint:errcheck
+	*now = now.Add(time.Minute)
+	restarted.Evaluate(ctx)                     //nolint:errcheck
+	storage.UpdateGauge(ctx, "HeapAlloc", 4096) //nolint:errcheck
+	*now = now.Add(time.Minute)
+	restarted.Evaluate(ctx) //nolint:errcheck
+	*now = now.Add(time.Minute)
+	restarted.Evaluate(ctx) //nolint:errcheck
+	if got := restarted.Alerts()[0]; got.State != StateFiring || got.Ack != nil {
+		t.Errorf("Новый случай = %+v, want firing без подтверждения", got)
+	}
+
+	// Подтверждение оповещения, которое не сработало после перезапуска, не переходит на будущие случаи
+	stale, _ := newTestEngine(t, storage, nil, rules)
+	stale.Silences().RestoreState(data)      //nolint:errcheck
+	storage.UpdateGauge(ctx, "HeapAlloc", 0) //nolint:errcheck
+	stale.Evaluate(ctx)                      //nolint:errcheck
+	if _, ok := stale.Silences().ack(firing.ID); ok {
+		t.Error("Подтверждение неактивного оповещения осталось после вычисления правил")
+	}
+}
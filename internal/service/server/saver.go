@@ -8,16 +8,19 @@ import (
 )
 
 type MetricsSaver struct {
-	storage  repository.FileStorage
+	storage  *repository.FileStorage
 	config   *config.ServerConfig
 	stopChan chan struct{}
+	// syncChan - запросы на синхронную запись, каждый ждет ответ в своем канале
+	syncChan chan chan error
 }
 
-func NewMetricsSaver(storage repository.FileStorage, config *config.ServerConfig) *MetricsSaver {
+func NewMetricsSaver(storage *repository.FileStorage, config *config.ServerConfig) *MetricsSaver {
 	return &MetricsSaver{
 		storage:  storage,
 		config:   config,
 		stopChan: make(chan struct{}),
+		syncChan: make(chan chan error),
 	}
 }
 
@@ -27,6 +30,10 @@ func (s *MetricsSaver) Run() error {
 		if err := s.storage.LoadFromFile(*s.config); err != nil {
 			middlewares.Log.Error("Ошибка загрузки метрик: " + err.Error())
 		}
+		// Поверх снимка применяем обновления из журнала, сделанные после него
+		if err := s.storage.ReplayWAL(); err != nil {
+			middlewares.Log.Error("Ошибка восстановления метрик из журнала: " + err.Error())
+		}
 	}
 
 	// Запускаем периодическое сохранение
@@ -45,9 +52,28 @@ func (s *MetricsSaver) Stop() error {
 	return nil
 }
 
+// IsSync - включен ли режим синхронной записи
+func (s *MetricsSaver) IsSync() bool {
+	return s.config.StoreInterval == 0
+}
+
+// Sync - сохраняет метрики в файл и ждет завершения записи.
+// Одновременные вызовы объединяются в одну запись.
+func (s *MetricsSaver) Sync() error {
+	done := make(chan error, 1)
+	select {
+	case s.syncChan <- done:
+	case <-s.stopChan:
+		// При остановке метрики сохранит Stop
+		return nil
+	}
+	return <-done
+}
+
 func (s *MetricsSaver) startMetricsSaver() {
 	// Если интервал 0, делаем синхронную запись
-	if s.config.StoreInterval == 0 {
+	if s.IsSync() {
+		s.startSyncSaver()
 		return
 	}
 
@@ -65,3 +91,37 @@ func (s *MetricsSaver) startMetricsSaver() {
 		}
 	}
 }
+
+// startSyncSaver - обслуживает запросы Sync: забирает все ожидающие запросы,
+// делает одну запись и отвечает всем сразу
+func (s *MetricsSaver) startSyncSaver() {
+	for {
+		var waiters []chan error
+
+		select {
+		case done := <-s.syncChan:
+			waiters = append(waiters, done)
+		case <-s.stopChan:
+			return
+		}
+
+	drain:
+		for {
+			select {
+			case done := <-s.syncChan:
+				waiters = append(waiters, done)
+			default:
+				break drain
+			}
+		}
+
+		err := s.storage.SaveToFile(*s.config)
+		if err != nil {
+			middlewares.Log.Error("Ошибка синхронного сохранения метрик: " + err.Error())
+		}
+
+		for _, done := range waiters {
+			done <- err
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"yupi/internal/config"
+	"yupi/internal/repository"
+)
+
+func TestMetricsSaver_SyncMode(t *testing.T) {
+	cfg := &config.ServerConfig{
+		StoreInterval:   0,
+		FileStoragePath: filepath.Join(t.TempDir(), "metrics-db.json"),
+	}
+
+	fileStorage := repository.NewFileStorage(repository.NewMemStorage())
+	saver := NewMetricsSaver(fileStorage, cfg)
+	if err := saver.Run(); err != nil {
+		t.Fatalf("Не удалось запустить сохранялку: %v", err)
+	}
+	defer saver.Stop()
+
+	storage := saver.WrapStorage(fileStorage)
+	ctx := context.Background()
+
+	// Конкурентные обновления объединяются, но каждое подтверждается только после записи
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := storage.UpdateCounter(ctx, "test_counter", 1); err != nil {
+				t.Errorf("UpdateCounter() ошибка %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := storage.UpdateGauge(ctx, "test_gauge", 42.5); err != nil {
+		t.Fatalf("UpdateGauge() ошибка %v", err)
+	}
+
+	// Читаем файл в новое хранилище, как после падения сервера
+	restored := repository.NewFileStorage(repository.NewMemStorage())
+	if err := restored.LoadFromFile(*cfg); err != nil {
+		t.Fatalf("Не удалось прочитать файл: %v", err)
+	}
+
+	if got, _, _ := restored.GetCounter(ctx, "test_counter"); got != 10 {
+		t.Errorf("counter в файле = %v, ожидали 10", got)
+	}
+	if got, _, _ := restored.GetGauge(ctx, "test_gauge"); got != 42.5 {
+		t.Errorf("gauge в файле = %v, ожидали 42.5", got)
+	}
+}
+
+func TestMetricsSaver_WrapStorageIntervalMode(t *testing.T) {
+	cfg := &config.ServerConfig{StoreInterval: config.DefaultStoreInterval}
+	fileStorage := repository.NewFileStorage(repository.NewMemStorage())
+	saver := NewMetricsSaver(fileStorage, cfg)
+
+	if storage := saver.WrapStorage(fileStorage); storage != repository.Storage(fileStorage) {
+		t.Error("В режиме с интервалом хранилище не должно оборачиваться")
+	}
+}
+
+func TestMetricsSaver_SyncModeNonFinite(t *testing.T) {
+	cfg := &config.ServerConfig{
+		StoreInterval:   0,
+		FileStoragePath: filepath.Join(t.TempDir(), "metrics-db.json"),
+	}
+
+	fileStorage := repository.NewFileStorage(repository.NewMemStorage())
+	saver := NewMetricsSaver(fileStorage, cfg)
+	if err := saver.Run(); err != nil {
+		t.Fatalf("Не удалось запустить сохранялку: %v", err)
+	}
+	defer saver.Stop()
+
+	storage := saver.WrapStorage(fileStorage)
+	ctx := context.Background()
+
+	// Бесконечность в хранилище не ломает запись следующих обновлений
+	if err := storage.UpdateGauge(ctx, "inf", math.Inf(1)); err != nil {
+		t.Fatalf("UpdateGauge(+Inf) ошибка %v", err)
+	}
+	if err := storage.UpdateGauge(ctx, "nan", math.NaN()); err != nil {
+		t.Fatalf("UpdateGauge(NaN) ошибка %v", err)
+	}
+	if err := storage.UpdateCounter(ctx, "test_counter", 1); err != nil {
+		t.Fatalf("UpdateCounter() ошибка %v", err)
+	}
+
+	restored := repository.NewFileStorage(repository.NewMemStorage())
+	if err := restored.LoadFromFile(*cfg); err != nil {
+		t.Fatalf("Не удалось прочитать файл: %v", err)
+	}
+	if got, _, _ := restored.GetGauge(ctx, "inf"); !math.IsInf(got, 1) {
+		t.Errorf("gauge inf в файле = %v, ожидали +Inf", got)
+	}
+	if got, _, _ := restored.GetGauge(ctx, "nan"); !math.IsNaN(got) {
+		t.Errorf("gauge nan в файле = %v, ожидали NaN", got)
+	}
+	if got, _, _ := restored.GetCounter(ctx, "test_counter"); got != 1 {
+		t.Errorf("counter в файле = %v, ожидали 1", got)
+	}
+}
+
+func TestMetricsSaver_SyncFailureKeepsUpdate(t *testing.T) {
+	// Путь снимка внутри файла: директорию создать нельзя, запись всегда падает
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.ServerConfig{
+		StoreInterval:   0,
+		FileStoragePath: filepath.Join(blocker, "metrics-db.json"),
+	}
+
+	fileStorage := repository.NewFileStorage(repository.NewMemStorage())
+	saver := NewMetricsSaver(fileStorage, cfg)
+	if err := saver.Run(); err != nil {
+		t.Fatalf("Не удалось запустить сохранялку: %v", err)
+	}
+	defer saver.Stop()
+
+	storage := saver.WrapStorage(fileStorage)
+	ctx := context.Background()
+
+	// Обновление применено, поэтому клиент не должен получить ошибку и повторить его
+	if err := storage.UpdateCounter(ctx, "test_counter", 1); err != nil {
+		t.Errorf("UpdateCounter() ошибка %v, ожидали успех при сбое записи на диск", err)
+	}
+	if got, _, _ := storage.GetCounter(ctx, "test_counter"); got != 1 {
+		t.Errorf("counter = %v, ожидали 1", got)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"yupi/internal/domain/metrics"
+	"yupi/internal/repository"
+)
+
+// syncStorage - обертка над хранилищем, которая после каждого обновления
+// дожидается записи метрик на диск. Ошибка записи не возвращается клиенту: обновление
+// уже применено в памяти и попадет на диск со следующей записью, а повтор запроса
+// после ошибки прибавил бы счетчики дважды. Ошибку записи логирует MetricsSaver
+type syncStorage struct {
+	repository.Storage
+	saver *MetricsSaver
+}
+
+// WrapStorage - в синхронном режиме возвращает хранилище, подтверждающее обновление
+// только после записи на диск, иначе возвращает хранилище без изменений
+func (s *MetricsSaver) WrapStorage(storage repository.Storage) repository.Storage {
+	if !s.IsSync() {
+		return storage
+	}
+	return &syncStorage{Storage: storage, saver: s}
+}
+
+func (s *syncStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	if err := s.Storage.UpdateGauge(ctx, name, value); err != nil {
+		return err
+	}
+	s.saver.Sync() //nolint:errcheck
+	return nil
+}
+
+func (s *syncStorage) UpdateCounter(ctx context.Context, name string, delta int64) error {
+	if err := s.Storage.UpdateCounter(ctx, name, delta); err != nil {
+		return err
+	}
+	s.saver.Sync() //nolint:errcheck
+	return nil
+}
+
+func (s *syncStorage) UpdateBatch(ctx context.Context, batch []metrics.Metrics) error {
+	if err := s.Storage.UpdateBatch(ctx, batch); err != nil {
+		return err
+	}
+	s.saver.Sync() //nolint:errcheck
+	return nil
+}
@@ -0,0 +1,30 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Header - заголовок с подписью тела запроса или ответа
+const Header = "HashSHA256"
+
+// Sign - подпись данных HMAC-SHA256 общим ключом в шестнадцатеричном виде
+func Sign(key string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Valid - совпадает ли подпись с данными. Сравнение за постоянное время,
+// чтобы по времени ответа нельзя было подобрать подпись
+func Valid(key string, data []byte, sign string) bool {
+	got, err := hex.DecodeString(sign)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(data)
+	return hmac.Equal(got, mac.Sum(nil))
+}
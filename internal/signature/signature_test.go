@@ -0,0 +1,30 @@
+package signature
+
+import "testing"
+
+func TestValid(t *testing.T) {
+	data := []byte(`{"id":"Alloc","type":"gauge","value":1}`)
+	sign := Sign("secret", data)
+
+	tests := []struct {
+		name string
+		key  string
+		data []byte
+		sign string
+		want bool
+	}{
+		{"Успешная_проверка", "secret", data, sign, true},
+		{"Другой_ключ", "other", data, sign, false},
+		{"Измененные_данные", "secret", []byte(`{"id":"Alloc","type":"gauge","value":2}`), sign, false},
+		{"Подпись_не_hex", "secret", data, "not-hex", false},
+		{"Пустая_подпись", "secret", data, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Valid(tt.key, tt.data, tt.sign); got != tt.want {
+				t.Errorf("Valid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
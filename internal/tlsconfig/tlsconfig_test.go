@@ -0,0 +1,145 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA - центр сертификации для тестов, выпускает сертификаты в каталог dir
+type testCA struct {
+	t    *testing.T
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	path string
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	ca := &testCA{t: t, dir: dir, cert: cert, key: key, path: filepath.Join(dir, name+".pem")}
+	writePEM(t, ca.path, "CERTIFICATE", der)
+	return ca
+}
+
+// issue - выпускает сертификат и возвращает пути к нему и к ключу
+func (ca *testCA) issue(name string, usage x509.ExtKeyUsage) (string, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certPath := filepath.Join(ca.dir, name+".crt")
+	keyPath := filepath.Join(ca.dir, name+".key")
+	writePEM(ca.t, certPath, "CERTIFICATE", der)
+	writePEM(ca.t, keyPath, "EC PRIVATE KEY", keyDER)
+	return certPath, keyPath
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	otherCA := newTestCA(t, dir, "other-ca")
+
+	serverCert, serverKey := ca.issue("server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue("client", x509.ExtKeyUsageClientAuth)
+	strangerCert, strangerKey := otherCA.issue("stranger", x509.ExtKeyUsageClientAuth)
+
+	serverTLS, err := Server(serverCert, serverKey, ca.path)
+	if err != nil {
+		t.Fatalf("Server() error = %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = serverTLS
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		caFile  string
+		cert    string
+		key     string
+		wantErr bool
+	}{
+		{"Успешное_соединение_с_клиентским_сертификатом", ca.path, clientCert, clientKey, false},
+		{"Без_клиентского_сертификата", ca.path, "", "", true},
+		{"Сертификат_чужого_центра", ca.path, strangerCert, strangerKey, true},
+		{"Сервер_не_проходит_pinning", otherCA.path, clientCert, clientKey, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientTLS, err := Client(tt.caFile, tt.cert, tt.key)
+			if err != nil {
+				t.Fatalf("Client() error = %v", err)
+			}
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			resp, err := client.Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	if _, err := Server("", "", ""); err != ErrIncompleteKeyPair {
+		t.Errorf("Server() без сертификата error = %v, want ErrIncompleteKeyPair", err)
+	}
+	if _, err := Client("", "client.crt", ""); err != ErrIncompleteKeyPair {
+		t.Errorf("Client() без ключа error = %v, want ErrIncompleteKeyPair", err)
+	}
+	if _, err := Client(filepath.Join(t.TempDir(), "missing.pem"), "", ""); err == nil {
+		t.Error("Client() с несуществующим CA должен вернуть ошибку")
+	}
+}